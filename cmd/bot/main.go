@@ -0,0 +1,161 @@
+// Command bot fills a game with computer players
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/bot"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/broker"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logging"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func main() {
+	defaults := bot.DefaultConfig()
+	count := flag.Int("n", 1, "number of bots to start")
+	strategyNames := flag.String("strategy", "random", "comma separated strategies handed out to the bots in turn: random, aggressive or defensive")
+	thinkTime := flag.Duration("think", defaults.ThinkTime, "average time a bot waits between two commands")
+	maxUnits := flag.Int("max-units", defaults.MaxUnits, "number of units a bot stops spawning at")
+	prefix := flag.String("prefix", "bot", "start of the generated usernames")
+	seed := flag.Int64("seed", defaults.Seed, "seed of the first bot, the others use the following seeds")
+	duration := flag.Duration("duration", 0, "stop after this long, 0 plays until interrupted")
+	verbose := flag.Bool("verbose", false, "print what every bot sees instead of only joining and leaving")
+	gameFlag := flag.String("game", "", "game the bots join, empty for the default game")
+	verify := flag.String("verify", string(auth.PolicyReject), "what to do with messages with a missing or bad signature: reject, warn or off")
+	traceDest := flag.String("trace", os.Getenv("PERIL_TRACE"), "export trace spans as JSON Lines to stdout, stderr or a file, empty disables tracing (default $PERIL_TRACE)")
+	loadBroker := broker.Flags(flag.CommandLine, broker.DefaultConfig("peril-bot"))
+	loadLogging := logging.Flags(flag.CommandLine, logging.DefaultConfig())
+	flag.Parse()
+
+	logConfig, err := loadLogging()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logging.Setup(logConfig)
+
+	stopTracing, err := tracing.Setup(*traceDest, "peril-bot")
+	if err != nil {
+		logging.Fatal("invalid -trace", "err", err)
+	}
+	defer stopTracing()
+
+	brokerConfig, err := loadBroker()
+	if err != nil {
+		logging.Fatal("invalid broker configuration", "err", err)
+	}
+	verifyPolicy, err := auth.ParsePolicy(*verify)
+	if err != nil {
+		logging.Fatal("invalid -verify", "err", err)
+	}
+	game, err := routing.ParseGame(*gameFlag)
+	if err != nil {
+		logging.Fatal("invalid -game", "err", err)
+	}
+	if *count <= 0 {
+		logging.Fatal("-n must be at least 1")
+	}
+	strategies := []bot.Strategy{}
+	for _, name := range strings.Split(*strategyNames, ",") {
+		strategy, err := bot.ParseStrategy(strings.TrimSpace(name))
+		if err != nil {
+			logging.Fatal("invalid -strategy", "err", err)
+		}
+		strategies = append(strategies, strategy)
+	}
+
+	// a random part keeps names from clashing with bots of an earlier run,
+	// whose names the server may still hold
+	run := make([]byte, 2)
+	if _, err := rand.Read(run); err != nil {
+		logging.Fatal("could not generate usernames", "err", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < *count; i++ {
+		username := fmt.Sprintf("%s-%s-%d", *prefix, hex.EncodeToString(run), i+1)
+		if err := session.ValidateUsername(username); err != nil {
+			logging.Fatal("invalid -prefix", "err", err)
+		}
+
+		cfg := defaults
+		cfg.Strategy = strategies[i%len(strategies)]
+		cfg.ThinkTime = *thinkTime
+		cfg.MaxUnits = *maxUnits
+		cfg.Seed = *seed + int64(i)
+
+		renderer := gamelogic.Discard
+		if *verbose {
+			renderer = gamelogic.Labelled(os.Stdout, username+": ")
+		}
+		conn, c, err := join(brokerConfig, game, username, verifyPolicy, renderer)
+		if err != nil {
+			logging.Fatal("could not start bot", "username", username, "err", err)
+		}
+		fmt.Printf("%s joined playing %s\n", username, cfg.Strategy.Name())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			bot.New(c, cfg).Play(stop)
+			c.Close()
+		}()
+	}
+
+	waitForStop(*duration)
+	close(stop)
+	wg.Wait()
+	fmt.Println("All bots left the game")
+}
+
+// join connects and registers one bot, every bot has its own connection
+func join(cfg broker.Config, game routing.Game, username string, verify auth.Policy, renderer gamelogic.Renderer) (*amqp.Connection, *client.Client, error) {
+	cfg.ConnectionName += "-" + username
+	conn, err := cfg.Dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := client.Start(conn, client.Config{
+		Username: username,
+		Game:     game,
+		SaveDir:  os.TempDir(),
+		Resume:   client.ResumeNo,
+		Verify:   verify,
+		Renderer: renderer,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, c, nil
+}
+
+func waitForStop(duration time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	if duration <= 0 {
+		<-signals
+		return
+	}
+	select {
+	case <-signals:
+	case <-time.After(duration):
+	}
+}
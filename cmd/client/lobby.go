@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errLeftLobby = errors.New("left the lobby")
+
+// lobby lists and creates the games of the servers
+type lobby interface {
+	List() ([]routing.GameSummary, error)
+	Create(game routing.Game) ([]routing.GameSummary, error)
+}
+
+// serverLobby asks the servers over conn, sending createKey with created
+// games
+type serverLobby struct {
+	conn      *amqp.Connection
+	createKey string
+}
+
+func (l serverLobby) List() ([]routing.GameSummary, error) {
+	return client.ListGames(l.conn)
+}
+
+func (l serverLobby) Create(game routing.Game) ([]routing.GameSummary, error) {
+	return client.CreateGame(l.conn, game, l.createKey)
+}
+
+// chooseGame lets the player list, create and join games. Servers without
+// a lobby only run the default game, which is joined right away. createKey
+// is sent with created games
+func chooseGame(conn *amqp.Connection, createKey string) (routing.Game, error) {
+	return runLobby(serverLobby{conn: conn, createKey: createKey}, gamelogic.ReadInput)
+}
+
+// runLobby reads the player's lobby commands with read until a game is
+// joined
+func runLobby(l lobby, read func() ([]string, bool)) (routing.Game, error) {
+	games, err := l.List()
+	if err != nil {
+		fmt.Printf("Could not reach the lobby, joining the default game: %v\n", err)
+		return routing.DefaultGame, nil
+	}
+	printLobbyHelp()
+	printGames(games)
+
+	for {
+		words, ok := read()
+		if !ok {
+			return routing.DefaultGame, errLeftLobby
+		}
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "games":
+			latest, err := l.List()
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			games = latest
+			printGames(games)
+
+		case "create":
+			if len(words) != 2 {
+				fmt.Println("usage: create <game>")
+				continue
+			}
+			game, err := routing.ParseGame(words[1])
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			latest, err := l.Create(game)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			games = latest
+			fmt.Printf("Created game %s, \"join %s\" to play it\n", game, game)
+			printGames(games)
+
+		case "join":
+			if len(words) != 2 {
+				fmt.Println("usage: join <game>")
+				continue
+			}
+			game, err := routing.ParseGame(words[1])
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if !hasGame(games, game) {
+				// another player may have created it since the list was shown
+				if latest, err := l.List(); err == nil {
+					games = latest
+				}
+			}
+			if !hasGame(games, game) {
+				fmt.Printf("No such game %s, \"games\" lists the running games\n", game)
+				continue
+			}
+			return game, nil
+
+		case "help":
+			printLobbyHelp()
+
+		case "quit":
+			return routing.DefaultGame, errLeftLobby
+
+		default:
+			fmt.Println("Unknown command.")
+		}
+	}
+}
+
+// hasGame reports whether game is one of games
+func hasGame(games []routing.GameSummary, game routing.Game) bool {
+	for _, summary := range games {
+		if summary.ID == game.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func printLobbyHelp() {
+	fmt.Println("Pick a game to play:")
+	fmt.Println("* games")
+	fmt.Println("* create <game>")
+	fmt.Println("* join <game>")
+	fmt.Println("    example:")
+	fmt.Println("    join default")
+	fmt.Println("* help")
+	fmt.Println("* quit")
+}
+
+func printGames(games []routing.GameSummary) {
+	if len(games) == 0 {
+		fmt.Println("No games are running.")
+		return
+	}
+	for _, game := range games {
+		line := fmt.Sprintf("* %s: %d player(s), created %s", game.ID, game.Players, game.CreatedAt.Format(time.DateTime))
+		if game.Paused {
+			line += ", paused"
+		}
+		fmt.Println(line)
+	}
+}
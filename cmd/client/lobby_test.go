@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// fakeLobby runs the games it was given and those created through it. The
+// game named in late appears once the list was asked for once
+type fakeLobby struct {
+	games   []string
+	late    string
+	listErr error
+	lists   int
+}
+
+func (l *fakeLobby) List() ([]routing.GameSummary, error) {
+	if l.listErr != nil {
+		return nil, l.listErr
+	}
+	l.lists++
+	if l.lists > 1 && l.late != "" {
+		l.games, l.late = append(l.games, l.late), ""
+	}
+	return l.summaries(), nil
+}
+
+func (l *fakeLobby) Create(game routing.Game) ([]routing.GameSummary, error) {
+	if hasGame(l.summaries(), game) {
+		return nil, errors.New("the lobby refused: the game already exists")
+	}
+	l.games = append(l.games, game.String())
+	return l.summaries(), nil
+}
+
+func (l *fakeLobby) summaries() []routing.GameSummary {
+	var games []routing.GameSummary
+	for _, id := range l.games {
+		games = append(games, routing.GameSummary{ID: id})
+	}
+	return games
+}
+
+// script reads lines like a player typing them, and ends like stdin
+// once they run out
+func script(lines ...string) func() ([]string, bool) {
+	return func() ([]string, bool) {
+		if len(lines) == 0 {
+			return nil, false
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return strings.Fields(line), true
+	}
+}
+
+func TestRunLobby(t *testing.T) {
+	tests := []struct {
+		name    string
+		lobby   *fakeLobby
+		input   []string
+		want    routing.Game
+		wantErr error
+	}{
+		{name: "join the default game", lobby: &fakeLobby{games: []string{"default"}}, input: []string{"join default"}},
+		{name: "join a running game", lobby: &fakeLobby{games: []string{"default", "arena"}}, input: []string{"join arena"}, want: "arena"},
+		{name: "join a game that does not exist", lobby: &fakeLobby{games: []string{"default"}}, input: []string{"join arena"}, wantErr: errLeftLobby},
+		{name: "join a game that does not exist and then one that does", lobby: &fakeLobby{games: []string{"default", "arena"}}, input: []string{"join nope", "join arena"}, want: "arena"},
+		{name: "join a game created since the list", lobby: &fakeLobby{games: []string{"default"}, late: "arena"}, input: []string{"join arena"}, want: "arena"},
+		{name: "join an invalid game", lobby: &fakeLobby{games: []string{"default"}}, input: []string{"join a.b"}, wantErr: errLeftLobby},
+		{name: "join without a game", lobby: &fakeLobby{games: []string{"default"}}, input: []string{"join", "join default"}},
+		{name: "create and join", lobby: &fakeLobby{games: []string{"default"}}, input: []string{"create arena", "join arena"}, want: "arena"},
+		{name: "create an existing game", lobby: &fakeLobby{games: []string{"default", "arena"}}, input: []string{"create arena", "join arena"}, want: "arena"},
+		{name: "list and join", lobby: &fakeLobby{games: []string{"default"}, late: "arena"}, input: []string{"games", "join arena"}, want: "arena"},
+		{name: "unknown commands are ignored", lobby: &fakeLobby{games: []string{"default"}}, input: []string{"", "dance", "help", "join default"}},
+		{name: "quit", lobby: &fakeLobby{games: []string{"default", "arena"}}, input: []string{"quit", "join arena"}, wantErr: errLeftLobby},
+		{name: "end of input", lobby: &fakeLobby{games: []string{"default"}}, wantErr: errLeftLobby},
+		{name: "no lobby", lobby: &fakeLobby{listErr: errors.New("no lobby answered")}, input: []string{"join arena"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game, err := runLobby(tt.lobby, script(tt.input...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("runLobby() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && game != tt.want {
+				t.Errorf("runLobby() = %q, want %q", game, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasGame(t *testing.T) {
+	games := []routing.GameSummary{{ID: "default"}, {ID: "arena"}}
+	tests := []struct {
+		game routing.Game
+		want bool
+	}{
+		{routing.DefaultGame, true},
+		{"arena", true},
+		{"Arena", false},
+		{"other", false},
+	}
+	for _, tt := range tests {
+		if got := hasGame(games, tt.game); got != tt.want {
+			t.Errorf("hasGame(%q) = %v, want %v", tt.game, got, tt.want)
+		}
+	}
+	if hasGame(nil, routing.DefaultGame) {
+		t.Error("hasGame found a game in an empty list")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logging"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// printer writes records in one of the supported output formats
+type printer interface {
+	Print(logstore.Record) error
+	Close() error
+}
+
+type textPrinter struct{ w io.Writer }
+
+func (p textPrinter) Print(r logstore.Record) error {
+	_, err := io.WriteString(p.w, gamelogic.FormatLog(r.GameLog()))
+	return err
+}
+
+func (p textPrinter) Close() error { return nil }
+
+// jsonPrinter writes JSON Lines, the same format the store uses
+type jsonPrinter struct{ encoder *json.Encoder }
+
+func (p jsonPrinter) Print(r logstore.Record) error {
+	return p.encoder.Encode(r)
+}
+
+func (p jsonPrinter) Close() error { return nil }
+
+type csvPrinter struct{ w *csv.Writer }
+
+func (p csvPrinter) Print(r logstore.Record) error {
+	row := []string{r.Time.Format(time.RFC3339), r.Username, string(r.Event), r.Location, r.Opponent, gamelogic.RenderLog(r.GameLog())}
+	if err := p.w.Write(row); err != nil {
+		return err
+	}
+	// flush every row so -follow output shows up immediately
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func (p csvPrinter) Close() error {
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func newPrinter(format string, w io.Writer) (printer, error) {
+	switch format {
+	case "text":
+		return textPrinter{w: w}, nil
+	case "json":
+		return jsonPrinter{encoder: json.NewEncoder(w)}, nil
+	case "csv":
+		p := csvPrinter{w: csv.NewWriter(w)}
+		if err := p.w.Write([]string{"time", "username", "event", "location", "opponent", "message"}); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, use text, json or csv", format)
+}
+
+// parseTime accepts RFC3339 timestamps or a duration meaning "that long ago"
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an RFC3339 time nor a duration", value)
+}
+
+func main() {
+	storePath := flag.String("store", "game.jsonl", "game log store written by the server")
+	player := flag.String("player", "", "only show logs of this player")
+	events := flag.String("event", "", "only show these comma separated events, e.g. war_won,war_lost; \"message\" selects free text logs")
+	since := flag.String("since", "", "only show logs after this RFC3339 time or duration ago, e.g. 1h")
+	until := flag.String("until", "", "only show logs before this RFC3339 time or duration ago")
+	text := flag.String("grep", "", "only show logs whose message contains this text")
+	limit := flag.Int("n", 0, "only show the last n matching logs")
+	follow := flag.Bool("follow", false, "keep printing new matching logs as they are stored")
+	format := flag.String("format", "text", "output format: text, json or csv")
+	output := flag.String("o", "", "write to this file instead of stdout")
+	loadLogging := logging.Flags(flag.CommandLine, logging.DefaultConfig())
+	flag.Parse()
+
+	logConfig, err := loadLogging()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logging.Setup(logConfig)
+
+	query := logstore.Query{
+		Player: *player,
+		Text:   *text,
+		Limit:  *limit,
+	}
+	if *events != "" {
+		for _, event := range strings.Split(*events, ",") {
+			event = strings.TrimSpace(event)
+			if event == "message" {
+				event = string(routing.EventMessage)
+			}
+			query.Events = append(query.Events, routing.EventType(event))
+		}
+	}
+	if query.Since, err = parseTime(*since); err != nil {
+		logging.Fatal("invalid -since", "err", err)
+	}
+	if query.Until, err = parseTime(*until); err != nil {
+		logging.Fatal("invalid -until", "err", err)
+	}
+	if *follow && !query.Until.IsZero() {
+		logging.Fatal("-follow can not be combined with -until")
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			logging.Fatal("could not create output file", "err", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	p, err := newPrinter(strings.ToLower(*format), out)
+	if err != nil {
+		logging.Fatal("could not print game logs", "err", err)
+	}
+	defer p.Close()
+
+	records, err := logstore.Find(*storePath, query)
+	if err != nil {
+		logging.Fatal("could not query game logs", "err", err)
+	}
+	for _, record := range records {
+		if err := p.Print(record); err != nil {
+			logging.Fatal("could not print game log", "err", err)
+		}
+	}
+
+	if !*follow {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := logstore.Follow(ctx, *storePath, query, p.Print); err != nil {
+		logging.Fatal("could not follow game logs", "err", err)
+	}
+}
@@ -0,0 +1,347 @@
+// Command scenario plays a scripted multi-player game against RabbitMQ and
+// checks how it ended. It starts a server and one client per player in
+// this process, so run it against a broker, or at least a vhost, that no
+// other Peril server uses. With -memory it runs against a broker kept in
+// memory instead and needs no RabbitMQ at all.
+//
+// A scenario is a text file with one step per line, "#" starts a comment:
+//
+//	player alice bob               registers players
+//	alice: spawn europe infantry   runs a client command as alice
+//	expect fail bob: move asia 9   runs a command that must fail
+//	server: pause                  runs a server command, pause or resume
+//	wait 500ms                     lets messages arrive
+//	expect units bob europe:cavalry    bob has exactly these units
+//	expect log bob war_won [count]     the game log has a war_won entry of bob
+//	expect paused alice            alice's game is paused, or "running"
+//
+// Expectations are retried until -timeout passes, as messages arrive
+// asynchronously
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/broker"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/leader"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logging"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logsink"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/membroker"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/server"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	exitOK          = 0
+	exitFailed      = 1 // a step or expectation failed
+	exitUsage       = 2
+	exitUnavailable = 3 // could not connect or start the server
+)
+
+const pollInterval = 100 * time.Millisecond
+
+type runner struct {
+	broker  broker.Config
+	memory  *membroker.Broker // used instead of broker when set
+	dir     string            // holds the game logs and saves of this run
+	timeout time.Duration
+	server  *server.Server
+	conns   []*amqp.Connection
+	clients map[string]*client.Client
+}
+
+func main() {
+	timeout := flag.Duration("timeout", 5*time.Second, "how long an expectation may take to come true")
+	failFast := flag.Bool("fail-fast", false, "stop at the first step that fails")
+	keep := flag.Bool("keep", false, "keep the game logs and saves of the run instead of removing them")
+	memory := flag.Bool("memory", false, "run against a broker kept in memory instead of RabbitMQ")
+	loadBroker := broker.Flags(flag.CommandLine, broker.DefaultConfig("peril-scenario"))
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <scenario file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	logDefaults := logging.DefaultConfig()
+	// no timestamps, so the output of a run is the same every time
+	logDefaults.NoTime = true
+	loadLogging := logging.Flags(flag.CommandLine, logDefaults)
+	flag.Parse()
+
+	logConfig, err := loadLogging()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	logging.Setup(logConfig)
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	brokerConfig, err := loadBroker()
+	if err != nil {
+		fatal(exitUsage, "invalid broker configuration: %v", err)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fatal(exitUsage, "could not open scenario: %v", err)
+	}
+	steps, err := parseScenario(file)
+	file.Close()
+	if err != nil {
+		fatal(exitUsage, "invalid scenario %s: %v", flag.Arg(0), err)
+	}
+
+	dir, err := os.MkdirTemp("", "peril-scenario-")
+	if err != nil {
+		fatal(exitUnavailable, "could not create run directory: %v", err)
+	}
+	r := &runner{broker: brokerConfig, dir: dir, timeout: *timeout, clients: map[string]*client.Client{}}
+	if *memory {
+		if r.memory, err = newMemoryBroker(); err != nil {
+			fatal(exitUnavailable, "%v", err)
+		}
+	}
+	if err := r.startServer(); err != nil {
+		r.close()
+		fatal(exitUnavailable, "%v", err)
+	}
+
+	failed := 0
+	for _, s := range steps {
+		fmt.Printf("=== line %d: %s\n", s.line, s.text)
+		if err := r.run(s); err != nil {
+			failed++
+			fmt.Printf("--- FAIL line %d: %v\n", s.line, err)
+			if *failFast {
+				break
+			}
+		}
+	}
+
+	r.close()
+	if r.memory != nil {
+		r.memory.Close()
+	}
+	if *keep {
+		fmt.Printf("Game logs and saves kept in %s\n", dir)
+	} else {
+		os.RemoveAll(dir)
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL: %d of %d step(s) failed\n", failed, len(steps))
+		os.Exit(exitFailed)
+	}
+	fmt.Printf("PASS: %d step(s)\n", len(steps))
+	os.Exit(exitOK)
+}
+
+// newMemoryBroker sets up the exchanges Peril expects an operator to
+// have declared
+func newMemoryBroker() (*membroker.Broker, error) {
+	b := membroker.New()
+	exchanges := map[string]string{
+		routing.ExchangePerilDirect: membroker.Direct,
+		routing.ExchangePerilTopic:  membroker.Topic,
+		routing.ExchangeDLX:         membroker.Fanout,
+	}
+	for name, kind := range exchanges {
+		if err := b.DeclareExchange(name, kind); err != nil {
+			return nil, fmt.Errorf("could not declare exchange %s: %v", name, err)
+		}
+	}
+	return b, nil
+}
+
+func (r *runner) dial(name string) (*amqp.Connection, error) {
+	cfg := r.broker
+	cfg.ConnectionName = r.broker.ConnectionName + "-" + name
+	var conn *amqp.Connection
+	var err error
+	if r.memory != nil {
+		conn, err = r.memory.Dial(cfg.ConnectionName)
+	} else {
+		conn, err = cfg.Dial()
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.conns = append(r.conns, conn)
+	return conn, nil
+}
+
+func (r *runner) startServer() error {
+	conn, err := r.dial("server")
+	if err != nil {
+		return err
+	}
+	secret, err := session.RandomSecret()
+	if err != nil {
+		return fmt.Errorf("could not create session secret: %v", err)
+	}
+
+	sink := logsink.DefaultConfig()
+	sink.Dir = r.dir
+	// logs show up quickly, durability does not matter for a test run
+	sink.FlushInterval = pollInterval
+	sink.Fsync = false
+	r.server, err = server.Start(conn, server.Config{Sink: sink, Secret: secret, Verify: auth.PolicyReject})
+	if err != nil {
+		return fmt.Errorf("could not start the server: %v", err)
+	}
+
+	// players register with the leader and only the leader pauses, the
+	// election may take a retry when a server of an earlier run just left
+	deadline := time.Now().Add(r.timeout + leader.DefaultRetry)
+	for !r.server.Leading() {
+		if time.Now().After(deadline) {
+			return errors.New("the server did not take the lead, is another Peril server using the broker?")
+		}
+		time.Sleep(pollInterval)
+	}
+	return nil
+}
+
+func (r *runner) run(s step) error {
+	switch s.kind {
+	case stepPlayers:
+		for _, player := range s.players {
+			conn, err := r.dial(player)
+			if err != nil {
+				return err
+			}
+			c, err := client.Start(conn, client.Config{
+				Username: player,
+				SaveDir:  filepath.Join(r.dir, "saves"),
+				Resume:   client.ResumeNo,
+				Verify:   auth.PolicyReject,
+				Renderer: gamelogic.Labelled(os.Stdout, player+": "),
+			})
+			if err != nil {
+				return err
+			}
+			r.clients[player] = c
+		}
+		return nil
+
+	case stepCommand:
+		c, ok := r.clients[s.player]
+		if !ok {
+			return fmt.Errorf("player %s is not playing", s.player)
+		}
+		err := c.Run(s.words)
+		if errors.Is(err, client.ErrQuit) {
+			c.Close()
+			delete(r.clients, s.player)
+			err = nil
+		}
+		if s.fails {
+			if err == nil {
+				return errors.New("command succeeded but was expected to fail")
+			}
+			fmt.Printf("failed as expected: %v\n", err)
+			return nil
+		}
+		return err
+
+	case stepServer:
+		return r.server.SetPaused(s.words[0] == "pause")
+
+	case stepWait:
+		time.Sleep(s.wait)
+		return nil
+	}
+
+	return r.eventually(func() error { return r.check(s) })
+}
+
+// eventually retries check until it passes or the timeout runs out
+func (r *runner) eventually(check func() error) error {
+	deadline := time.Now().Add(r.timeout)
+	for {
+		err := check()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func (r *runner) check(s step) error {
+	c, ok := r.clients[s.player]
+	if !ok {
+		return fmt.Errorf("player %s is not playing", s.player)
+	}
+	save := c.State().Snapshot()
+
+	switch s.kind {
+	case stepExpectUnits:
+		units := []string{}
+		for _, unit := range save.Units {
+			units = append(units, fmt.Sprintf("%s:%s", unit.Location, unit.Rank))
+		}
+		slices.Sort(units)
+		if !slices.Equal(units, s.units) {
+			return fmt.Errorf("%s has units [%s], expected [%s]", s.player, strings.Join(units, " "), strings.Join(s.units, " "))
+		}
+
+	case stepExpectLog:
+		records, err := logstore.Find(filepath.Join(r.dir, logsink.DefaultConfig().StorePath), logstore.Query{Player: s.player})
+		if err != nil {
+			return err
+		}
+		count := 0
+		for _, record := range records {
+			if record.Event == s.event {
+				count++
+			}
+		}
+		if s.count < 0 && count == 0 {
+			return fmt.Errorf("no %q log of %s", s.event, s.player)
+		}
+		if s.count >= 0 && count != s.count {
+			return fmt.Errorf("%d %q log(s) of %s, expected %d", count, s.event, s.player, s.count)
+		}
+
+	case stepExpectPaused:
+		if save.Paused != s.isPaused {
+			return fmt.Errorf("%s paused is %v, expected %v", s.player, save.Paused, s.isPaused)
+		}
+	}
+	return nil
+}
+
+// close leaves the game with every player and stops the server
+func (r *runner) close() {
+	for _, c := range r.clients {
+		c.Close()
+	}
+	if r.server != nil {
+		if err := r.server.Close(); err != nil {
+			slog.Error("could not flush game logs", "err", err)
+		}
+	}
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+}
+
+func fatal(code int, format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(code)
+}
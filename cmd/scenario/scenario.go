@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+type stepKind int
+
+const (
+	stepPlayers stepKind = iota
+	stepCommand
+	stepServer
+	stepWait
+	stepExpectUnits
+	stepExpectLog
+	stepExpectPaused
+)
+
+// step is one line of a scenario
+type step struct {
+	line     int
+	text     string
+	kind     stepKind
+	players  []string // stepPlayers
+	player   string
+	words    []string      // stepCommand and stepServer
+	fails    bool          // the command is expected to fail
+	wait     time.Duration // stepWait
+	units    []string      // stepExpectUnits, sorted location:rank pairs
+	event    routing.EventType
+	count    int  // stepExpectLog, -1 for at least one
+	isPaused bool // stepExpectPaused
+}
+
+var serverCommands = []string{"pause", "resume"}
+
+var events = map[string]routing.EventType{
+	"message":  routing.EventMessage,
+	"war_won":  routing.EventWarWon,
+	"war_lost": routing.EventWarLost,
+	"war_draw": routing.EventWarDraw,
+	"spawn":    routing.EventSpawn,
+	"move":     routing.EventMove,
+	"join":     routing.EventJoin,
+	"leave":    routing.EventLeave,
+	"pause":    routing.EventPause,
+	"resume":   routing.EventResume,
+	"admin":    routing.EventAdmin,
+}
+
+// parseScenario reads a whole scenario, so mistakes are reported before
+// anything is started
+func parseScenario(r io.Reader) ([]step, error) {
+	steps := []step{}
+	players := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		s, err := parseStep(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		s.line = lineNumber
+
+		if s.kind == stepPlayers {
+			for _, player := range s.players {
+				if players[player] {
+					return nil, fmt.Errorf("line %d: player %s was already added", lineNumber, player)
+				}
+				players[player] = true
+			}
+		} else if s.player != "" && !players[s.player] {
+			return nil, fmt.Errorf("line %d: unknown player %s, add it with \"player %s\" first", lineNumber, s.player, s.player)
+		}
+		steps = append(steps, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read scenario: %v", err)
+	}
+	return steps, nil
+}
+
+func parseStep(text string) (step, error) {
+	s := step{text: text}
+
+	if command, ok := strings.CutPrefix(text, "expect fail "); ok {
+		s, err := parseCommand(s, command)
+		s.fails = true
+		return s, err
+	}
+	// commands look like "alice: spawn europe infantry"
+	if head, _, ok := strings.Cut(text, ":"); ok && !strings.ContainsAny(strings.TrimSpace(head), " \t") {
+		return parseCommand(s, text)
+	}
+
+	words := strings.Fields(text)
+	switch words[0] {
+	case "player":
+		if len(words) < 2 {
+			return s, errors.New("usage: player <name> [name...]")
+		}
+		s.kind = stepPlayers
+		s.players = words[1:]
+		return s, nil
+
+	case "wait":
+		if len(words) != 2 {
+			return s, errors.New("usage: wait <duration>")
+		}
+		d, err := time.ParseDuration(words[1])
+		if err != nil || d < 0 {
+			return s, fmt.Errorf("%s is not a valid duration", words[1])
+		}
+		s.kind = stepWait
+		s.wait = d
+		return s, nil
+
+	case "expect":
+		return parseExpectation(s, words[1:])
+	}
+	return s, fmt.Errorf("unknown step %q", words[0])
+}
+
+func parseCommand(s step, text string) (step, error) {
+	head, command, ok := strings.Cut(text, ":")
+	if !ok {
+		return s, errors.New("usage: <player>: <command> or server: <command>")
+	}
+	s.words = strings.Fields(command)
+	if len(s.words) == 0 {
+		return s, errors.New("missing command")
+	}
+
+	head = strings.TrimSpace(head)
+	if head == "server" {
+		if !slices.Contains(serverCommands, s.words[0]) {
+			return s, fmt.Errorf("unknown server command %s, use %s", s.words[0], strings.Join(serverCommands, " or "))
+		}
+		s.kind = stepServer
+		return s, nil
+	}
+	s.kind = stepCommand
+	s.player = head
+	return s, nil
+}
+
+func parseExpectation(s step, words []string) (step, error) {
+	if len(words) < 2 {
+		return s, errors.New("usage: expect units|log|paused <player> ...")
+	}
+	s.player = words[1]
+
+	switch words[0] {
+	case "units":
+		s.kind = stepExpectUnits
+		s.units = append([]string{}, words[2:]...)
+		for _, unit := range s.units {
+			if location, rank, ok := strings.Cut(unit, ":"); !ok || location == "" || rank == "" {
+				return s, fmt.Errorf("unit %s is not <location>:<rank>", unit)
+			}
+		}
+		slices.Sort(s.units)
+		return s, nil
+
+	case "log":
+		if len(words) < 3 || len(words) > 4 {
+			return s, errors.New("usage: expect log <player> <event> [count]")
+		}
+		event, ok := events[words[2]]
+		if !ok {
+			return s, fmt.Errorf("unknown event %s", words[2])
+		}
+		s.kind = stepExpectLog
+		s.event = event
+		s.count = -1
+		if len(words) == 4 {
+			count, err := strconv.Atoi(words[3])
+			if err != nil || count < 0 {
+				return s, fmt.Errorf("%s is not a valid count", words[3])
+			}
+			s.count = count
+		}
+		return s, nil
+
+	case "paused", "running":
+		if len(words) != 2 {
+			return s, fmt.Errorf("usage: expect %s <player>", words[0])
+		}
+		s.kind = stepExpectPaused
+		s.isPaused = words[0] == "paused"
+		return s, nil
+	}
+	return s, fmt.Errorf("unknown expectation %s", words[0])
+}
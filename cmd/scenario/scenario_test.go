@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func TestParseStep(t *testing.T) {
+	tests := []struct {
+		text string
+		want step
+	}{
+		{"player alice bob", step{kind: stepPlayers, players: []string{"alice", "bob"}}},
+		{"alice: spawn europe infantry", step{kind: stepCommand, player: "alice", words: []string{"spawn", "europe", "infantry"}}},
+		{"expect fail bob: move asia 9", step{kind: stepCommand, player: "bob", words: []string{"move", "asia", "9"}, fails: true}},
+		{"server: pause", step{kind: stepServer, words: []string{"pause"}}},
+		{"server:   resume  ", step{kind: stepServer, words: []string{"resume"}}},
+		{"wait 500ms", step{kind: stepWait, wait: 500 * time.Millisecond}},
+		{"expect units bob europe:cavalry asia:artillery", step{kind: stepExpectUnits, player: "bob", units: []string{"asia:artillery", "europe:cavalry"}}},
+		{"expect units bob", step{kind: stepExpectUnits, player: "bob", units: []string{}}},
+		{"expect log bob war_won", step{kind: stepExpectLog, player: "bob", event: routing.EventWarWon, count: -1}},
+		{"expect log bob war_lost 0", step{kind: stepExpectLog, player: "bob", event: routing.EventWarLost, count: 0}},
+		{"expect paused alice", step{kind: stepExpectPaused, player: "alice", isPaused: true}},
+		{"expect running alice", step{kind: stepExpectPaused, player: "alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseStep(tt.text)
+			if err != nil {
+				t.Fatalf("parseStep: %v", err)
+			}
+			tt.want.text = tt.text
+			if !equalSteps(got, tt.want) {
+				t.Errorf("parseStep = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStepErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"player", "usage: player"},
+		{"wait", "usage: wait"},
+		{"wait soon", "not a valid duration"},
+		{"wait -1s", "not a valid duration"},
+		{"alice:", "missing command"},
+		{"server: reboot", "unknown server command reboot"},
+		{"expect units", "usage: expect"},
+		{"expect units bob europe", "is not <location>:<rank>"},
+		{"expect units bob :cavalry", "is not <location>:<rank>"},
+		{"expect log bob", "usage: expect log"},
+		{"expect log bob war_won 1 2", "usage: expect log"},
+		{"expect log bob victory", "unknown event victory"},
+		{"expect log bob war_won many", "not a valid count"},
+		{"expect log bob war_won -1", "not a valid count"},
+		{"expect paused alice bob", "usage: expect paused"},
+		{"expect winner alice", "unknown expectation winner"},
+		{"dance alice", "unknown step"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			_, err := parseStep(tt.text)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseStep error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScenario(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		lines   []int
+		wantErr string
+	}{
+		{
+			name:  "comments and blank lines are skipped",
+			input: "# setup\nplayer alice\n\n  alice: status\n",
+			lines: []int{2, 4},
+		},
+		{
+			name:    "player must be added first",
+			input:   "alice: status\n",
+			wantErr: "line 1: unknown player alice",
+		},
+		{
+			name:    "expectation of an unknown player",
+			input:   "player alice\nexpect paused bob\n",
+			wantErr: "line 2: unknown player bob",
+		},
+		{
+			name:    "player added twice",
+			input:   "player alice\nplayer bob alice\n",
+			wantErr: "line 2: player alice was already added",
+		},
+		{
+			name:    "invalid step names its line",
+			input:   "player alice\n\nwait forever\n",
+			wantErr: "line 3:",
+		},
+		{
+			name:  "server steps need no player",
+			input: "server: pause\nserver: resume\n",
+			lines: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := parseScenario(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseScenario error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseScenario: %v", err)
+			}
+			lines := []int{}
+			for _, s := range steps {
+				lines = append(lines, s.line)
+			}
+			if !slices.Equal(lines, tt.lines) {
+				t.Errorf("steps on lines %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+// TestScenarios plays the bundled scenarios against the memory broker
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("plays whole games")
+	}
+	files, err := os.ReadDir("../../scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(file.Name(), func(t *testing.T) {
+			f, err := os.Open("../../scenarios/" + file.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			steps, err := parseScenario(f)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			memory, err := newMemoryBroker()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer memory.Close()
+			r := &runner{memory: memory, dir: t.TempDir(), timeout: 5 * time.Second, clients: map[string]*client.Client{}}
+			defer r.close()
+			if err := r.startServer(); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range steps {
+				if err := r.run(s); err != nil {
+					t.Errorf("line %d %q: %v", s.line, s.text, err)
+				}
+			}
+		})
+	}
+}
+
+func equalSteps(a, b step) bool {
+	return a.text == b.text && a.kind == b.kind && slices.Equal(a.players, b.players) &&
+		a.player == b.player && slices.Equal(a.words, b.words) && a.fails == b.fails &&
+		a.wait == b.wait && slices.Equal(a.units, b.units) && a.event == b.event &&
+		a.count == b.count && a.isPaused == b.isPaused
+}
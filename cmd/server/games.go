@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/server"
+)
+
+// parseGames reads the -games flag
+func parseGames(value string) ([]routing.Game, error) {
+	var games []routing.Game
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		game, err := routing.ParseGame(id)
+		if err != nil {
+			return nil, err
+		}
+		if game == routing.DefaultGame {
+			return nil, errors.New("the default game is always started")
+		}
+		games = append(games, game)
+	}
+	return games, nil
+}
+
+// printGames marks the game the commands act on and the games this server
+// leads
+func printGames(lobby *server.Lobby, current routing.Game) {
+	for _, game := range lobby.Games() {
+		marker := " "
+		if game.ID == current.String() {
+			marker = "*"
+		}
+		line := fmt.Sprintf("%s %s: %d player(s), created %s", marker, game.ID, game.Players, game.CreatedAt.Format(time.DateTime))
+		if game.Paused {
+			line += ", paused"
+		}
+		if id, err := routing.ParseGame(game.ID); err == nil {
+			if srv, ok := lobby.Game(id); ok && srv.Leading() {
+				line += ", leading"
+			}
+		}
+		fmt.Println(line)
+	}
+}
+
+func commandCreate(lobby *server.Lobby, words []string) error {
+	if len(words) != 2 {
+		return errors.New("usage: create <game>")
+	}
+	game, err := routing.ParseGame(words[1])
+	if err != nil {
+		return err
+	}
+	if _, err := lobby.Create(game); err != nil {
+		return err
+	}
+	fmt.Printf("Created game %s, \"use %s\" to manage it\n", game, game)
+	return nil
+}
+
+// commandUse picks the game the other commands act on
+func commandUse(lobby *server.Lobby, words []string) (*server.Server, error) {
+	if len(words) != 2 {
+		return nil, errors.New("usage: use <game>")
+	}
+	game, err := routing.ParseGame(words[1])
+	if err != nil {
+		return nil, err
+	}
+	srv, ok := lobby.Game(game)
+	if !ok {
+		return nil, fmt.Errorf("there is no game %s", game)
+	}
+	fmt.Printf("Managing game %s\n", game)
+	return srv, nil
+}
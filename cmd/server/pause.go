@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/server"
+)
+
+const maintenanceInterval = 24 * time.Hour
+
+// commandPause handles "pause", "pause <duration>" and
+// "pause at <time> [for <duration>] [every <duration>]"
+func commandPause(srv *server.Server, words []string) error {
+	cmd, err := parsePause(words, time.Now())
+	if err != nil {
+		return err
+	}
+	switch {
+	case cmd.Schedule != nil:
+		scheduled, err := srv.Schedule(*cmd.Schedule)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Scheduled pause %d\n", scheduled.ID)
+		printSchedule(scheduled)
+		return nil
+
+	case cmd.For > 0:
+		slog.Info("sending pause message", "source", "console", "duration", cmd.For)
+		return srv.PauseFor(cmd.For)
+	}
+	slog.Info("sending pause message", "source", "console")
+	return srv.SetPaused(true)
+}
+
+// pauseCommand is what a pause command asks for, a pause until resumed
+// when neither field is set
+type pauseCommand struct {
+	For      time.Duration
+	Schedule *server.PauseSchedule
+}
+
+func parsePause(words []string, now time.Time) (pauseCommand, error) {
+	switch {
+	case len(words) == 1:
+		return pauseCommand{}, nil
+
+	case len(words) == 2 && words[1] != "at":
+		d, err := time.ParseDuration(words[1])
+		if err != nil {
+			return pauseCommand{}, fmt.Errorf("invalid duration %q: %v", words[1], err)
+		}
+		if d <= 0 {
+			return pauseCommand{}, fmt.Errorf("invalid duration %q, a pause must last longer than 0s", words[1])
+		}
+		return pauseCommand{For: d}, nil
+
+	case len(words) > 1 && words[1] == "at":
+		p, err := parseSchedule(words[2:], now)
+		if err != nil {
+			return pauseCommand{}, err
+		}
+		return pauseCommand{Schedule: &p}, nil
+	}
+	return pauseCommand{}, errors.New("usage: pause [<duration>] or pause at <time> [for <duration>] [every <duration>]")
+}
+
+// parseSchedule reads "<time> [for <duration>] [every <duration>]"
+func parseSchedule(words []string, now time.Time) (server.PauseSchedule, error) {
+	if len(words) == 0 {
+		return server.PauseSchedule{}, errors.New("a scheduled pause needs a start time")
+	}
+	at, err := parseClock(words[0], now)
+	if err != nil {
+		return server.PauseSchedule{}, err
+	}
+	p := server.PauseSchedule{At: at}
+	rest := words[1:]
+	for len(rest) > 0 {
+		if len(rest) < 2 {
+			return p, fmt.Errorf("%q needs a duration", rest[0])
+		}
+		d, err := time.ParseDuration(rest[1])
+		if err != nil {
+			return p, fmt.Errorf("invalid duration %q: %v", rest[1], err)
+		}
+		switch rest[0] {
+		case "for":
+			p.For = d
+		case "every":
+			p.Every = d
+		default:
+			return p, fmt.Errorf("unknown option %q, expected for or every", rest[0])
+		}
+		rest = rest[2:]
+	}
+	return p, nil
+}
+
+// parseClock reads a time of day like 18:00, the next time it comes, or an
+// RFC 3339 time
+func parseClock(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"15:04", time.TimeOnly} {
+		clock, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected e.g. 18:00 or an RFC 3339 time", value)
+}
+
+// parseMaintenance reads the -maintenance flag, comma separated daily
+// windows like 03:00/30m
+func parseMaintenance(value string, now time.Time) ([]server.PauseSchedule, error) {
+	var windows []server.PauseSchedule
+	for _, window := range strings.Split(value, ",") {
+		window = strings.TrimSpace(window)
+		if window == "" {
+			continue
+		}
+		start, length, ok := strings.Cut(window, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid maintenance window %q, expected e.g. 03:00/30m", window)
+		}
+		at, err := parseClock(start, now)
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(length)
+		if err != nil {
+			return nil, fmt.Errorf("invalid length of maintenance window %q: %v", window, err)
+		}
+		if d <= 0 || d >= maintenanceInterval {
+			return nil, fmt.Errorf("invalid length of maintenance window %q, it must be between 0s and %v", window, maintenanceInterval)
+		}
+		windows = append(windows, server.PauseSchedule{At: at, For: d, Every: maintenanceInterval})
+	}
+	return windows, nil
+}
+
+func commandSchedule(srv *server.Server) {
+	pauses := srv.Schedules()
+	if len(pauses) == 0 {
+		fmt.Println("No pauses are scheduled.")
+		return
+	}
+	for _, p := range pauses {
+		printSchedule(p)
+	}
+}
+
+func printSchedule(p server.ScheduledPause) {
+	line := fmt.Sprintf("* %d: %s", p.ID, p.At.Format(time.DateTime))
+	if p.For > 0 {
+		line += fmt.Sprintf(" for %v", p.For)
+	} else {
+		line += " until resumed"
+	}
+	if p.Every > 0 {
+		line += fmt.Sprintf(", every %v", p.Every)
+	}
+	fmt.Println(line)
+}
+
+func commandUnschedule(srv *server.Server, words []string) error {
+	if len(words) != 2 {
+		return errors.New("usage: unschedule <id>")
+	}
+	id, err := strconv.Atoi(words[1])
+	if err != nil {
+		return fmt.Errorf("invalid id %q", words[1])
+	}
+	if err := srv.Unschedule(id); errors.Is(err, server.ErrNoSchedule) {
+		return fmt.Errorf("no pause %d is scheduled", id)
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("Cancelled pause %d\n", id)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/server"
+)
+
+// testNow is 2024-05-10 12:00 local time, the clock the tests parse against
+var testNow = time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+
+func onDay(day, hour, min int) time.Time {
+	return time.Date(2024, 5, day, hour, min, 0, 0, time.Local)
+}
+
+func TestParsePause(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    pauseCommand
+		wantErr bool
+	}{
+		{name: "until resumed", command: "pause"},
+		{name: "for a duration", command: "pause 30s", want: pauseCommand{For: 30 * time.Second}},
+		{name: "at a later time today", command: "pause at 18:00", want: pauseCommand{Schedule: &server.PauseSchedule{At: onDay(10, 18, 0)}}},
+		{name: "at a time passed today", command: "pause at 09:30", want: pauseCommand{Schedule: &server.PauseSchedule{At: onDay(11, 9, 30)}}},
+		{name: "at now", command: "pause at 12:00", want: pauseCommand{Schedule: &server.PauseSchedule{At: onDay(11, 12, 0)}}},
+		{name: "at with seconds", command: "pause at 18:00:30", want: pauseCommand{Schedule: &server.PauseSchedule{At: onDay(10, 18, 0).Add(30 * time.Second)}}},
+		{name: "at an RFC 3339 time", command: "pause at 2024-06-01T08:00:00Z", want: pauseCommand{Schedule: &server.PauseSchedule{At: time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)}}},
+		{name: "at for every", command: "pause at 18:00 for 10m every 1h", want: pauseCommand{Schedule: &server.PauseSchedule{At: onDay(10, 18, 0), For: 10 * time.Minute, Every: time.Hour}}},
+		{name: "duration not a duration", command: "pause soon", wantErr: true},
+		{name: "duration zero", command: "pause 0s", wantErr: true},
+		{name: "duration negative", command: "pause -5m", wantErr: true},
+		{name: "at without a time", command: "pause at", wantErr: true},
+		{name: "at not a time", command: "pause at noon", wantErr: true},
+		{name: "at out of range", command: "pause at 25:00", wantErr: true},
+		{name: "for without a duration", command: "pause at 18:00 for", wantErr: true},
+		{name: "for not a duration", command: "pause at 18:00 for ever", wantErr: true},
+		{name: "unknown option", command: "pause at 18:00 until 19:00", wantErr: true},
+		{name: "too many words", command: "pause 30s now", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePause(strings.Fields(tt.command), testNow)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePause(%q) = %+v, want an error", tt.command, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePause(%q): %v", tt.command, err)
+			}
+			if got.For != tt.want.For || (got.Schedule == nil) != (tt.want.Schedule == nil) {
+				t.Fatalf("parsePause(%q) = %+v, want %+v", tt.command, got, tt.want)
+			}
+			if got.Schedule != nil && !sameSchedule(*got.Schedule, *tt.want.Schedule) {
+				t.Errorf("parsePause(%q) schedules %+v, want %+v", tt.command, *got.Schedule, *tt.want.Schedule)
+			}
+		})
+	}
+}
+
+func TestParseMaintenance(t *testing.T) {
+	daily := func(start time.Time, d time.Duration) server.PauseSchedule {
+		return server.PauseSchedule{At: start, For: d, Every: maintenanceInterval}
+	}
+	tests := []struct {
+		name    string
+		value   string
+		now     time.Time
+		want    []server.PauseSchedule
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "later today", value: "18:00/30m", now: testNow, want: []server.PauseSchedule{daily(onDay(10, 18, 0), 30*time.Minute)}},
+		{name: "passed today", value: "03:00/30m", now: testNow, want: []server.PauseSchedule{daily(onDay(11, 3, 0), 30*time.Minute)}},
+		// the window in progress is paused by the leader, see
+		// server.currentWindow
+		{name: "inside the window", value: "03:00/30m", now: onDay(10, 3, 10), want: []server.PauseSchedule{daily(onDay(11, 3, 0), 30*time.Minute)}},
+		{name: "several", value: "03:00/30m, 15:00/1h,", now: testNow, want: []server.PauseSchedule{
+			daily(onDay(11, 3, 0), 30*time.Minute),
+			daily(onDay(10, 15, 0), time.Hour),
+		}},
+		{name: "no length", value: "03:00", now: testNow, wantErr: true},
+		{name: "length not a duration", value: "03:00/half", now: testNow, wantErr: true},
+		{name: "length zero", value: "03:00/0s", now: testNow, wantErr: true},
+		{name: "length negative", value: "03:00/-30m", now: testNow, wantErr: true},
+		{name: "length a whole day", value: "03:00/24h", now: testNow, wantErr: true},
+		{name: "start not a time", value: "3am/30m", now: testNow, wantErr: true},
+		{name: "one of several invalid", value: "03:00/30m,15:00", now: testNow, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMaintenance(tt.value, tt.now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseMaintenance(%q) = %+v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMaintenance(%q): %v", tt.value, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseMaintenance(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+			for i := range got {
+				if !sameSchedule(got[i], tt.want[i]) {
+					t.Errorf("window %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func sameSchedule(a, b server.PauseSchedule) bool {
+	return a.At.Equal(b.At) && a.For == b.For && a.Every == b.Every
+}
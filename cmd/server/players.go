@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/server"
+)
+
+// adminCommands are the console commands targeted at one player
+var adminCommands = map[string]routing.AdminAction{
+	"kick":          routing.AdminKick,
+	"mute":          routing.AdminMute,
+	"unmute":        routing.AdminUnmute,
+	"grant":         routing.AdminGrantUnits,
+	"remove":        routing.AdminRemoveUnits,
+	"pause-player":  routing.AdminPausePlayer,
+	"resume-player": routing.AdminResumePlayer,
+}
+
+func commandAdmin(srv *server.Server, words []string) error {
+	username, cmd, err := parseAdmin(words, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := srv.SendAdmin(username, cmd); err != nil {
+		return fmt.Errorf("%s: %v", username, err)
+	}
+	fmt.Printf("%s was %s\n", username, gamelogic.DescribeAdmin(cmd))
+	return nil
+}
+
+// parseAdmin reads one of
+//
+//	kick <player> [<reason>]
+//	mute <player> [<duration>] [<reason>]
+//	unmute <player>
+//	grant <player> <location> <rank> [<count>]
+//	remove <player> <unitID>...
+//	pause-player <player> [<duration>] [<reason>]
+//	resume-player <player>
+func parseAdmin(words []string, now time.Time) (string, routing.AdminCommand, error) {
+	action, ok := adminCommands[words[0]]
+	if !ok {
+		return "", routing.AdminCommand{}, fmt.Errorf("unknown command %s", words[0])
+	}
+	if len(words) < 2 {
+		return "", routing.AdminCommand{}, fmt.Errorf("usage: %s <player> ...", words[0])
+	}
+	username, args := words[1], words[2:]
+	cmd := routing.AdminCommand{Action: action}
+
+	switch action {
+	case routing.AdminKick:
+		cmd.Reason = strings.Join(args, " ")
+
+	case routing.AdminUnmute, routing.AdminResumePlayer:
+		if len(args) > 0 {
+			return "", cmd, fmt.Errorf("usage: %s <player>", words[0])
+		}
+
+	case routing.AdminMute, routing.AdminPausePlayer:
+		if len(args) > 0 {
+			if d, err := time.ParseDuration(args[0]); err == nil {
+				cmd.Until = now.Add(d)
+				args = args[1:]
+			}
+		}
+		cmd.Reason = strings.Join(args, " ")
+
+	case routing.AdminGrantUnits:
+		if len(args) != 2 && len(args) != 3 {
+			return "", cmd, errors.New("usage: grant <player> <location> <rank> [<count>]")
+		}
+		cmd.Location, cmd.Rank, cmd.Count = args[0], args[1], 1
+		if len(args) == 3 {
+			count, err := strconv.Atoi(args[2])
+			if err != nil {
+				return "", cmd, fmt.Errorf("invalid count %q", args[2])
+			}
+			cmd.Count = count
+		}
+
+	case routing.AdminRemoveUnits:
+		if len(args) == 0 {
+			return "", cmd, errors.New("usage: remove <player> <unitID>...")
+		}
+		for _, arg := range args {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				return "", cmd, fmt.Errorf("invalid unit id %q", arg)
+			}
+			cmd.UnitIDs = append(cmd.UnitIDs, id)
+		}
+	}
+	return username, cmd, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func TestParseAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    routing.AdminCommand
+		wantErr bool
+	}{
+		{name: "kick", command: "kick alice", want: routing.AdminCommand{Action: routing.AdminKick}},
+		{name: "kick with a reason", command: "kick alice spamming moves", want: routing.AdminCommand{Action: routing.AdminKick, Reason: "spamming moves"}},
+		{name: "mute until unmuted", command: "mute alice", want: routing.AdminCommand{Action: routing.AdminMute}},
+		{name: "mute for a duration", command: "mute alice 10m", want: routing.AdminCommand{Action: routing.AdminMute, Until: testNow.Add(10 * time.Minute)}},
+		{name: "mute with a duration and reason", command: "mute alice 1h be nice", want: routing.AdminCommand{Action: routing.AdminMute, Until: testNow.Add(time.Hour), Reason: "be nice"}},
+		{name: "mute with only a reason", command: "mute alice be nice", want: routing.AdminCommand{Action: routing.AdminMute, Reason: "be nice"}},
+		{name: "unmute", command: "unmute alice", want: routing.AdminCommand{Action: routing.AdminUnmute}},
+		{name: "grant one", command: "grant alice europe infantry", want: routing.AdminCommand{Action: routing.AdminGrantUnits, Location: "europe", Rank: "infantry", Count: 1}},
+		{name: "grant several", command: "grant alice asia artillery 3", want: routing.AdminCommand{Action: routing.AdminGrantUnits, Location: "asia", Rank: "artillery", Count: 3}},
+		{name: "remove", command: "remove alice 4", want: routing.AdminCommand{Action: routing.AdminRemoveUnits, UnitIDs: []int{4}}},
+		{name: "remove several", command: "remove alice 1 2 7", want: routing.AdminCommand{Action: routing.AdminRemoveUnits, UnitIDs: []int{1, 2, 7}}},
+		{name: "pause player", command: "pause-player alice", want: routing.AdminCommand{Action: routing.AdminPausePlayer}},
+		{name: "pause player for a duration", command: "pause-player alice 30s afk", want: routing.AdminCommand{Action: routing.AdminPausePlayer, Until: testNow.Add(30 * time.Second), Reason: "afk"}},
+		{name: "resume player", command: "resume-player alice", want: routing.AdminCommand{Action: routing.AdminResumePlayer}},
+		{name: "unknown command", command: "ban alice", wantErr: true},
+		{name: "no player", command: "kick", wantErr: true},
+		{name: "unmute with extra words", command: "unmute alice now", wantErr: true},
+		{name: "resume player with extra words", command: "resume-player alice now", wantErr: true},
+		{name: "grant without a rank", command: "grant alice europe", wantErr: true},
+		{name: "grant with too many words", command: "grant alice europe infantry 2 more", wantErr: true},
+		{name: "grant count not a number", command: "grant alice europe infantry two", wantErr: true},
+		{name: "remove without units", command: "remove alice", wantErr: true},
+		{name: "remove id not a number", command: "remove alice 1 two", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, got, err := parseAdmin(strings.Fields(tt.command), testNow)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAdmin(%q) = %+v, want an error", tt.command, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAdmin(%q): %v", tt.command, err)
+			}
+			if username != "alice" {
+				t.Errorf("username = %q, want alice", username)
+			}
+			if got.Action != tt.want.Action || got.Reason != tt.want.Reason || !got.Until.Equal(tt.want.Until) ||
+				got.Location != tt.want.Location || got.Rank != tt.want.Rank || got.Count != tt.want.Count ||
+				!slices.Equal(got.UnitIDs, tt.want.UnitIDs) {
+				t.Errorf("parseAdmin(%q) = %+v, want %+v", tt.command, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Package admin is the HTTP API operators use to control a game server
+// without its terminal. Every endpoint but the health check needs the
+// admin token as a bearer token.
+//
+// Endpoints below /api act on the default game, the same endpoints below
+// /api/games/<game> act on another game of the lobby
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/server"
+)
+
+const defaultLogLimit = 100
+
+// Game is the part of the server the API controls
+type Game interface {
+	SetPaused(paused bool) error
+	PauseFor(d time.Duration) error
+	PlayingState() routing.PlayingState
+	Players() []gamelogic.PlayerInfo
+	FindLogs(q logstore.Query) ([]logstore.Record, error)
+	Health() server.Health
+	SendAdmin(username string, cmd routing.AdminCommand) error
+}
+
+// Games finds a running game, e.g. in the lobby
+type Games func(game routing.Game) (Game, bool)
+
+type api struct {
+	games Games
+	token []byte
+}
+
+// gameHandler serves a request for the game it names
+type gameHandler func(w http.ResponseWriter, r *http.Request, game Game)
+
+// Handler serves the API for the games found by games. It refuses to work
+// without a token
+func Handler(games Games, token string) (http.Handler, error) {
+	if token == "" {
+		return nil, errors.New("an admin token is required")
+	}
+	a := &api{games: games, token: []byte(token)}
+
+	mux := http.NewServeMux()
+	for _, prefix := range []string{"/api", "/api/games/{game}"} {
+		mux.Handle("GET "+prefix+"/health", a.inGame(a.health))
+		mux.Handle("GET "+prefix+"/state", a.authorized(a.inGame(a.state)))
+		mux.Handle("POST "+prefix+"/pause", a.authorized(a.inGame(a.setPaused(true))))
+		mux.Handle("POST "+prefix+"/resume", a.authorized(a.inGame(a.setPaused(false))))
+		mux.Handle("GET "+prefix+"/players", a.authorized(a.inGame(a.players)))
+		mux.Handle("POST "+prefix+"/players/{username}/commands", a.authorized(a.inGame(a.command)))
+		mux.Handle("GET "+prefix+"/logs", a.authorized(a.inGame(a.logs)))
+	}
+	return mux, nil
+}
+
+func (a *api) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="peril"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inGame hands next the game named by the path, the default game when
+// the path names none
+func (a *api) inGame(next gameHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := routing.ParseGame(r.PathValue("game"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		game, ok := a.games(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no such game %s", id))
+			return
+		}
+		next(w, r, game)
+	})
+}
+
+type healthResponse struct {
+	Status          string `json:"status"`
+	BrokerConnected bool   `json:"broker_connected"`
+	PendingLogs     int    `json:"pending_logs"`
+	Leader          bool   `json:"leader"`
+}
+
+func (a *api) health(w http.ResponseWriter, r *http.Request, game Game) {
+	health := game.Health()
+	resp := healthResponse{Status: "ok", BrokerConnected: health.BrokerConnected, PendingLogs: health.PendingLogs, Leader: health.Leader}
+	status := http.StatusOK
+	if !health.BrokerConnected {
+		resp.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+type stateResponse struct {
+	Paused   bool       `json:"paused"`
+	ResumeAt *time.Time `json:"resume_at,omitempty"`
+}
+
+func (a *api) state(w http.ResponseWriter, r *http.Request, game Game) {
+	state := game.PlayingState()
+	resp := stateResponse{Paused: state.IsPaused}
+	if !state.ResumeAt.IsZero() {
+		resp.ResumeAt = &state.ResumeAt
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// setPaused pauses or resumes the game. A pause with the for parameter,
+// e.g. for=30s, ends by itself
+func (a *api) setPaused(paused bool) gameHandler {
+	return func(w http.ResponseWriter, r *http.Request, game Game) {
+		var err error
+		if value := r.URL.Query().Get("for"); paused && value != "" {
+			d, parseErr := time.ParseDuration(value)
+			if parseErr != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, errors.New("for must be a positive duration, e.g. 30s"))
+				return
+			}
+			slog.Info("sending pause message", "source", "admin API", "duration", d)
+			err = game.PauseFor(d)
+		} else if paused {
+			slog.Info("sending pause message", "source", "admin API")
+			err = game.SetPaused(true)
+		} else {
+			slog.Info("sending resume message", "source", "admin API")
+			err = game.SetPaused(false)
+		}
+		if errors.Is(err, server.ErrNotLeader) {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		a.state(w, r, game)
+	}
+}
+
+type playerResponse struct {
+	Username string    `json:"username"`
+	Units    int       `json:"units"`
+	Power    int       `json:"power"`
+	JoinedAt time.Time `json:"joined_at"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+func (a *api) players(w http.ResponseWriter, r *http.Request, game Game) {
+	players := []playerResponse{}
+	for _, info := range game.Players() {
+		players = append(players, playerResponse{
+			Username: info.Player.Username,
+			Units:    len(info.Player.Units),
+			Power:    gamelogic.PowerLevel(info.Player),
+			JoinedAt: info.JoinedAt,
+			LastSeen: info.LastSeen,
+		})
+	}
+	writeJSON(w, http.StatusOK, players)
+}
+
+type commandRequest struct {
+	Action   routing.AdminAction `json:"action"`
+	Reason   string              `json:"reason"`
+	For      string              `json:"for"` // length of a mute or pause, e.g. 10m
+	Location string              `json:"location"`
+	Rank     string              `json:"rank"`
+	Count    int                 `json:"count"`
+	UnitIDs  []int               `json:"unit_ids"`
+}
+
+// command sends an admin command to one player, e.g.
+// {"action":"mute","for":"10m","reason":"spamming moves"}
+func (a *api) command(w http.ResponseWriter, r *http.Request, game Game) {
+	var req commandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("the body must be a JSON command"))
+		return
+	}
+	cmd := routing.AdminCommand{
+		Action:   req.Action,
+		Reason:   req.Reason,
+		Location: req.Location,
+		Rank:     req.Rank,
+		Count:    req.Count,
+		UnitIDs:  req.UnitIDs,
+	}
+	if req.For != "" {
+		d, err := time.ParseDuration(req.For)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("for must be a positive duration, e.g. 10m"))
+			return
+		}
+		cmd.Until = time.Now().Add(d)
+	}
+	if err := gamelogic.ValidateAdmin(cmd); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	username := r.PathValue("username")
+	err := game.SendAdmin(username, cmd)
+	if errors.Is(err, server.ErrNotPlaying) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, server.ErrNotLeader) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, statusResponse{Status: username + " was " + gamelogic.DescribeAdmin(cmd)})
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// logs returns the most recent game logs, filtered like cmd/logs with the
+// player, event, since, until, text and limit parameters
+func (a *api) logs(w http.ResponseWriter, r *http.Request, game Game) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	records, err := game.FindLogs(q)
+	if errors.Is(err, server.ErrNoLogStore) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if records == nil {
+		records = []logstore.Record{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+func parseQuery(r *http.Request) (logstore.Query, error) {
+	params := r.URL.Query()
+	q := logstore.Query{
+		Player: params.Get("player"),
+		Text:   params.Get("text"),
+		Limit:  defaultLogLimit,
+	}
+	for _, event := range params["event"] {
+		q.Events = append(q.Events, routing.EventType(event))
+	}
+	var err error
+	if since := params.Get("since"); since != "" {
+		if q.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return q, errors.New("since must be an RFC 3339 time")
+		}
+	}
+	if until := params.Get("until"); until != "" {
+		if q.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return q, errors.New("until must be an RFC 3339 time")
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 {
+			return q, errors.New("limit must be a positive number")
+		}
+	}
+	return q, nil
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("could not write admin response", "err", err)
+	}
+}
@@ -0,0 +1,345 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/server"
+)
+
+const testToken = "secret"
+
+// fakeGame records what the API asked of it and fails with err
+type fakeGame struct {
+	err    error
+	health server.Health
+	state  routing.PlayingState
+
+	paused   []bool
+	pauseFor []time.Duration
+	commands []routing.AdminCommand
+	query    *logstore.Query
+}
+
+func (g *fakeGame) SetPaused(paused bool) error {
+	g.paused = append(g.paused, paused)
+	return g.err
+}
+
+func (g *fakeGame) PauseFor(d time.Duration) error {
+	g.pauseFor = append(g.pauseFor, d)
+	return g.err
+}
+
+func (g *fakeGame) PlayingState() routing.PlayingState {
+	return g.state
+}
+
+func (g *fakeGame) Players() []gamelogic.PlayerInfo {
+	return nil
+}
+
+func (g *fakeGame) FindLogs(q logstore.Query) ([]logstore.Record, error) {
+	g.query = &q
+	return nil, g.err
+}
+
+func (g *fakeGame) Health() server.Health {
+	return g.health
+}
+
+func (g *fakeGame) SendAdmin(username string, cmd routing.AdminCommand) error {
+	g.commands = append(g.commands, cmd)
+	return g.err
+}
+
+// lobby finds the games it holds
+func lobby(games map[routing.Game]Game) Games {
+	return func(id routing.Game) (Game, bool) {
+		game, ok := games[id]
+		return game, ok
+	}
+}
+
+// newHandler serves game as the default game
+func newHandler(t *testing.T, game Game) http.Handler {
+	t.Helper()
+	handler, err := Handler(lobby(map[routing.Game]Game{routing.DefaultGame: game}), testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+// do serves one request, authorized with the test token unless token is
+// set to something else
+func do(handler http.Handler, method, target, body string, token ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	auth := "Bearer " + testToken
+	if len(token) > 0 {
+		auth = token[0]
+	}
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerNeedsToken(t *testing.T) {
+	if _, err := Handler(lobby(nil), ""); err == nil {
+		t.Fatal("Handler accepted an empty token")
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer nope", http.StatusUnauthorized},
+		{"not bearer", "Basic " + testToken, http.StatusUnauthorized},
+		{"prefix of the token", "Bearer " + testToken[:3], http.StatusUnauthorized},
+		{"right token", "Bearer " + testToken, http.StatusOK},
+	}
+	handler := newHandler(t, &fakeGame{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(handler, http.MethodGet, "/api/state", "", tt.auth)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.status == http.StatusUnauthorized && !strings.HasPrefix(challenge, "Bearer") {
+				t.Errorf("WWW-Authenticate = %q, want a bearer challenge", challenge)
+			}
+		})
+	}
+}
+
+func TestRoutesByGame(t *testing.T) {
+	main, second := &fakeGame{}, &fakeGame{}
+	handler, err := Handler(lobby(map[routing.Game]Game{routing.DefaultGame: main, "second": second}), testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		game   *fakeGame
+	}{
+		{"default game", "/api/pause", http.StatusOK, main},
+		{"default game by name", "/api/games/default/pause", http.StatusOK, main},
+		{"named game", "/api/games/second/pause", http.StatusOK, second},
+		{"no such game", "/api/games/third/pause", http.StatusNotFound, nil},
+		{"invalid game", "/api/games/Not%20a%20game/pause", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			main.paused, second.paused = nil, nil
+			w := do(handler, http.MethodPost, tt.target, "")
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			for _, game := range []*fakeGame{main, second} {
+				if paused := len(game.paused) > 0; paused != (game == tt.game) {
+					t.Errorf("game paused = %v, want only the game the path names paused", paused)
+				}
+			}
+		})
+	}
+
+	// the token is checked before the game is looked up, so games can not
+	// be probed without it
+	if w := do(handler, http.MethodGet, "/api/games/third/state", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d without a token, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name   string
+		health server.Health
+		status int
+		want   string
+	}{
+		{"connected", server.Health{BrokerConnected: true, Leader: true}, http.StatusOK, "ok"},
+		{"disconnected", server.Health{PendingLogs: 3}, http.StatusServiceUnavailable, "unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newHandler(t, &fakeGame{health: tt.health})
+			// load balancers probe the health check without the token
+			w := do(handler, http.MethodGet, "/api/health", "", "")
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			var resp healthResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.want || resp.PendingLogs != tt.health.PendingLogs || resp.Leader != tt.health.Leader {
+				t.Errorf("health = %+v, want status %q from %+v", resp, tt.want, tt.health)
+			}
+		})
+	}
+}
+
+func TestSetPaused(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		err      error
+		status   int
+		paused   []bool
+		pauseFor []time.Duration
+	}{
+		{name: "pause", target: "/api/pause", status: http.StatusOK, paused: []bool{true}},
+		{name: "resume", target: "/api/resume", status: http.StatusOK, paused: []bool{false}},
+		{name: "pause for", target: "/api/pause?for=30s", status: http.StatusOK, pauseFor: []time.Duration{30 * time.Second}},
+		{name: "resume ignores for", target: "/api/resume?for=abc", status: http.StatusOK, paused: []bool{false}},
+		{name: "for not a duration", target: "/api/pause?for=abc", status: http.StatusBadRequest},
+		{name: "for zero", target: "/api/pause?for=0s", status: http.StatusBadRequest},
+		{name: "for negative", target: "/api/pause?for=-1s", status: http.StatusBadRequest},
+		{name: "not leader", target: "/api/pause", err: server.ErrNotLeader, status: http.StatusServiceUnavailable, paused: []bool{true}},
+		{name: "publish failed", target: "/api/resume", err: errors.New("channel closed"), status: http.StatusBadGateway, paused: []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &fakeGame{err: tt.err}
+			w := do(newHandler(t, game), http.MethodPost, tt.target, "")
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !slices.Equal(game.paused, tt.paused) || !slices.Equal(game.pauseFor, tt.pauseFor) {
+				t.Errorf("SetPaused %v, PauseFor %v, want %v and %v", game.paused, game.pauseFor, tt.paused, tt.pauseFor)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+		sent   bool
+	}{
+		{name: "kick", body: `{"action":"kick","reason":"spam"}`, status: http.StatusOK, sent: true},
+		{name: "mute for", body: `{"action":"mute","for":"10m"}`, status: http.StatusOK, sent: true},
+		{name: "for not a duration", body: `{"action":"mute","for":"soon"}`, status: http.StatusBadRequest},
+		{name: "for negative", body: `{"action":"mute","for":"-10m"}`, status: http.StatusBadRequest},
+		{name: "not JSON", body: `kick`, status: http.StatusBadRequest},
+		{name: "unknown action", body: `{"action":"ban"}`, status: http.StatusBadRequest},
+		{name: "remove without units", body: `{"action":"remove"}`, status: http.StatusBadRequest},
+		{name: "not playing", body: `{"action":"kick"}`, err: server.ErrNotPlaying, status: http.StatusNotFound, sent: true},
+		{name: "not leader", body: `{"action":"kick"}`, err: server.ErrNotLeader, status: http.StatusServiceUnavailable, sent: true},
+		{name: "publish failed", body: `{"action":"kick"}`, err: errors.New("channel closed"), status: http.StatusBadGateway, sent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &fakeGame{err: tt.err}
+			w := do(newHandler(t, game), http.MethodPost, "/api/players/alice/commands", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if sent := len(game.commands) > 0; sent != tt.sent {
+				t.Errorf("command sent = %v, want %v", sent, tt.sent)
+			}
+		})
+	}
+}
+
+func TestCommandUntil(t *testing.T) {
+	game := &fakeGame{}
+	before := time.Now()
+	w := do(newHandler(t, game), http.MethodPost, "/api/players/alice/commands", `{"action":"pause","for":"1h"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	until := game.commands[0].Until
+	if until.Before(before.Add(time.Hour)) || until.After(time.Now().Add(time.Hour)) {
+		t.Errorf("until = %v, want an hour from the request", until)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"no filters", "", http.StatusOK},
+		{"all filters", "?player=alice&event=war&since=2024-01-01T00:00:00Z&until=2024-01-02T00:00:00Z&text=won&limit=5", http.StatusOK},
+		{"since not RFC 3339", "?since=yesterday", http.StatusBadRequest},
+		{"since a date", "?since=2024-01-01", http.StatusBadRequest},
+		{"until not RFC 3339", "?until=1700000000", http.StatusBadRequest},
+		{"limit not a number", "?limit=ten", http.StatusBadRequest},
+		{"limit zero", "?limit=0", http.StatusBadRequest},
+		{"limit negative", "?limit=-5", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &fakeGame{}
+			w := do(newHandler(t, game), http.MethodGet, "/api/logs"+tt.query, "")
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if searched := game.query != nil; searched != (tt.status == http.StatusOK) {
+				t.Errorf("FindLogs called = %v after status %d", searched, w.Code)
+			}
+			if tt.status == http.StatusOK && strings.TrimSpace(w.Body.String()) != "[]" {
+				t.Errorf("body = %q, want an empty list", w.Body)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/logs?player=alice&event=war&event=move&since=2024-01-01T00:00:00Z&until=2024-01-02T00:00:00Z&text=won&limit=5", nil)
+	q, err := parseQuery(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := logstore.Query{
+		Player: "alice",
+		Events: []routing.EventType{"war", "move"},
+		Since:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Text:   "won",
+		Limit:  5,
+	}
+	if q.Player != want.Player || !slices.Equal(q.Events, want.Events) || !q.Since.Equal(want.Since) || !q.Until.Equal(want.Until) || q.Text != want.Text || q.Limit != want.Limit {
+		t.Errorf("query = %+v, want %+v", q, want)
+	}
+
+	q, err = parseQuery(httptest.NewRequest(http.MethodGet, "/api/logs", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Limit != defaultLogLimit {
+		t.Errorf("limit = %d, want the default %d", q.Limit, defaultLogLimit)
+	}
+}
+
+func TestLogsWithoutStore(t *testing.T) {
+	w := do(newHandler(t, &fakeGame{err: server.ErrNoLogStore}), http.MethodGet, "/api/logs", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+)
+
+// ServerKeyID names the key all servers sign with
+const ServerKeyID = "server"
+
+// Authority issues player keys. Every key is derived from the secret the
+// servers share, so any server can recompute the public key of any player
+// without keeping a key database
+type Authority struct {
+	secret []byte
+	server *Signer
+}
+
+func NewAuthority(secret []byte) (*Authority, error) {
+	a := &Authority{secret: secret}
+	server, err := NewSigner(session.ServerUsername, ServerKeyID, a.seed(session.ServerUsername, ServerKeyID))
+	if err != nil {
+		return nil, err
+	}
+	a.server = server
+	return a, nil
+}
+
+func (a *Authority) seed(username, keyID string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte("peril-signing-key|" + username + "|" + keyID))
+	return mac.Sum(nil)[:ed25519.SeedSize]
+}
+
+// Server signs everything the servers publish
+func (a *Authority) Server() *Signer {
+	return a.server
+}
+
+func (a *Authority) ServerPublicKey() ed25519.PublicKey {
+	return a.PublicKey(session.ServerUsername, ServerKeyID)
+}
+
+// IssueKey creates a new key for username and returns its id and seed
+func (a *Authority) IssueKey(username string) (string, []byte, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, fmt.Errorf("could not create key id: %v", err)
+	}
+	keyID := fmt.Sprintf("%x-%s", time.Now().Unix(), hex.EncodeToString(random))
+	return keyID, a.seed(username, keyID), nil
+}
+
+func (a *Authority) PublicKey(username, keyID string) ed25519.PublicKey {
+	return ed25519.NewKeyFromSeed(a.seed(username, keyID)).Public().(ed25519.PublicKey)
+}
+
+// Announce returns a server signed announcement of a player's key
+func (a *Authority) Announce(username, keyID, replaces string) routing.KeyAnnouncement {
+	ann := routing.KeyAnnouncement{
+		Username:  username,
+		KeyID:     keyID,
+		PublicKey: a.PublicKey(username, keyID),
+		Replaces:  replaces,
+	}
+	_, ann.Signature = a.server.Sign(announcementContent(ann))
+	return ann
+}
+
+// VerifyAnnouncement checks that a key announcement was signed by the servers
+func VerifyAnnouncement(serverKey ed25519.PublicKey, ann routing.KeyAnnouncement) error {
+	if len(ann.PublicKey) != ed25519.PublicKeySize {
+		return errors.New("announced key has the wrong size")
+	}
+	if !ed25519.Verify(serverKey, announcementContent(ann), ann.Signature) {
+		return errors.New("key announcement is not signed by the server")
+	}
+	return nil
+}
+
+func announcementContent(ann routing.KeyAnnouncement) []byte {
+	return []byte(strings.Join([]string{
+		"announce",
+		ann.Username,
+		ann.KeyID,
+		hex.EncodeToString(ann.PublicKey),
+		ann.Replaces,
+	}, "|"))
+}
+
+// SignRotation fills in the signature of a key rotation request
+func SignRotation(s *Signer, req routing.KeyRotationRequest) routing.KeyRotationRequest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	req.Username = s.username
+	req.KeyID = s.keyID
+	req.Signature = ed25519.Sign(s.key, rotationContent(req))
+	return req
+}
+
+func rotationContent(req routing.KeyRotationRequest) []byte {
+	return []byte(strings.Join([]string{
+		"rotate",
+		req.Username,
+		req.KeyID,
+		req.RequestedAt.UTC().Format(time.RFC3339Nano),
+		hex.EncodeToString(req.ReplyKey),
+	}, "|"))
+}
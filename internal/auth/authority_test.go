@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+)
+
+func newAuthority(t *testing.T, secret string) *Authority {
+	t.Helper()
+	a, err := NewAuthority([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestKeyDerivation(t *testing.T) {
+	a := newAuthority(t, "a secret shared by all servers")
+	tests := []struct {
+		name       string
+		other      *Authority
+		username   string
+		keyID      string
+		sameAsBase bool
+	}{
+		{"same secret", newAuthority(t, "a secret shared by all servers"), "alice", "k1", true},
+		{"other secret", newAuthority(t, "another secret of other servers"), "alice", "k1", false},
+		{"other player", a, "bob", "k1", false},
+		{"other key", a, "alice", "k2", false},
+	}
+	base := a.PublicKey("alice", "k1")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.other.PublicKey(tt.username, tt.keyID)
+			if bytes.Equal(got, base) != tt.sameAsBase {
+				t.Errorf("key of %s/%s equal to alice/k1 is %v, want %v", tt.username, tt.keyID, !tt.sameAsBase, tt.sameAsBase)
+			}
+		})
+	}
+}
+
+func TestIssueKey(t *testing.T) {
+	a := newAuthority(t, "a secret shared by all servers")
+	keyID, seed, err := a.IssueKey("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner("alice", keyID, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server recomputes the public key of the issued one
+	_, signature := signer.Sign([]byte("hello"))
+	keyring := NewKeyring(nil)
+	keyring.Add("alice", keyID, a.PublicKey("alice", keyID))
+	if err := keyring.VerifySignature("alice", keyID, []byte("hello"), signature); err != nil {
+		t.Errorf("signature of an issued key does not verify: %v", err)
+	}
+
+	otherID, _, err := a.IssueKey("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherID == keyID {
+		t.Error("two issued keys share an id")
+	}
+}
+
+func TestVerifyAnnouncement(t *testing.T) {
+	a := newAuthority(t, "a secret shared by all servers")
+	ann := a.Announce("alice", "k2", "k1")
+	if err := VerifyAnnouncement(a.ServerPublicKey(), ann); err != nil {
+		t.Fatalf("announcement does not verify: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*routing.KeyAnnouncement)
+	}{
+		{"username", func(ann *routing.KeyAnnouncement) { ann.Username = "bob" }},
+		{"key id", func(ann *routing.KeyAnnouncement) { ann.KeyID = "k3" }},
+		{"replaced key", func(ann *routing.KeyAnnouncement) { ann.Replaces = "" }},
+		{"public key", func(ann *routing.KeyAnnouncement) { ann.PublicKey = a.PublicKey("mallory", "k2") }},
+		{"short public key", func(ann *routing.KeyAnnouncement) { ann.PublicKey = ann.PublicKey[:8] }},
+		{"signature", func(ann *routing.KeyAnnouncement) { ann.Signature = bytes.Repeat([]byte{1}, len(ann.Signature)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := ann
+			changed.PublicKey = bytes.Clone(ann.PublicKey)
+			tt.change(&changed)
+			if err := VerifyAnnouncement(a.ServerPublicKey(), changed); err == nil {
+				t.Error("tampered announcement verifies")
+			}
+		})
+	}
+
+	other := newAuthority(t, "another secret of other servers")
+	if err := VerifyAnnouncement(other.ServerPublicKey(), ann); err == nil {
+		t.Error("announcement verifies with the key of other servers")
+	}
+}
+
+func TestVerifyRotation(t *testing.T) {
+	a := newAuthority(t, "a secret shared by all servers")
+	signer, err := NewSigner("alice", "k1", a.seed("alice", "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := NewKeyring(func(username, keyID string) (ed25519.PublicKey, error) {
+		return a.PublicKey(username, keyID), nil
+	})
+	req := SignRotation(signer, routing.KeyRotationRequest{RequestedAt: time.Now(), ReplyKey: []byte("reply")})
+	if req.Username != "alice" || req.KeyID != "k1" {
+		t.Fatalf("rotation request of %s/%s, want alice/k1", req.Username, req.KeyID)
+	}
+	if err := keyring.VerifyRotation(req); err != nil {
+		t.Fatalf("rotation request does not verify: %v", err)
+	}
+
+	replayed := req
+	replayed.RequestedAt = req.RequestedAt.Add(time.Second)
+	if err := keyring.VerifyRotation(replayed); err == nil {
+		t.Error("rotation request verifies with another time")
+	}
+	redirected := req
+	redirected.ReplyKey = []byte("mallory")
+	if err := keyring.VerifyRotation(redirected); err == nil {
+		t.Error("rotation request verifies with another reply key")
+	}
+}
+
+func TestServerSigner(t *testing.T) {
+	a := newAuthority(t, "a secret shared by all servers")
+	if a.Server().Username() != session.ServerUsername || a.Server().KeyID() != ServerKeyID {
+		t.Errorf("server signs as %s/%s", a.Server().Username(), a.Server().KeyID())
+	}
+}
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RotationGrace is how long a replaced key is still accepted, so messages
+// already on their way when a player rotates keys are not rejected
+const RotationGrace = time.Minute
+
+// Policy decides what happens to messages failing verification
+type Policy string
+
+const (
+	// rejected messages are discarded to the dead letter exchange
+	PolicyReject Policy = "reject"
+	// failures are logged but the message is handled anyway
+	PolicyWarn Policy = "warn"
+	PolicyOff  Policy = "off"
+)
+
+func ParsePolicy(value string) (Policy, error) {
+	switch policy := Policy(value); policy {
+	case PolicyReject, PolicyWarn, PolicyOff:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown verification policy %q, use reject, warn or off", value)
+}
+
+// LookupFunc finds a public key the keyring has not seen announced yet
+type LookupFunc func(username, keyID string) (ed25519.PublicKey, error)
+
+type keyEntry struct {
+	public    ed25519.PublicKey
+	retiresAt time.Time // zero while the key is current
+}
+
+// Keyring holds the public keys of all players
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string]map[string]*keyEntry
+	lookup LookupFunc
+	// onRetire is told about every retirement that changed a key
+	onRetire func(username, keyID string, at time.Time)
+}
+
+func NewKeyring(lookup LookupFunc) *Keyring {
+	return &Keyring{
+		keys:   map[string]map[string]*keyEntry{},
+		lookup: lookup,
+	}
+}
+
+func (k *Keyring) Add(username, keyID string, public ed25519.PublicKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys[username] == nil {
+		k.keys[username] = map[string]*keyEntry{}
+	}
+	if _, known := k.keys[username][keyID]; !known {
+		k.keys[username][keyID] = &keyEntry{public: public}
+	}
+}
+
+// Learn adds an announced key after checking the server signed it. The key
+// it replaces is retired after RotationGrace
+func (k *Keyring) Learn(ann routing.KeyAnnouncement, serverKey ed25519.PublicKey) error {
+	if err := VerifyAnnouncement(serverKey, ann); err != nil {
+		return err
+	}
+	k.Add(ann.Username, ann.KeyID, ann.PublicKey)
+	if ann.Replaces != "" {
+		k.Retire(ann.Username, ann.Replaces, time.Now().Add(RotationGrace))
+	}
+	return nil
+}
+
+// Retire stops accepting a key from at onwards. Keys retired before they
+// were ever seen are remembered, so a lookup can not bring them back
+func (k *Keyring) Retire(username, keyID string, at time.Time) {
+	changed := k.retire(username, keyID, at)
+	k.mu.RLock()
+	onRetire := k.onRetire
+	k.mu.RUnlock()
+	if changed && onRetire != nil {
+		onRetire(username, keyID, at)
+	}
+}
+
+// retire reports whether it moved the retirement of the key forward
+func (k *Keyring) retire(username, keyID string, at time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys[username] == nil {
+		k.keys[username] = map[string]*keyEntry{}
+	}
+	entry, known := k.keys[username][keyID]
+	if !known {
+		entry = &keyEntry{}
+		k.keys[username][keyID] = entry
+	}
+	if entry.retiresAt.IsZero() || at.Before(entry.retiresAt) {
+		entry.retiresAt = at
+		return true
+	}
+	return false
+}
+
+// Retired reports whether a key was retired, even if it is still accepted
+// during its grace period
+func (k *Keyring) Retired(username, keyID string) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	entry, known := k.keys[username][keyID]
+	return known && !entry.retiresAt.IsZero()
+}
+
+func (k *Keyring) PublicKey(username, keyID string) (ed25519.PublicKey, error) {
+	k.mu.RLock()
+	entry, known := k.keys[username][keyID]
+	k.mu.RUnlock()
+
+	if known {
+		if !entry.retiresAt.IsZero() && time.Now().After(entry.retiresAt) {
+			return nil, fmt.Errorf("key %s of %s was retired", keyID, username)
+		}
+		if entry.public != nil {
+			return entry.public, nil
+		}
+	}
+
+	if k.lookup == nil {
+		return nil, fmt.Errorf("unknown key %s of %s", keyID, username)
+	}
+	public, err := k.lookup(username, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("could not look up key %s of %s: %v", keyID, username, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys[username] == nil {
+		k.keys[username] = map[string]*keyEntry{}
+	}
+	if entry, known := k.keys[username][keyID]; known {
+		entry.public = public
+	} else {
+		k.keys[username][keyID] = &keyEntry{public: public}
+	}
+	return public, nil
+}
+
+func (k *Keyring) VerifySignature(username, keyID string, data, signature []byte) error {
+	public, err := k.PublicKey(username, keyID)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, data, signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// VerifyRotation checks a key rotation request was signed with the key it replaces
+func (k *Keyring) VerifyRotation(req routing.KeyRotationRequest) error {
+	return k.VerifySignature(req.Username, req.KeyID, rotationContent(req), req.Signature)
+}
+
+// VerifyDelivery checks the signature headers of a delivery and returns
+// who signed it
+func (k *Keyring) VerifyDelivery(msg amqp.Delivery) (string, error) {
+	signer, _ := msg.Headers[routing.SignerHeader].(string)
+	keyID, _ := msg.Headers[routing.KeyIDHeader].(string)
+	encoded, _ := msg.Headers[routing.SignatureHeader].(string)
+	if signer == "" || keyID == "" || encoded == "" {
+		return "", errors.New("message is not signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.New("malformed signature")
+	}
+	if err := k.VerifySignature(signer, keyID, signedContent(msg.RoutingKey, msg.Body), signature); err != nil {
+		return "", fmt.Errorf("message signed by %s: %v", signer, err)
+	}
+	return signer, nil
+}
+
+// OwnerRule decides whether signer may publish with a routing key
+type OwnerRule func(signer, key string) error
+
+// SignerOwnsKey requires the last word of the routing key to be the signer,
+// e.g. only alice may publish to army_moves.alice. Servers may publish to any
+func SignerOwnsKey(signer, key string) error {
+	if signer == session.ServerUsername {
+		return nil
+	}
+	owner := key[strings.LastIndex(key, ".")+1:]
+	if owner != signer {
+		return fmt.Errorf("%s can not publish as %s", signer, owner)
+	}
+	return nil
+}
+
+func SignedBy(usernames ...string) OwnerRule {
+	return func(signer, key string) error {
+		for _, username := range usernames {
+			if signer == username {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s may not publish to %s", signer, key)
+	}
+}
+
+func AnySigner(signer, key string) error {
+	return nil
+}
+
+// Verifier returns a pubsub verifier applying policy to every delivery
+func (k *Keyring) Verifier(policy Policy, rule OwnerRule) func(amqp.Delivery) error {
+	identify := k.Identify(policy, rule)
+	return func(msg amqp.Delivery) error {
+		_, err := identify(msg)
+		return err
+	}
+}
+
+// Identify is Verifier for pubsub.WithSigner, it also returns who signed a
+// delivery. Only the reject policy hands the signer on, the others do not
+// enforce it
+func (k *Keyring) Identify(policy Policy, rule OwnerRule) func(amqp.Delivery) (string, error) {
+	return func(msg amqp.Delivery) (string, error) {
+		if policy == PolicyOff {
+			return "", nil
+		}
+		signer, err := k.VerifyDelivery(msg)
+		if err == nil {
+			err = rule(signer, msg.RoutingKey)
+		}
+		if err != nil && policy == PolicyWarn {
+			slog.Warn("accepting message failing verification", "routing_key", msg.RoutingKey, "err", err)
+			return "", nil
+		}
+		if err != nil || policy != PolicyReject {
+			return "", err
+		}
+		return signer, nil
+	}
+}
+
+// SignedAs checks the message being handled was signed by username or a
+// server. Payloads speaking for a player, like the snapshot in a move, must
+// come from that player. Messages handled without a verified signer pass
+func SignedAs(ctx context.Context, username string) error {
+	signer, ok := pubsub.Signer(ctx)
+	if !ok || signer == username || signer == session.ServerUsername {
+		return nil
+	}
+	return fmt.Errorf("%s can not publish for %s", signer, username)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestOwnerRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   OwnerRule
+		signer string
+		key    string
+		ok     bool
+	}{
+		{"owner", SignerOwnsKey, "alice", "army_moves.alice", true},
+		{"other player", SignerOwnsKey, "bob", "army_moves.alice", false},
+		{"prefix of the owner", SignerOwnsKey, "ali", "army_moves.alice", false},
+		{"game prefix", SignerOwnsKey, "alice", "games.one.army_moves.alice", true},
+		{"key of one word", SignerOwnsKey, "alice", "alice", true},
+		{"server", SignerOwnsKey, "server", "army_moves.alice", true},
+		{"signed by", SignedBy("server"), "server", "pause", true},
+		{"not signed by", SignedBy("server"), "alice", "pause", false},
+		{"one of several", SignedBy("server", "admin"), "admin", "pause", true},
+		{"any signer", AnySigner, "mallory", "war.alice", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule(tt.signer, tt.key)
+			if (err == nil) != tt.ok {
+				t.Errorf("%s publishing to %s: %v, want ok %v", tt.signer, tt.key, err, tt.ok)
+			}
+		})
+	}
+}
+
+// signedDelivery is what a consumer receives of a message signer published
+func signedDelivery(t *testing.T, signer *Signer, key string, body []byte) amqp.Delivery {
+	t.Helper()
+	msg := amqp.Publishing{Body: body}
+	if err := signer.Option()(key, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{RoutingKey: key, Body: msg.Body, Headers: msg.Headers}
+}
+
+func TestIdentify(t *testing.T) {
+	a := newAuthority(t, "a secret shared by all servers")
+	alice, err := NewSigner("alice", "k1", a.seed("alice", "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := NewKeyring(nil)
+	keyring.Add("alice", "k1", a.PublicKey("alice", "k1"))
+
+	valid := signedDelivery(t, alice, "army_moves.alice", []byte("move"))
+	replayed := valid
+	replayed.RoutingKey = "army_moves.bob"
+	tampered := valid
+	tampered.Body = []byte("other move")
+	unsigned := amqp.Delivery{RoutingKey: "army_moves.alice", Body: []byte("move")}
+	impostor := signedDelivery(t, alice, "army_moves.bob", []byte("move"))
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		msg        amqp.Delivery
+		wantSigner string
+		wantErr    bool
+	}{
+		{"valid", PolicyReject, valid, "alice", false},
+		{"other routing key", PolicyReject, replayed, "", true},
+		{"tampered body", PolicyReject, tampered, "", true},
+		{"unsigned", PolicyReject, unsigned, "", true},
+		{"not the owner", PolicyReject, impostor, "", true},
+		{"warn lets it through", PolicyWarn, unsigned, "", false},
+		{"warn does not vouch for the signer", PolicyWarn, valid, "", false},
+		{"off", PolicyOff, tampered, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := keyring.Identify(tt.policy, SignerOwnsKey)(tt.msg)
+			if (err != nil) != tt.wantErr || signer != tt.wantSigner {
+				t.Errorf("Identify = %q, %v, want %q and error %v", signer, err, tt.wantSigner, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetire(t *testing.T) {
+	a := newAuthority(t, "a secret shared by all servers")
+	lookups := 0
+	keyring := NewKeyring(func(username, keyID string) (ed25519.PublicKey, error) {
+		lookups++
+		return a.PublicKey(username, keyID), nil
+	})
+	var retired []string
+	keyring.onRetire = func(username, keyID string, at time.Time) {
+		retired = append(retired, username+"/"+keyID)
+	}
+
+	keyring.Add("alice", "k1", a.PublicKey("alice", "k1"))
+	keyring.Retire("alice", "k1", time.Now().Add(time.Minute))
+	if _, err := keyring.PublicKey("alice", "k1"); err != nil {
+		t.Errorf("key in its grace period is refused: %v", err)
+	}
+	if !keyring.Retired("alice", "k1") {
+		t.Error("key in its grace period is not reported retired")
+	}
+
+	// retiring earlier moves the retirement forward, later does not
+	keyring.Retire("alice", "k1", time.Now().Add(-time.Second))
+	keyring.Retire("alice", "k1", time.Now().Add(time.Hour))
+	if _, err := keyring.PublicKey("alice", "k1"); err == nil {
+		t.Error("retired key is accepted")
+	}
+	if len(retired) != 2 {
+		t.Errorf("told about retirements %q, want the two that changed the key", retired)
+	}
+
+	// a key retired before it was seen can not be looked up again
+	keyring.Retire("bob", "k1", time.Now().Add(-time.Second))
+	if _, err := keyring.PublicKey("bob", "k1"); err == nil {
+		t.Error("retired key came back through a lookup")
+	}
+	if lookups != 0 {
+		t.Errorf("%d lookup(s) of retired keys", lookups)
+	}
+
+	if _, err := keyring.PublicKey("carol", "k1"); err != nil || lookups != 1 {
+		t.Errorf("unknown key: %v after %d lookup(s), want one successful lookup", err, lookups)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, value := range []string{"reject", "warn", "off"} {
+		if policy, err := ParsePolicy(value); err != nil || string(policy) != value {
+			t.Errorf("ParsePolicy(%q) = %q, %v", value, policy, err)
+		}
+	}
+	if _, err := ParsePolicy("strict"); err == nil {
+		t.Error("ParsePolicy accepted strict")
+	}
+}
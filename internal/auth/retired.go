@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/filelock"
+)
+
+// retirement is one line of the retired keys file
+type retirement struct {
+	Username  string    `json:"username"`
+	KeyID     string    `json:"key_id"`
+	RetiresAt time.Time `json:"retires_at"`
+}
+
+// RetiredKeys keeps the retirements of a keyring in a file. Player keys
+// are derived from the secret, so a restarted server would otherwise
+// accept keys again that were retired because they leaked
+type RetiredKeys struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenRetiredKeys retires the keys listed in path on k and appends every
+// key k retires from now on. Servers on one host may share the file
+func OpenRetiredKeys(path string, k *Keyring) (*RetiredKeys, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("could not create directory of %s: %v", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", path, err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r retirement
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// a line cut short by a crash
+			slog.Warn("skipping malformed retired key", "path", path, "err", err)
+			continue
+		}
+		k.retire(r.Username, r.KeyID, r.RetiresAt)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+
+	r := &RetiredKeys{file: file}
+	k.mu.Lock()
+	k.onRetire = r.record
+	k.mu.Unlock()
+	return r, nil
+}
+
+func (r *RetiredKeys) record(username, keyID string, at time.Time) {
+	line, err := json.Marshal(retirement{Username: username, KeyID: keyID, RetiresAt: at})
+	if err != nil {
+		slog.Error("could not encode retired key", "username", username, "err", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := filelock.Lock(r.file); err != nil {
+		slog.Error("could not lock retired keys", "err", err)
+		return
+	}
+	defer filelock.Unlock(r.file)
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		slog.Error("could not record retired key", "username", username, "err", err)
+	}
+}
+
+func (r *RetiredKeys) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
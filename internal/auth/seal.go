@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// NewReplyKey creates the key a player asks for a new signing key with.
+// The server seals the new key to it, so only the asking player can read
+// the reply, whoever receives it
+func NewReplyKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// SealKey encrypts seed for the holder of the private half of replyKey. It
+// returns the public half of the one time key used and the sealed seed
+func SealKey(replyKey, seed []byte) ([]byte, []byte, error) {
+	public, err := ecdh.X25519().NewPublicKey(replyKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid reply key: %v", err)
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create sealing key: %v", err)
+	}
+	aead, err := sealer(ephemeral, public)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("could not create nonce: %v", err)
+	}
+	return ephemeral.PublicKey().Bytes(), aead.Seal(nonce, nonce, seed, nil), nil
+}
+
+// OpenKey decrypts a seed sealed with SealKey
+func OpenKey(replyKey *ecdh.PrivateKey, sealingKey, sealed []byte) ([]byte, error) {
+	public, err := ecdh.X25519().NewPublicKey(sealingKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealing key: %v", err)
+	}
+	aead, err := sealer(replyKey, public)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed key is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	seed, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("could not open sealed key")
+	}
+	return seed, nil
+}
+
+func sealer(private *ecdh.PrivateKey, public *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, fmt.Errorf("could not agree on a key: %v", err)
+	}
+	key := sha256.Sum256(append([]byte("peril-sealed-key|"), shared...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
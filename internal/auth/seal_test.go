@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"testing"
+)
+
+func TestSealKey(t *testing.T) {
+	replyKey, err := NewReplyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewReplyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := []byte("0123456789abcdef0123456789abcdef")
+	sealingKey, sealed, err := SealKey(replyKey.PublicKey().Bytes(), seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := OpenKey(replyKey, sealingKey, sealed)
+	if err != nil || string(opened) != string(seed) {
+		t.Fatalf("OpenKey = %q, %v, want the sealed seed", opened, err)
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name       string
+		key        *ecdh.PrivateKey
+		sealingKey []byte
+		sealed     []byte
+	}{
+		{"someone else", other, sealingKey, sealed},
+		{"tampered", replyKey, sealingKey, tampered},
+		{"too short", replyKey, sealingKey, sealed[:4]},
+		{"invalid sealing key", replyKey, []byte("short"), sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenKey(tt.key, tt.sealingKey, tt.sealed); err == nil {
+				t.Error("OpenKey succeeded")
+			}
+		})
+	}
+
+	if _, _, err := SealKey([]byte("short"), seed); err == nil {
+		t.Error("SealKey accepted an invalid reply key")
+	}
+}
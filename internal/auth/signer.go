@@ -0,0 +1,83 @@
+// Package auth signs published messages with per player ed25519 keys and
+// verifies the signatures on the consuming side
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Signer signs messages with the current key of one player. The key can
+// be swapped with Rotate while other goroutines keep publishing
+type Signer struct {
+	username string
+
+	mu    sync.RWMutex
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+func NewSigner(username, keyID string, seed []byte) (*Signer, error) {
+	s := &Signer{username: username}
+	if err := s.Rotate(keyID, seed); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Signer) Username() string {
+	return s.username
+}
+
+func (s *Signer) KeyID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyID
+}
+
+// Rotate switches to a new key
+func (s *Signer) Rotate(keyID string, seed []byte) error {
+	if len(seed) != ed25519.SeedSize {
+		return fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyID = keyID
+	s.key = ed25519.NewKeyFromSeed(seed)
+	return nil
+}
+
+// Sign signs data and returns the id of the key used
+func (s *Signer) Sign(data []byte) (string, []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keyID, ed25519.Sign(s.key, data)
+}
+
+// Option signs the message body together with its routing key, so a
+// signed message can not be replayed under another player's key
+func (s *Signer) Option() pubsub.PublishOption {
+	return func(key string, msg *amqp.Publishing) error {
+		keyID, signature := s.Sign(signedContent(key, msg.Body))
+		if msg.Headers == nil {
+			msg.Headers = amqp.Table{}
+		}
+		msg.Headers[routing.SignerHeader] = s.username
+		msg.Headers[routing.KeyIDHeader] = keyID
+		msg.Headers[routing.SignatureHeader] = base64.StdEncoding.EncodeToString(signature)
+		return nil
+	}
+}
+
+func signedContent(key string, body []byte) []byte {
+	content := make([]byte, 0, len(key)+1+len(body))
+	content = append(content, key...)
+	content = append(content, '\n')
+	return append(content, body...)
+}
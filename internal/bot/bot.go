@@ -0,0 +1,86 @@
+// Package bot plays Peril without a human, one client command at a time
+package bot
+
+import (
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+)
+
+type Config struct {
+	Strategy  Strategy
+	ThinkTime time.Duration // average pause between two commands
+	MaxUnits  int           // the bot stops spawning at this many units
+	Seed      int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Strategy:  Random{},
+		ThinkTime: 2 * time.Second,
+		MaxUnits:  10,
+		Seed:      time.Now().UnixNano(),
+	}
+}
+
+// Bot plays a registered client
+type Bot struct {
+	client *client.Client
+	cfg    Config
+	rng    *rand.Rand
+}
+
+func New(c *client.Client, cfg Config) *Bot {
+	return &Bot{client: c, cfg: cfg, rng: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Play runs commands picked by the strategy until stop is closed or an
+// admin kicks the bot. The bot waits while the game is paused
+func (b *Bot) Play(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-b.client.Kicked():
+			slog.Info("bot was kicked", "username", b.client.Username(), "reason", b.client.KickReason())
+			return
+		case <-time.After(b.thinkTime()):
+		}
+
+		save := b.client.State().Snapshot()
+		if save.Paused {
+			continue
+		}
+		words := b.cfg.Strategy.Next(b.view(save), b.rng)
+		if words == nil {
+			continue
+		}
+		if err := b.client.Run(words); err != nil {
+			slog.Warn("bot command failed", "username", b.client.Username(), "command", words[0], "err", err)
+		}
+	}
+}
+
+func (b *Bot) view(save gamelogic.SavedGame) View {
+	me := gamelogic.Player{Username: save.Username, Units: map[int]gamelogic.Unit{}}
+	for _, unit := range save.Units {
+		me.Units[unit.ID] = unit
+	}
+	opponents := []gamelogic.Player{}
+	for _, info := range b.client.Players() {
+		opponents = append(opponents, info.Player)
+	}
+	return View{Me: me, Opponents: opponents, MaxUnits: b.cfg.MaxUnits}
+}
+
+// thinkTime varies between half and one and a half times the configured
+// think time, so bots started together do not act in lockstep
+func (b *Bot) thinkTime() time.Duration {
+	if b.cfg.ThinkTime <= 0 {
+		return 0
+	}
+	return b.cfg.ThinkTime/2 + time.Duration(b.rng.Int63n(int64(b.cfg.ThinkTime)))
+}
@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// View is what a bot knows when it picks its next command
+type View struct {
+	Me        gamelogic.Player
+	Opponents []gamelogic.Player
+	MaxUnits  int
+}
+
+// Strategy picks the next client command of a bot, nil to do nothing this turn
+type Strategy interface {
+	Name() string
+	Next(view View, rng *rand.Rand) []string
+}
+
+var strategies = map[string]Strategy{
+	"random":     Random{},
+	"aggressive": Aggressive{},
+	"defensive":  Defensive{},
+}
+
+func ParseStrategy(name string) (Strategy, error) {
+	strategy, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, use random, aggressive or defensive", name)
+	}
+	return strategy, nil
+}
+
+// Random spawns random units in random places and moves them around aimlessly
+type Random struct{}
+
+func (Random) Name() string { return "random" }
+
+func (Random) Next(view View, rng *rand.Rand) []string {
+	if len(view.Me.Units) < view.MaxUnits && (len(view.Me.Units) == 0 || rng.Intn(2) == 0) {
+		return spawn(pick(rng, gamelogic.Locations()), pick(rng, gamelogic.Ranks()))
+	}
+	units := sortedUnits(view.Me)
+	if len(units) == 0 {
+		return nil
+	}
+	return move(pick(rng, gamelogic.Locations()), pick(rng, units))
+}
+
+// Aggressive builds up an army and sends all of it after the weakest
+// opponent that has units
+type Aggressive struct{}
+
+func (Aggressive) Name() string { return "aggressive" }
+
+func (Aggressive) Next(view View, rng *rand.Rand) []string {
+	target, ok := weakest(view.Opponents)
+	// attack with a big enough army, or when no more units can be spawned
+	if !ok || len(view.Me.Units) < min(3, view.MaxUnits) {
+		if len(view.Me.Units) >= view.MaxUnits {
+			return nil
+		}
+		return spawn(pick(rng, gamelogic.Locations()), pick(rng, gamelogic.Ranks()))
+	}
+
+	front := pick(rng, sortedUnits(target)).Location
+	units := []gamelogic.Unit{}
+	for _, unit := range sortedUnits(view.Me) {
+		if unit.Location != front {
+			units = append(units, unit)
+		}
+	}
+	if len(units) > 0 {
+		return move(front, units...)
+	}
+	// the whole army is already there, reinforce it
+	if len(view.Me.Units) < view.MaxUnits {
+		return spawn(front, pick(rng, gamelogic.Ranks()))
+	}
+	return nil
+}
+
+// Defensive keeps its army together in one place and runs from stronger
+// opponents
+type Defensive struct{}
+
+func (Defensive) Name() string { return "defensive" }
+
+func (Defensive) Next(view View, rng *rand.Rand) []string {
+	units := sortedUnits(view.Me)
+	if len(units) == 0 {
+		return spawn(pick(rng, gamelogic.Locations()), gamelogic.RankArtillery)
+	}
+	home := units[0].Location
+
+	// retreat to a location no opponent holds
+	mine := unitsIn(units, home)
+	for _, opponent := range view.Opponents {
+		theirs := unitsIn(sortedUnits(opponent), home)
+		if len(theirs) > 0 && power(theirs) >= power(mine) {
+			if safe, ok := safeLocation(view, rng); ok {
+				return move(safe, units...)
+			}
+		}
+	}
+
+	// gather stragglers back home
+	for _, unit := range units {
+		if unit.Location != home {
+			return move(home, unit)
+		}
+	}
+	if len(units) < view.MaxUnits {
+		return spawn(home, pick(rng, gamelogic.Ranks()))
+	}
+	return nil
+}
+
+// weakest returns the opponent with units and the lowest power level
+func weakest(opponents []gamelogic.Player) (gamelogic.Player, bool) {
+	candidates := []gamelogic.Player{}
+	for _, opponent := range opponents {
+		if len(opponent.Units) > 0 {
+			candidates = append(candidates, opponent)
+		}
+	}
+	if len(candidates) == 0 {
+		return gamelogic.Player{}, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return gamelogic.PowerLevel(candidates[i]) < gamelogic.PowerLevel(candidates[j])
+	})
+	return candidates[0], true
+}
+
+func safeLocation(view View, rng *rand.Rand) (gamelogic.Location, bool) {
+	held := map[gamelogic.Location]bool{}
+	for _, opponent := range view.Opponents {
+		for _, unit := range opponent.Units {
+			held[unit.Location] = true
+		}
+	}
+	safe := []gamelogic.Location{}
+	for _, location := range gamelogic.Locations() {
+		if !held[location] {
+			safe = append(safe, location)
+		}
+	}
+	if len(safe) == 0 {
+		return "", false
+	}
+	return pick(rng, safe), true
+}
+
+func spawn(location gamelogic.Location, rank gamelogic.UnitRank) []string {
+	return []string{"spawn", string(location), string(rank)}
+}
+
+func move(location gamelogic.Location, units ...gamelogic.Unit) []string {
+	words := []string{"move", string(location)}
+	for _, unit := range units {
+		words = append(words, strconv.Itoa(unit.ID))
+	}
+	return words
+}
+
+// sortedUnits lists a player's units by ID, so a seeded bot plays the same way every time
+func sortedUnits(p gamelogic.Player) []gamelogic.Unit {
+	units := make([]gamelogic.Unit, 0, len(p.Units))
+	for _, unit := range p.Units {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+	return units
+}
+
+func unitsIn(units []gamelogic.Unit, location gamelogic.Location) []gamelogic.Unit {
+	in := []gamelogic.Unit{}
+	for _, unit := range units {
+		if unit.Location == location {
+			in = append(in, unit)
+		}
+	}
+	return in
+}
+
+func power(units []gamelogic.Unit) int {
+	m := map[int]gamelogic.Unit{}
+	for _, unit := range units {
+		m[unit.ID] = unit
+	}
+	return gamelogic.PowerLevel(gamelogic.Player{Units: m})
+}
+
+func pick[T any](rng *rand.Rand, options []T) T {
+	return options[rng.Intn(len(options))]
+}
@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+)
+
+func player(username string, units ...gamelogic.Unit) gamelogic.Player {
+	p := gamelogic.Player{Username: username, Units: map[int]gamelogic.Unit{}}
+	for _, unit := range units {
+		p.Units[unit.ID] = unit
+	}
+	return p
+}
+
+func unit(id int, rank gamelogic.UnitRank, location gamelogic.Location) gamelogic.Unit {
+	return gamelogic.Unit{ID: id, Rank: rank, Location: location}
+}
+
+func TestParseStrategy(t *testing.T) {
+	for _, name := range []string{"random", "aggressive", "defensive"} {
+		strategy, err := ParseStrategy(name)
+		if err != nil || strategy.Name() != name {
+			t.Errorf("ParseStrategy(%q) = %v, %v", name, strategy, err)
+		}
+	}
+	if _, err := ParseStrategy("cautious"); err == nil {
+		t.Error("ParseStrategy accepted cautious")
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		view     View
+		// want is the whole command, or its prefix when the rest is random
+		want []string
+		// exact compares the whole command instead of a prefix
+		exact bool
+	}{
+		{
+			name:     "random spawns its first unit",
+			strategy: Random{},
+			view:     View{Me: player("bot"), MaxUnits: 3},
+			want:     []string{"spawn"},
+		},
+		{
+			name:     "random moves at max units",
+			strategy: Random{},
+			view:     View{Me: player("bot", unit(1, gamelogic.RankInfantry, "asia")), MaxUnits: 1},
+			want:     []string{"move"},
+		},
+		{
+			name:     "random without units to spawn or move",
+			strategy: Random{},
+			view:     View{Me: player("bot"), MaxUnits: 0},
+		},
+		{
+			name:     "aggressive builds an army first",
+			strategy: Aggressive{},
+			view: View{
+				Me:        player("bot", unit(1, gamelogic.RankInfantry, "asia")),
+				Opponents: []gamelogic.Player{player("alice", unit(1, gamelogic.RankInfantry, "europe"))},
+				MaxUnits:  5,
+			},
+			want: []string{"spawn"},
+		},
+		{
+			name:     "aggressive spawns without opponents",
+			strategy: Aggressive{},
+			view: View{
+				Me:        player("bot", unit(1, gamelogic.RankInfantry, "asia"), unit(2, gamelogic.RankInfantry, "asia"), unit(3, gamelogic.RankInfantry, "asia")),
+				Opponents: []gamelogic.Player{player("alice")},
+				MaxUnits:  5,
+			},
+			want: []string{"spawn"},
+		},
+		{
+			name:     "aggressive attacks the weakest opponent",
+			strategy: Aggressive{},
+			view: View{
+				Me: player("bot", unit(1, gamelogic.RankInfantry, "asia"), unit(2, gamelogic.RankInfantry, "europe"), unit(3, gamelogic.RankInfantry, "africa")),
+				Opponents: []gamelogic.Player{
+					player("alice", unit(1, gamelogic.RankArtillery, "americas")),
+					player("bob", unit(1, gamelogic.RankInfantry, "europe")),
+				},
+				MaxUnits: 5,
+			},
+			want:  []string{"move", "europe", "1", "3"},
+			exact: true,
+		},
+		{
+			name:     "aggressive reinforces the front",
+			strategy: Aggressive{},
+			view: View{
+				Me:        player("bot", unit(1, gamelogic.RankInfantry, "europe"), unit(2, gamelogic.RankInfantry, "europe"), unit(3, gamelogic.RankInfantry, "europe")),
+				Opponents: []gamelogic.Player{player("bob", unit(1, gamelogic.RankInfantry, "europe"))},
+				MaxUnits:  5,
+			},
+			want: []string{"spawn", "europe"},
+		},
+		{
+			name:     "aggressive waits at max units",
+			strategy: Aggressive{},
+			view: View{
+				Me:        player("bot", unit(1, gamelogic.RankInfantry, "europe")),
+				Opponents: []gamelogic.Player{player("bob", unit(1, gamelogic.RankInfantry, "europe"))},
+				MaxUnits:  1,
+			},
+		},
+		{
+			name:     "defensive starts with artillery",
+			strategy: Defensive{},
+			view:     View{Me: player("bot"), MaxUnits: 3},
+			want:     []string{"spawn"},
+		},
+		{
+			name:     "defensive gathers stragglers home",
+			strategy: Defensive{},
+			view: View{
+				Me:       player("bot", unit(1, gamelogic.RankArtillery, "asia"), unit(2, gamelogic.RankInfantry, "europe")),
+				MaxUnits: 3,
+			},
+			want:  []string{"move", "asia", "2"},
+			exact: true,
+		},
+		{
+			name:     "defensive grows at home",
+			strategy: Defensive{},
+			view: View{
+				Me:        player("bot", unit(1, gamelogic.RankArtillery, "asia")),
+				Opponents: []gamelogic.Player{player("alice", unit(1, gamelogic.RankInfantry, "asia"))},
+				MaxUnits:  3,
+			},
+			want: []string{"spawn", "asia"},
+		},
+		{
+			name:     "defensive waits at max units",
+			strategy: Defensive{},
+			view:     View{Me: player("bot", unit(1, gamelogic.RankArtillery, "asia")), MaxUnits: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.strategy.Next(tt.view, rand.New(rand.NewSource(1)))
+			if tt.exact || len(tt.want) == 0 {
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("Next = %q, want %q", got, tt.want)
+				}
+				return
+			}
+			if len(got) < len(tt.want) || !slices.Equal(got[:len(tt.want)], tt.want) {
+				t.Errorf("Next = %q, want it to start with %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefensiveRetreats(t *testing.T) {
+	view := View{
+		Me: player("bot", unit(1, gamelogic.RankInfantry, "asia"), unit(2, gamelogic.RankInfantry, "europe")),
+		Opponents: []gamelogic.Player{
+			player("alice", unit(1, gamelogic.RankArtillery, "asia")),
+			player("bob", unit(1, gamelogic.RankInfantry, "africa"), unit(2, gamelogic.RankInfantry, "americas")),
+		},
+		MaxUnits: 3,
+	}
+	held := []string{"asia", "africa", "americas"}
+	for seed := int64(0); seed < 20; seed++ {
+		got := Defensive{}.Next(view, rand.New(rand.NewSource(seed)))
+		if len(got) != 4 || got[0] != "move" || slices.Contains(held, got[1]) || strings.Join(got[2:], " ") != "1 2" {
+			t.Fatalf("seed %d: Next = %q, want all units moved to a location no opponent holds", seed, got)
+		}
+	}
+}
+
+func TestSeededBotsRepeat(t *testing.T) {
+	view := View{
+		Me:        player("bot", unit(1, gamelogic.RankInfantry, "asia"), unit(2, gamelogic.RankCavalry, "europe")),
+		Opponents: []gamelogic.Player{player("alice", unit(1, gamelogic.RankInfantry, "africa"))},
+		MaxUnits:  5,
+	}
+	for _, strategy := range []Strategy{Random{}, Aggressive{}, Defensive{}} {
+		first := strategy.Next(view, rand.New(rand.NewSource(7)))
+		for i := 0; i < 5; i++ {
+			if got := strategy.Next(view, rand.New(rand.NewSource(7))); !slices.Equal(got, first) {
+				t.Errorf("%s: Next = %q, then %q with the same seed", strategy.Name(), first, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package broker holds the settings used to connect to RabbitMQ.
+//
+// Settings come from, in increasing order of precedence, the defaults, a
+// config file, PERIL_AMQP_* environment variables and command line flags
+package broker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const redacted = "xxxxx"
+
+// Config describes how to reach and authenticate with the broker
+type Config struct {
+	URL            string // amqp:// or amqps://, may carry the credentials and vhost
+	Username       string // overrides the username in URL
+	Password       string // overrides the password in URL
+	Vhost          string // overrides the vhost in URL
+	ConnectionName string // shown for the connection in the management UI
+	Heartbeat      time.Duration
+	Locale         string
+
+	CACert             string // PEM file with the CAs trusted to sign the broker certificate, empty uses the system pool
+	ClientCert         string // PEM file with the certificate presented to the broker
+	ClientKey          string // PEM file with the key of ClientCert
+	ServerName         string // name expected in the broker certificate, defaults to the URL host
+	InsecureSkipVerify bool
+}
+
+func DefaultConfig(connectionName string) Config {
+	return Config{
+		URL:            "amqp://localhost:5672/",
+		ConnectionName: connectionName,
+		Heartbeat:      10 * time.Second,
+		Locale:         "en_US",
+	}
+}
+
+// Validate reports the first setting that would keep us from connecting
+func (c Config) Validate() error {
+	uri, err := amqp.ParseURI(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url %s: %v", redactURL(c.URL), urlError(err))
+	}
+	if c.Username != "" && c.Password == "" {
+		return errors.New("a username was set without a password")
+	}
+	if c.Username == "" && c.Password != "" {
+		return errors.New("a password was set without a username")
+	}
+	if c.Heartbeat < 0 {
+		return errors.New("heartbeat can not be negative")
+	}
+	if c.Locale == "" {
+		return errors.New("locale can not be empty")
+	}
+
+	usesTLS := c.CACert != "" || c.ClientCert != "" || c.ClientKey != "" || c.ServerName != "" || c.InsecureSkipVerify
+	if usesTLS && uri.Scheme != "amqps" {
+		return fmt.Errorf("TLS settings require an amqps:// url, got %s://", uri.Scheme)
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.New("a client certificate and its key must be set together")
+	}
+	if uri.Scheme == "amqps" {
+		if _, err := c.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dial validates the config and opens a connection with it
+func (c Config) Dial() (*amqp.Connection, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	properties := amqp.NewConnectionProperties()
+	if c.ConnectionName != "" {
+		properties.SetClientConnectionName(c.ConnectionName)
+	}
+	config := amqp.Config{
+		Vhost:      c.Vhost,
+		Heartbeat:  c.Heartbeat,
+		Locale:     c.Locale,
+		Properties: properties,
+	}
+	if c.Username != "" {
+		config.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: c.Username, Password: c.Password}}
+	}
+	if strings.HasPrefix(c.URL, "amqps://") {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.TLSClientConfig = tlsConfig
+	}
+
+	connection, err := amqp.DialConfig(c.URL, config)
+	if err != nil {
+		dials.Inc("error")
+		return nil, fmt.Errorf("could not connect to %s: %v", c, err)
+	}
+	dials.Inc("ok")
+	recordReconnect()
+	go watchConnection(connection)
+	return connection, nil
+}
+
+func (c Config) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// String describes the connection without its password, so it is safe to log
+func (c Config) String() string {
+	uri, err := amqp.ParseURI(c.URL)
+	if err != nil {
+		return redactURL(c.URL)
+	}
+	username := uri.Username
+	if c.Username != "" {
+		username = c.Username
+	}
+	vhost := uri.Vhost
+	if c.Vhost != "" {
+		vhost = c.Vhost
+	}
+	return fmt.Sprintf("%s://%s@%s:%d vhost %q", uri.Scheme, username, uri.Host, uri.Port, vhost)
+}
+
+// urlError drops the url net/url quotes in its errors, it may hold a password
+func urlError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// redactURL hides the password of a url that might not even parse
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<unparsable url>"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
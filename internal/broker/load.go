@@ -0,0 +1,185 @@
+package broker
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	flagPrefix = "amqp-"
+	envPrefix  = "PERIL_AMQP_"
+	// path of the config file, also settable with -amqp-config
+	ConfigEnv = envPrefix + "CONFIG"
+)
+
+// setting is one Config field. Its name is the key in the config file, the
+// flag is the name prefixed with amqp- and the variable is the upper cased
+// name prefixed with PERIL_AMQP_
+type setting struct {
+	name   string
+	usage  string
+	secret bool
+	value  func(c *Config) flag.Value
+}
+
+var settings = []setting{
+	{name: "url", usage: "broker `url`, amqp://host:port/vhost or amqps:// for TLS", value: func(c *Config) flag.Value { return (*stringValue)(&c.URL) }},
+	{name: "username", usage: "`username`, overrides the one in the url", value: func(c *Config) flag.Value { return (*stringValue)(&c.Username) }},
+	{name: "password", usage: "`password`, overrides the one in the url, prefer the environment or config file over this flag", secret: true, value: func(c *Config) flag.Value { return (*stringValue)(&c.Password) }},
+	{name: "vhost", usage: "virtual `host`, overrides the one in the url", value: func(c *Config) flag.Value { return (*stringValue)(&c.Vhost) }},
+	{name: "connection-name", usage: "connection `name` shown by the broker", value: func(c *Config) flag.Value { return (*stringValue)(&c.ConnectionName) }},
+	{name: "heartbeat", usage: "heartbeat `interval`, below 1s uses the broker's", value: func(c *Config) flag.Value { return (*durationValue)(&c.Heartbeat) }},
+	{name: "locale", usage: "connection `locale`", value: func(c *Config) flag.Value { return (*stringValue)(&c.Locale) }},
+	{name: "ca-cert", usage: "PEM `file` with the CA certificates trusted for amqps://, empty uses the system ones", value: func(c *Config) flag.Value { return (*stringValue)(&c.CACert) }},
+	{name: "client-cert", usage: "PEM `file` with the client certificate for amqps://", value: func(c *Config) flag.Value { return (*stringValue)(&c.ClientCert) }},
+	{name: "client-key", usage: "PEM `file` with the key of the client certificate", value: func(c *Config) flag.Value { return (*stringValue)(&c.ClientKey) }},
+	{name: "server-name", usage: "`name` expected in the broker certificate, defaults to the url host", value: func(c *Config) flag.Value { return (*stringValue)(&c.ServerName) }},
+	{name: "insecure-skip-verify", usage: "do not verify the broker certificate, for testing only", value: func(c *Config) flag.Value { return (*boolValue)(&c.InsecureSkipVerify) }},
+}
+
+func (s setting) flag() string {
+	return flagPrefix + s.name
+}
+
+func (s setting) env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+// Flags registers the connection flags on fs and returns the function that
+// builds the final config once fs has been parsed
+func Flags(fs *flag.FlagSet, defaults Config) func() (Config, error) {
+	flagged := defaults
+	for _, s := range settings {
+		fs.Var(s.value(&flagged), s.flag(), fmt.Sprintf("%s (env $%s)", s.usage, s.env()))
+	}
+	configPath := fs.String(flagPrefix+"config", os.Getenv(ConfigEnv), "`file` with one \"name = value\" broker setting per line, names are the amqp- flags without the prefix (env $"+ConfigEnv+")")
+
+	return func() (Config, error) {
+		config := defaults
+		if *configPath != "" {
+			if err := loadFile(*configPath, &config); err != nil {
+				return Config{}, err
+			}
+		}
+		if err := loadEnv(&config); err != nil {
+			return Config{}, err
+		}
+
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			for _, s := range settings {
+				if f.Name == s.flag() && err == nil {
+					err = s.value(&config).Set(f.Value.String())
+				}
+			}
+		})
+		if err != nil {
+			return Config{}, err
+		}
+
+		if err := config.Validate(); err != nil {
+			return Config{}, err
+		}
+		return config, nil
+	}
+}
+
+func loadEnv(config *Config) error {
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		if err := s.value(config).Set(value); err != nil {
+			return fmt.Errorf("invalid $%s: %v", s.env(), describe(s, value, err))
+		}
+	}
+	return nil
+}
+
+func loadFile(path string, config *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open broker config: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected name = value", path, lineNumber)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+		s, ok := lookupSetting(name)
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, lineNumber, name)
+		}
+		if err := s.value(config).Set(value); err != nil {
+			return fmt.Errorf("%s:%d: invalid %s: %v", path, lineNumber, name, describe(s, value, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read broker config: %v", err)
+	}
+	return nil
+}
+
+func lookupSetting(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// describe keeps secrets out of errors about their values
+func describe(s setting, value string, err error) string {
+	if s.secret {
+		return "invalid value"
+	}
+	return fmt.Sprintf("%q: %v", value, err)
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) IsBoolFlag() bool { return true }
@@ -0,0 +1,176 @@
+package broker
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every broker variable for the test, so the environment
+// running the tests can not leak into them
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range append([]string{ConfigEnv}, envNames()...) {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func envNames() []string {
+	names := []string{}
+	for _, s := range settings {
+		names = append(names, s.env())
+	}
+	return names
+}
+
+func TestFlagsPrecedence(t *testing.T) {
+	defaults := DefaultConfig("peril-test")
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		check   func(Config) bool
+		wantErr string
+	}{
+		{
+			name:  "defaults",
+			check: func(c Config) bool { return c == defaults },
+		},
+		{
+			name: "file over defaults",
+			file: "# broker\nurl = amqp://rabbit:5672/\n\nheartbeat = 30s\nconnection-name=from-file\n",
+			check: func(c Config) bool {
+				return c.URL == "amqp://rabbit:5672/" && c.Heartbeat == 30*time.Second && c.ConnectionName == "from-file" && c.Locale == "en_US"
+			},
+		},
+		{
+			name: "env over file",
+			file: "url = amqp://rabbit:5672/\nvhost = file\n",
+			env:  map[string]string{"PERIL_AMQP_VHOST": "env", "PERIL_AMQP_CONNECTION_NAME": "from-env"},
+			check: func(c Config) bool {
+				return c.URL == "amqp://rabbit:5672/" && c.Vhost == "env" && c.ConnectionName == "from-env"
+			},
+		},
+		{
+			name:  "flags over env",
+			env:   map[string]string{"PERIL_AMQP_VHOST": "env", "PERIL_AMQP_HEARTBEAT": "5s"},
+			args:  []string{"-amqp-vhost", "flag"},
+			check: func(c Config) bool { return c.Vhost == "flag" && c.Heartbeat == 5*time.Second },
+		},
+		{
+			name:  "flag set to its default still wins",
+			env:   map[string]string{"PERIL_AMQP_LOCALE": "de_DE"},
+			args:  []string{"-amqp-locale", "en_US"},
+			check: func(c Config) bool { return c.Locale == "en_US" },
+		},
+		{
+			name:  "credentials",
+			file:  "username = peril\npassword = s3cret\n",
+			check: func(c Config) bool { return c.Username == "peril" && c.Password == "s3cret" },
+		},
+		{
+			name:  "bool flag",
+			args:  []string{"-amqp-url", "amqps://rabbit:5671/", "-amqp-insecure-skip-verify"},
+			check: func(c Config) bool { return c.InsecureSkipVerify },
+		},
+		{
+			name:    "unknown file setting",
+			file:    "url = amqp://rabbit:5672/\nport = 5672\n",
+			wantErr: `:2: unknown setting "port"`,
+		},
+		{
+			name:    "file line without value",
+			file:    "url\n",
+			wantErr: ":1: expected name = value",
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"PERIL_AMQP_HEARTBEAT": "often"},
+			wantErr: "invalid $PERIL_AMQP_HEARTBEAT",
+		},
+		{
+			name:    "empty password from env",
+			file:    "username = peril\n",
+			env:     map[string]string{"PERIL_AMQP_PASSWORD": ""},
+			wantErr: "username was set without a password",
+		},
+		{
+			name:    "the result is validated",
+			args:    []string{"-amqp-url", "http://rabbit/"},
+			wantErr: "invalid url",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "broker.conf")
+				if err := os.WriteFile(path, []byte(tt.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-amqp-config", path}, args...)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			load := Flags(fs, defaults)
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			config, err := load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(config) {
+				t.Errorf("unexpected config %+v", config)
+			}
+		})
+	}
+}
+
+func TestConfigFileFromEnv(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "broker.conf")
+	if err := os.WriteFile(path, []byte("vhost = from-env-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ConfigEnv, path)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	load := Flags(fs, DefaultConfig("peril-test"))
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	config, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Vhost != "from-env-file" {
+		t.Errorf("vhost %q, want the one of $%s", config.Vhost, ConfigEnv)
+	}
+}
+
+func TestDescribeHidesSecrets(t *testing.T) {
+	for _, s := range settings {
+		got := describe(s, "hunter2", os.ErrInvalid)
+		if strings.Contains(got, "hunter2") != !s.secret {
+			t.Errorf("describe of %s = %q, secret %v", s.name, got, s.secret)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package broker
+
+import (
+	"sync/atomic"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Connections are not reestablished automatically, a process connecting
+// again after losing its connection counts as a reconnect
+var (
+	dials = metrics.NewCounter("peril_amqp_dials_total",
+		"Attempts to connect to the broker, by result", "result")
+	connectionsLost = metrics.NewCounter("peril_amqp_connections_lost_total",
+		"Broker connections closed by an error rather than by us")
+	reconnects = metrics.NewCounter("peril_amqp_reconnects_total",
+		"Connections to the broker replacing one that was lost")
+)
+
+// lost is the number of lost connections not replaced yet
+var lost atomic.Int64
+
+func watchConnection(conn *amqp.Connection) {
+	// the channel is closed without an error when we close the connection
+	if err, ok := <-conn.NotifyClose(make(chan *amqp.Error, 1)); ok && err != nil {
+		connectionsLost.Inc()
+		lost.Add(1)
+	}
+}
+
+// recordReconnect counts a new connection as a reconnect when it replaces
+// a lost one
+func recordReconnect() {
+	for {
+		n := lost.Load()
+		if n <= 0 {
+			return
+		}
+		if lost.CompareAndSwap(n, n-1) {
+			reconnects.Inc()
+			return
+		}
+	}
+}
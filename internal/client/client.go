@@ -0,0 +1,237 @@
+// Package client plays Peril for one registered player. The command line
+// client and the scenario runner both drive it
+package client
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// What to do with a saved game
+const (
+	ResumeAsk = "ask"
+	ResumeYes = "yes"
+	ResumeNo  = "no"
+)
+
+type Config struct {
+	Username string
+	SaveDir  string
+	Resume   string      // ResumeAsk, ResumeYes or ResumeNo
+	Verify   auth.Policy // what to do with messages with a missing or bad signature
+	// Rejected is asked for another username when the server rejects one.
+	// When nil a rejection fails Start
+	Rejected func(username, reason string) (string, error)
+	// Renderer shows the game to the player, the console when nil
+	Renderer gamelogic.Renderer
+	Game     routing.Game
+}
+
+// Client is a player registered with the server and subscribed to the game
+type Client struct {
+	conn     *amqp.Connection
+	gs       *gamelogic.GameState
+	pub      publisher
+	roster   *gamelogic.Roster
+	savePath string
+	stop     chan struct{}
+	closing  sync.Once
+
+	kicked     chan struct{}
+	kickReason string // set before kicked is closed
+}
+
+// Start registers cfg.Username with the server, joins the game and keeps
+// the player's presence and save up to date until Close
+func Start(conn *amqp.Connection, cfg Config) (*Client, error) {
+	if cfg.Resume != ResumeAsk && cfg.Resume != ResumeYes && cfg.Resume != ResumeNo {
+		return nil, fmt.Errorf("invalid resume %q, expected ask, yes or no", cfg.Resume)
+	}
+
+	userName, registration, err := register(conn, cfg.Game, cfg.Username, cfg.Rejected)
+	if err != nil {
+		return nil, fmt.Errorf("could not register with the server: %v", err)
+	}
+	signer, err := auth.NewSigner(userName, registration.KeyID, registration.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key from the server: %v", err)
+	}
+	serverKey := ed25519.PublicKey(registration.ServerKey)
+	keyring := newKeyring(conn, cfg.Game, serverKey)
+
+	// Declare for direct exchange for pause messages
+	channel, _, err := pubsub.DeclareAndBind(
+		conn,
+		routing.ExchangePerilDirect,
+		cfg.Game.Key(routing.PauseKey+"."+userName),
+		cfg.Game.Key(routing.PauseKey),
+		pubsub.QueueTransient)
+	if err != nil {
+		return nil, fmt.Errorf("could not declare pause queue: %v", err)
+	}
+	pub := publisher{channel: channel, game: cfg.Game, username: userName, session: &sessionToken{token: registration.Token, expiresAt: registration.ExpiresAt}, signer: signer}
+
+	// learn keys of players joining or rotating keys after us
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.KeysPrefix+"."+userName),
+		cfg.Game.Key(routing.KeysPrefix+".*"),
+		pubsub.QueueTransient,
+		handlerKeyAnnouncement(keyring, serverKey),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to key announcements: %v", err)
+	}
+
+	gameState := gamelogic.NewGameState(userName)
+	if cfg.Renderer != nil {
+		gameState.SetRenderer(cfg.Renderer)
+	}
+	savePath := gamelogic.SavePath(gameSaveDir(cfg.SaveDir, cfg.Game), userName)
+	if err := offerResume(gameState, savePath, cfg.Resume); err != nil {
+		slog.Error("could not resume saved game", "err", err)
+	}
+	// joining while paused, the next broadcast may be a long way off. The
+	// server's state also overrides the paused flag of a save, which may be
+	// older than the last pause or resume
+	if registration.State.IsPaused || gameState.Snapshot().Paused {
+		gameState.HandlePause(registration.State)
+	}
+
+	err = pubsub.SubscribeJSON(conn,
+		routing.ExchangePerilDirect,
+		cfg.Game.Key(routing.PauseKey+"."+userName),
+		cfg.Game.Key(routing.PauseKey),
+		pubsub.QueueTransient,
+		handlerPause(gameState),
+		pubsub.WithVerifier(keyring.Verifier(cfg.Verify, auth.SignedBy(session.ServerUsername))),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to pause: %v", err)
+	}
+
+	roster := gamelogic.NewRoster(gamelogic.PresenceTimeout)
+
+	//Subscribe to join, leave and heartbeats of other players
+	err = pubsub.SubscribeJSONContext(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.PresenceKey+"."+userName),
+		cfg.Game.Key(routing.PresenceKey+".*"),
+		pubsub.QueueTransient,
+		handlerPresence(gameState, roster),
+		pubsub.WithSigner(keyring.Identify(cfg.Verify, auth.SignerOwnsKey)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to presence: %v", err)
+	}
+
+	//Subscribe to moves from other players exchange army_moves.*
+	err = pubsub.SubscribeJSONContext(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.ArmyMovesPrefix+"."+userName),
+		cfg.Game.Key(routing.ArmyMovesPrefix+".*"),
+		pubsub.QueueTransient,
+		handlerMove(gameState, roster, pub),
+		pubsub.WithSigner(keyring.Identify(cfg.Verify, auth.SignerOwnsKey)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to army moves: %v", err)
+	}
+
+	//Subscribe to all war events
+	err = pubsub.SubscribeJSONContext(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.WarRecognitionsPrefix),
+		cfg.Game.Key(routing.WarRecognitionsPrefix+".#"),
+		pubsub.QueueDurable,
+		handlerWar(gameState, pub),
+		pubsub.WithSigner(keyring.Identify(cfg.Verify, auth.AnySigner)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to war events: %v", err)
+	}
+
+	if err := pub.gameLog(gamelogic.NewJoinLog(userName)); err != nil {
+		slog.Warn("could not publish join log", "err", err)
+	}
+
+	// the snapshot in the join shows others the army restored from a save,
+	// moves would make them fight over units that did not move
+	if err := publishPresence(gameState, pub, gamelogic.PresenceJoin); err != nil {
+		slog.Warn("could not announce joining", "err", err)
+	}
+
+	c := &Client{
+		conn:     conn,
+		gs:       gameState,
+		pub:      pub,
+		roster:   roster,
+		savePath: savePath,
+		stop:     make(chan struct{}),
+		kicked:   make(chan struct{}),
+	}
+
+	// only the server may send admin commands
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		cfg.Game.Key(routing.AdminPrefix+"."+userName),
+		cfg.Game.Key(routing.AdminPrefix+"."+userName),
+		pubsub.QueueTransient,
+		handlerAdmin(c),
+		pubsub.WithVerifier(keyring.Verifier(cfg.Verify, auth.SignedBy(session.ServerUsername))),
+	)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("could not subscribe to admin commands: %v", err)
+	}
+	go autosave(gameState, savePath, c.stop)
+	go heartbeat(gameState, pub, c.stop)
+	go renewSession(conn, pub, c.stop)
+	return c, nil
+}
+
+func (c *Client) Username() string {
+	return c.pub.username
+}
+
+// Game is the game the player joined
+func (c *Client) Game() routing.Game {
+	return c.pub.game
+}
+
+// Kicked is closed once an admin kicked the player, who has left the game
+// by then
+func (c *Client) Kicked() <-chan struct{} {
+	return c.kicked
+}
+
+// KickReason is why the player was kicked, valid once Kicked is closed
+func (c *Client) KickReason() string {
+	return c.kickReason
+}
+
+// State is the player's side of the game
+func (c *Client) State() *gamelogic.GameState {
+	return c.gs
+}
+
+// Players returns the other players still sending heartbeats
+func (c *Client) Players() []gamelogic.PlayerInfo {
+	c.roster.Expire(time.Now())
+	return c.roster.Players()
+}
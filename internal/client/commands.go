@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/tracing"
+)
+
+// Commands lists the commands Run understands
+var Commands = []string{"spawn", "move", "status", "players", "save", "rotate", "wait", "spam", "help", "quit"}
+
+// ErrQuit is returned by Run for the quit command
+var ErrQuit = errors.New("quit")
+
+// ErrKicked is returned by Run once an admin kicked the player
+var ErrKicked = errors.New("you were kicked from the game")
+
+// Run executes one command. It returns ErrQuit for the quit command
+func (c *Client) Run(words []string) error {
+	userName := c.pub.username
+	select {
+	case <-c.kicked:
+		return ErrKicked
+	default:
+	}
+
+	switch words[0] {
+	case "spawn":
+		ctx, span := tracing.Start(context.Background(), "spawn command", tracing.SpanContext{})
+		defer span.End()
+		unit, err := c.gs.CommandSpawn(words)
+		if err != nil {
+			span.Fail(err)
+			return fmt.Errorf("could not spawn unit: %v", err)
+		}
+		if err := c.pub.in(ctx).gameLog(gamelogic.NewSpawnLog(userName, unit)); err != nil {
+			slog.Warn("could not publish spawn log", "err", err)
+		}
+
+	case "move":
+		// a move starts the trace of every war it leads to
+		ctx, span := tracing.Start(context.Background(), "move command", tracing.SpanContext{})
+		defer span.End()
+		pub := c.pub.in(ctx)
+		armyMove, err := c.gs.CommandMove(words)
+		if err != nil {
+			span.Fail(err)
+			return fmt.Errorf("could not move unit: %v", err)
+		}
+		// publish move message to all subscribents
+		err = pubsub.PublishJSON(pub.channel, routing.ExchangePerilTopic, pub.game.Key(routing.ArmyMovesPrefix+"."+userName), armyMove, pub.options()...)
+		if err != nil {
+			span.Fail(err)
+			return fmt.Errorf("publishing move failed: %v", err)
+		}
+		slog.Debug("published move", "units", len(armyMove.Units), "location", armyMove.ToLocation)
+		if err := pub.gameLog(gamelogic.NewMoveLog(armyMove)); err != nil {
+			slog.Warn("could not publish move log", "err", err)
+		}
+
+	case "status":
+		c.gs.CommandStatus()
+
+	case "save":
+		if err := gamelogic.SaveGame(c.savePath, c.gs.Snapshot()); err != nil {
+			return fmt.Errorf("could not save game: %v", err)
+		}
+		c.gs.Render(gamelogic.Notice{Text: "Game saved to " + c.savePath})
+
+	case "players":
+		c.gs.Render(gamelogic.PlayersListed{Players: c.Players()})
+
+	case "rotate":
+		keyID, err := commandRotate(c.conn, c.pub)
+		if err != nil {
+			return fmt.Errorf("could not rotate signing key: %v", err)
+		}
+		c.gs.Render(gamelogic.Notice{Text: "Now signing with key " + keyID})
+
+	case "wait":
+		if len(words) != 2 {
+			return errors.New("usage: wait <duration>")
+		}
+		d, err := time.ParseDuration(words[1])
+		if err != nil || d < 0 {
+			return fmt.Errorf("error: %s is not a valid duration", words[1])
+		}
+		time.Sleep(d)
+
+	case "help":
+		gamelogic.PrintClientHelp()
+
+	case "spam":
+		if err := commandSpam(c.conn, c.pub, words); err != nil {
+			return fmt.Errorf("could not spam: %v", err)
+		}
+
+	case "quit":
+		return ErrQuit
+
+	default:
+		return fmt.Errorf("unknown command %s", words[0])
+	}
+	return nil
+}
+
+// Close stops the heartbeats, tells everyone the player is gone and saves
+// their game. Later calls do nothing
+func (c *Client) Close() {
+	c.closing.Do(c.leave)
+}
+
+func (c *Client) leave() {
+	close(c.stop)
+	if err := c.pub.gameLog(gamelogic.NewLeaveLog(c.pub.username)); err != nil {
+		slog.Warn("could not publish leave log", "err", err)
+	}
+	if err := publishPresence(c.gs, c.pub, gamelogic.PresenceLeave); err != nil {
+		slog.Warn("could not announce leaving", "err", err)
+	}
+	if err := gamelogic.SaveGame(c.savePath, c.gs.Snapshot()); err != nil {
+		slog.Error("could not save game", "err", err)
+	}
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// HANDLERS FOR PUBLISHED MOVES
+func handlerPause(gs *gamelogic.GameState) func(routing.PlayingState) pubsub.Acktype {
+
+	return func(ps routing.PlayingState) pubsub.Acktype {
+		// the server logs the pause, once for everyone
+		gs.HandlePause(ps)
+		return pubsub.Ack
+	}
+
+}
+
+func handlerMove(gs *gamelogic.GameState, roster *gamelogic.Roster, pub publisher) func(context.Context, gamelogic.ArmyMove) pubsub.Acktype {
+
+	return func(ctx context.Context, mv gamelogic.ArmyMove) pubsub.Acktype {
+		pub := pub.in(ctx)
+		// wars are fought with the snapshot in the move
+		if err := auth.SignedAs(ctx, mv.Player.Username); err != nil {
+			slog.Warn("discarding move", "err", err)
+			return pubsub.NackDiscard
+		}
+		if mv.Player.Username != gs.GetUsername() {
+			roster.SeeMove(mv)
+		}
+		moveOutcome := gs.HandleMove(mv)
+		switch moveOutcome {
+		case gamelogic.MoveOutcomeSamePlayer:
+			return pubsub.NackDiscard
+		case gamelogic.MoveOutComeSafe:
+			return pubsub.Ack
+		case gamelogic.MoveOutcomeMakeWar:
+			// Send war message to game exchange to War routing key
+			err := pubsub.PublishJSON(
+				pub.channel,
+				routing.ExchangePerilTopic,
+				pub.game.Key(routing.WarRecognitionsPrefix+"."+mv.Player.Username),
+				gamelogic.RecognitionOfWar{Attacker: mv.Player, Defender: gs.Player},
+				pub.options()...,
+			)
+			if err != nil {
+				gs.Render(gamelogic.Notice{Text: fmt.Sprintf("error: %s", err)})
+				return pubsub.NackRequeue
+			}
+			return pubsub.Ack
+
+		}
+
+		gs.Render(gamelogic.Notice{Text: "error: unknown move outcome"})
+		return pubsub.NackDiscard
+	}
+}
+
+func handlerPresence(gs *gamelogic.GameState, roster *gamelogic.Roster) func(context.Context, gamelogic.Presence) pubsub.Acktype {
+
+	return func(ctx context.Context, p gamelogic.Presence) pubsub.Acktype {
+		if err := auth.SignedAs(ctx, p.Player.Username); err != nil {
+			slog.Warn("discarding presence", "err", err)
+			return pubsub.NackDiscard
+		}
+		if p.Player.Username == gs.GetUsername() {
+			return pubsub.Ack
+		}
+
+		changed := false
+		switch p.Status {
+		case gamelogic.PresenceLeave:
+			changed = roster.Remove(p.Player.Username)
+		case gamelogic.PresenceJoin:
+			roster.Update(p)
+			changed = true
+		default:
+			changed = roster.Update(p)
+		}
+		if changed {
+			gs.Render(gamelogic.PresenceChanged{Username: p.Player.Username, Status: p.Status})
+		}
+		return pubsub.Ack
+	}
+}
+
+func handlerWar(gs *gamelogic.GameState, pub publisher) func(context.Context, gamelogic.RecognitionOfWar) pubsub.Acktype {
+
+	return func(ctx context.Context, war gamelogic.RecognitionOfWar) pubsub.Acktype {
+		pub := pub.in(ctx)
+		// only the defender who saw the move recognizes the war
+		if err := auth.SignedAs(ctx, war.Defender.Username); err != nil {
+			slog.Warn("discarding war", "err", err)
+			return pubsub.NackDiscard
+		}
+		warOutcome, warWinner, warLoser := gs.HandleWar(war)
+
+		switch warOutcome {
+		case gamelogic.WarOutcomeNotInvolved:
+			return pubsub.NackRequeue
+
+		case gamelogic.WarOutcomeNoUnits:
+			return pubsub.NackDiscard
+
+		case gamelogic.WarOutcomeOpponentWon, gamelogic.WarOutcomeYouWon, gamelogic.WarOutcomeDraw:
+			gameLog := gamelogic.NewWarLog(gs.GetUsername(), war, warOutcome, warWinner, warLoser)
+			if err := pub.gameLog(gameLog); err != nil {
+				return pubsub.NackRequeue
+			}
+			return pubsub.Ack
+
+		default:
+			gs.Render(gamelogic.Notice{Text: "error: unknown war outcome"})
+			return pubsub.NackDiscard
+		}
+	}
+}
+
+func handlerAdmin(c *Client) func(routing.AdminCommand) pubsub.Acktype {
+
+	return func(cmd routing.AdminCommand) pubsub.Acktype {
+		if cmd.Action != routing.AdminKick {
+			if err := c.gs.HandleAdmin(cmd); err != nil {
+				c.gs.Render(gamelogic.Notice{Text: fmt.Sprintf("could not apply admin command: %v", err)})
+				return pubsub.NackDiscard
+			}
+			return pubsub.Ack
+		}
+
+		select {
+		case <-c.kicked:
+			return pubsub.Ack
+		default:
+		}
+		text := "An admin kicked you from the game"
+		if cmd.Reason != "" {
+			text += ": " + cmd.Reason
+		}
+		c.gs.Render(gamelogic.Notice{Text: text})
+		c.Close()
+		c.kickReason = cmd.Reason
+		close(c.kicked)
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ListGames asks the lobby which games are running
+func ListGames(conn *amqp.Connection) ([]routing.GameSummary, error) {
+	return askLobby(conn, routing.LobbyRequest{Action: routing.LobbyList})
+}
+
+// CreateGame asks the lobby to start game and returns the running games.
+// key is the create key the servers were started with
+func CreateGame(conn *amqp.Connection, game routing.Game, key string) ([]routing.GameSummary, error) {
+	if game == routing.DefaultGame {
+		return nil, errors.New("the default game always exists")
+	}
+	return askLobby(conn, routing.LobbyRequest{Action: routing.LobbyCreate, Game: string(game), Key: key})
+}
+
+func askLobby(conn *amqp.Connection, req routing.LobbyRequest) ([]routing.GameSummary, error) {
+	reply, err := pubsub.RequestJSON[routing.LobbyRequest, routing.LobbyReply](
+		conn,
+		routing.ExchangePerilDirect,
+		routing.LobbyKey,
+		req,
+		registrationTimeout,
+	)
+	if errors.Is(err, pubsub.ErrNoResponder) || errors.Is(err, pubsub.ErrRequestTimeout) {
+		return nil, fmt.Errorf("no lobby answered, is the Peril server running? (%v)", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !reply.Accepted {
+		return nil, fmt.Errorf("the lobby refused: %s", reply.Reason)
+	}
+	return reply.Games, nil
+}
+
+// gameSaveDir keeps the saves of named games apart, players may use the
+// same name in several games
+func gameSaveDir(dir string, game routing.Game) string {
+	if game == routing.DefaultGame {
+		return dir
+	}
+	return filepath.Join(dir, "games", string(game))
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func publishPresence(gs *gamelogic.GameState, pub publisher, status gamelogic.PresenceStatus) error {
+	return pubsub.PublishJSON(
+		pub.channel,
+		routing.ExchangePerilTopic,
+		pub.game.Key(routing.PresenceKey+"."+gs.GetUsername()),
+		gs.NewPresence(status),
+		pub.options()...,
+	)
+}
+
+// heartbeat keeps announcing the player until stop is closed
+func heartbeat(gs *gamelogic.GameState, pub publisher, stop <-chan struct{}) {
+	ticker := time.NewTicker(gamelogic.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := publishPresence(gs, pub, gamelogic.PresenceHeartbeat); err != nil {
+				slog.Warn("could not publish heartbeat", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+)
+
+const autosaveInterval = 30 * time.Second
+
+// offerResume restores the saved game at path if there is one and resume
+// is "yes", or it is "ask" and the player wants it
+func offerResume(gs *gamelogic.GameState, path, resume string) error {
+	if resume == ResumeNo {
+		return nil
+	}
+	save, err := gamelogic.LoadGame(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resume == ResumeAsk && !gamelogic.AskResume(save) {
+		return nil
+	}
+	if err := gs.Restore(save); err != nil {
+		return err
+	}
+	gs.Render(gamelogic.Notice{Text: fmt.Sprintf("Resumed your game with %d unit(s).", len(save.Units))})
+	return nil
+}
+
+// autosave snapshots the game to path until stop is closed
+func autosave(gs *gamelogic.GameState, path string, stop <-chan struct{}) {
+	ticker := time.NewTicker(autosaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := gamelogic.SaveGame(path, gs.Snapshot()); err != nil {
+				slog.Error("could not autosave game", "err", err)
+			}
+		}
+	}
+}
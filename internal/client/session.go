@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const registrationTimeout = 5 * time.Second
+
+// sessions are renewed this long before they expire
+const renewBefore = time.Hour
+
+// how long to wait before trying to renew a session again
+const renewRetry = time.Minute
+
+// sessionToken is the player's session, replaced when it is renewed
+type sessionToken struct {
+	mu        sync.RWMutex
+	token     string
+	expiresAt time.Time
+}
+
+func (s *sessionToken) get() (string, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token, s.expiresAt
+}
+
+func (s *sessionToken) set(token string, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	s.expiresAt = expiresAt
+}
+
+// publisher publishes on behalf of a registered player. Every message
+// carries the player's session token
+type publisher struct {
+	channel  *amqp.Channel
+	game     routing.Game
+	username string
+	session  *sessionToken
+	signer   *auth.Signer
+	ctx      context.Context // trace the published messages belong to
+}
+
+// in returns a publisher whose messages continue the trace in ctx
+func (p publisher) in(ctx context.Context) publisher {
+	p.ctx = ctx
+	return p
+}
+
+func (p publisher) options() []pubsub.PublishOption {
+	token, _ := p.session.get()
+	opts := []pubsub.PublishOption{
+		pubsub.WithHeader(routing.SessionHeader, token),
+		p.signer.Option(),
+	}
+	if p.ctx != nil {
+		opts = append(opts, pubsub.WithContext(p.ctx))
+	}
+	return opts
+}
+
+func (p publisher) gameLog(gameLog routing.GameLog) error {
+	return pubsub.PublishGob(
+		p.channel,
+		routing.ExchangePerilTopic,
+		p.game.Key(routing.GameLogSlug+"."+p.username),
+		gameLog,
+		p.options()...,
+	)
+}
+
+// register reserves a username with the server. Rejected is asked for
+// another name until the server accepts one, without it a rejection
+// fails right away. It returns the accepted name along with the
+// server's reply holding the session token and signing key
+func register(conn *amqp.Connection, game routing.Game, username string, rejected func(username, reason string) (string, error)) (string, routing.RegistrationReply, error) {
+	for {
+		reply, err := pubsub.RequestJSON[routing.RegistrationRequest, routing.RegistrationReply](
+			conn,
+			routing.ExchangePerilDirect,
+			game.Key(routing.RegisterKey),
+			routing.RegistrationRequest{Username: username},
+			registrationTimeout,
+		)
+		if errors.Is(err, pubsub.ErrNoResponder) || errors.Is(err, pubsub.ErrRequestTimeout) {
+			return "", reply, fmt.Errorf("no server answered, is the Peril server running? (%v)", err)
+		}
+		if err != nil {
+			return "", reply, err
+		}
+		if reply.Accepted {
+			return username, reply, nil
+		}
+
+		if rejected == nil {
+			return "", reply, fmt.Errorf("the server rejected %s: %s", username, reply.Reason)
+		}
+		username, err = rejected(username, reply.Reason)
+		if err != nil {
+			return "", reply, err
+		}
+	}
+}
+
+// newKeyring asks the server for keys of players we have not seen announced
+func newKeyring(conn *amqp.Connection, game routing.Game, serverKey ed25519.PublicKey) *auth.Keyring {
+	keyring := auth.NewKeyring(func(username, keyID string) (ed25519.PublicKey, error) {
+		reply, err := pubsub.RequestJSON[routing.KeyLookupRequest, routing.KeyLookupReply](
+			conn,
+			routing.ExchangePerilDirect,
+			game.Key(routing.KeyLookupKey),
+			routing.KeyLookupRequest{Username: username, KeyID: keyID},
+			registrationTimeout,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if !reply.Found || reply.Key.Username != username || reply.Key.KeyID != keyID {
+			return nil, errors.New("the server does not know this key")
+		}
+		if err := auth.VerifyAnnouncement(serverKey, reply.Key); err != nil {
+			return nil, err
+		}
+		return reply.Key.PublicKey, nil
+	})
+	keyring.Add(session.ServerUsername, auth.ServerKeyID, serverKey)
+	return keyring
+}
+
+func handlerKeyAnnouncement(keyring *auth.Keyring, serverKey ed25519.PublicKey) func(routing.KeyAnnouncement) pubsub.Acktype {
+
+	return func(ann routing.KeyAnnouncement) pubsub.Acktype {
+		if err := keyring.Learn(ann, serverKey); err != nil {
+			slog.Warn("ignoring key announcement", "username", ann.Username, "err", err)
+			return pubsub.NackDiscard
+		}
+		return pubsub.Ack
+	}
+}
+
+// commandRotate replaces the player's signing key with a new one, which
+// renews the session, and returns the ID of the new key
+func commandRotate(conn *amqp.Connection, pub publisher) (string, error) {
+	replyKey, err := auth.NewReplyKey()
+	if err != nil {
+		return "", fmt.Errorf("could not create reply key: %v", err)
+	}
+	req := auth.SignRotation(pub.signer, routing.KeyRotationRequest{
+		RequestedAt: time.Now(),
+		ReplyKey:    replyKey.PublicKey().Bytes(),
+	})
+	reply, err := pubsub.RequestJSON[routing.KeyRotationRequest, routing.KeyRotationReply](
+		conn,
+		routing.ExchangePerilDirect,
+		pub.game.Key(routing.KeyRotateKey),
+		req,
+		registrationTimeout,
+	)
+	if err != nil {
+		return "", err
+	}
+	if !reply.Accepted {
+		return "", fmt.Errorf("the server refused: %s", reply.Reason)
+	}
+	seed, err := auth.OpenKey(replyKey, reply.SealingKey, reply.SealedKey)
+	if err != nil {
+		return "", err
+	}
+	if err := pub.signer.Rotate(reply.KeyID, seed); err != nil {
+		return "", err
+	}
+	pub.session.set(reply.Token, reply.ExpiresAt)
+	return reply.KeyID, nil
+}
+
+// renewSession rotates the signing key shortly before the session
+// expires, until stop is closed
+func renewSession(conn *amqp.Connection, pub publisher, stop <-chan struct{}) {
+	for {
+		_, expiresAt := pub.session.get()
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(expiresAt.Add(-renewBefore))):
+		}
+		if _, err := commandRotate(conn, pub); err != nil {
+			slog.Warn("could not renew session", "err", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(renewRetry):
+			}
+			continue
+		}
+		slog.Info("renewed session")
+	}
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const spamUsage = "usage: spam <n> [-rate <msgs/s>] [-workers <n>] [-size <bytes>]"
+
+// maxSpamRate is one message per nanosecond, the shortest ticker interval
+const maxSpamRate = float64(time.Second)
+
+// spamOptions control how much load the spam command generates
+type spamOptions struct {
+	count       int
+	rate        float64 // messages per second across all workers, 0 means unlimited
+	workers     int
+	payloadSize int // 0 keeps the original malicious log length
+}
+
+func parseSpamOptions(words []string) (spamOptions, error) {
+	if len(words) < 2 {
+		return spamOptions{}, errors.New(spamUsage)
+	}
+	count, err := strconv.Atoi(words[1])
+	if err != nil || count <= 0 {
+		return spamOptions{}, fmt.Errorf("%s is not a valid number of messages", words[1])
+	}
+
+	opts := spamOptions{count: count}
+	flags := flag.NewFlagSet("spam", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Float64Var(&opts.rate, "rate", 0, "messages per second, 0 for unlimited")
+	flags.IntVar(&opts.workers, "workers", 1, "number of concurrent publishers")
+	flags.IntVar(&opts.payloadSize, "size", 0, "message size in bytes")
+	if err := flags.Parse(words[2:]); err != nil {
+		return spamOptions{}, fmt.Errorf("%v\n%s", err, spamUsage)
+	}
+
+	if opts.rate < 0 {
+		return spamOptions{}, errors.New("rate can not be negative")
+	}
+	if math.IsNaN(opts.rate) || opts.rate > maxSpamRate {
+		return spamOptions{}, fmt.Errorf("rate must be at most %.0f, use 0 for unlimited", maxSpamRate)
+	}
+	if opts.workers <= 0 {
+		return spamOptions{}, errors.New("workers must be at least 1")
+	}
+	if opts.payloadSize < 0 {
+		return spamOptions{}, errors.New("size can not be negative")
+	}
+	if opts.workers > opts.count {
+		opts.workers = opts.count
+	}
+	return opts, nil
+}
+
+// Publishes n malicious game logs to load test the server log pipeline.
+// Every worker publishes on its own channel
+func commandSpam(conn *amqp.Connection, pub publisher, words []string) error {
+	opts, err := parseSpamOptions(words)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		if opts.rate == 0 {
+			for i := 0; i < opts.count; i++ {
+				jobs <- struct{}{}
+			}
+			return
+		}
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+		defer ticker.Stop()
+		for i := 0; i < opts.count; i++ {
+			<-ticker.C
+			jobs <- struct{}{}
+		}
+	}()
+
+	var sent, failed atomic.Int64
+	var firstErr error
+	var errOnce sync.Once
+	recordErr := func(err error) {
+		failed.Add(1)
+		errOnce.Do(func() { firstErr = err })
+	}
+
+	fmt.Printf("Spamming %d game logs with %d worker(s)...\n", opts.count, opts.workers)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			channel, err := conn.Channel()
+			if err != nil {
+				// drain our share of the jobs so the dispatcher is not blocked
+				for range jobs {
+					recordErr(fmt.Errorf("could not open channel: %v", err))
+				}
+				return
+			}
+			defer channel.Close()
+			worker := pub
+			worker.channel = channel
+
+			for range jobs {
+				gameLog := routing.GameLog{
+					CurrentTime: time.Now(),
+					Message:     spamPayload(gamelogic.GetMaliciousLog(), opts.payloadSize),
+					Username:    pub.username,
+				}
+				if err := worker.gameLog(gameLog); err != nil {
+					recordErr(err)
+					continue
+				}
+				sent.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	fmt.Printf("Spam finished: %d published, %d failed in %v (%.1f msg/s)\n",
+		sent.Load(), failed.Load(), elapsed.Round(time.Millisecond), float64(sent.Load())/elapsed.Seconds())
+	if firstErr != nil {
+		return fmt.Errorf("%d publish(es) failed, first error: %v", failed.Load(), firstErr)
+	}
+	return nil
+}
+
+// spamPayload repeats msg until it is exactly size bytes long
+func spamPayload(msg string, size int) string {
+	if size == 0 {
+		return msg
+	}
+	if len(msg) >= size {
+		return msg[:size]
+	}
+	repeated := strings.Repeat(msg+" ", size/(len(msg)+1)+1)
+	return repeated[:size]
+}
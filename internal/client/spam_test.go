@@ -0,0 +1,64 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSpamOptions(t *testing.T) {
+	tests := []struct {
+		command string
+		want    spamOptions
+		wantErr string
+	}{
+		{command: "spam 10", want: spamOptions{count: 10, workers: 1}},
+		{command: "spam 10 -rate 2.5 -workers 4 -size 64", want: spamOptions{count: 10, rate: 2.5, workers: 4, payloadSize: 64}},
+		{command: "spam 2 -workers 8", want: spamOptions{count: 2, workers: 2}},
+		{command: "spam 1 -rate 1e9", want: spamOptions{count: 1, rate: 1e9, workers: 1}},
+		{command: "spam", wantErr: "usage: spam"},
+		{command: "spam lots", wantErr: "not a valid number"},
+		{command: "spam 0", wantErr: "not a valid number"},
+		{command: "spam 1 -rate -1", wantErr: "can not be negative"},
+		{command: "spam 1 -rate 2e9", wantErr: "rate must be at most"},
+		{command: "spam 1 -rate +Inf", wantErr: "rate must be at most"},
+		{command: "spam 1 -rate NaN", wantErr: "rate must be at most"},
+		{command: "spam 1 -workers 0", wantErr: "workers must be at least 1"},
+		{command: "spam 1 -size -1", wantErr: "size can not be negative"},
+		{command: "spam 1 -burst 3", wantErr: "usage: spam"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := parseSpamOptions(strings.Fields(tt.command))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("options = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpamPayload(t *testing.T) {
+	tests := []struct {
+		msg  string
+		size int
+		want string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 3, "hel"},
+		{"hello", 5, "hello"},
+		{"hi", 7, "hi hi h"},
+	}
+	for _, tt := range tests {
+		if got := spamPayload(tt.msg, tt.size); got != tt.want {
+			t.Errorf("spamPayload(%q, %d) = %q, want %q", tt.msg, tt.size, got, tt.want)
+		}
+	}
+}
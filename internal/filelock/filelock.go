@@ -0,0 +1,15 @@
+// Package filelock provides advisory locks on open files so several server
+// instances can append to the same log files without interleaving batches
+package filelock
+
+import "os"
+
+// Lock blocks until the calling process holds an exclusive lock on f
+func Lock(f *os.File) error {
+	return lock(f)
+}
+
+// Unlock releases a lock taken with Lock
+func Unlock(f *os.File) error {
+	return unlock(f)
+}
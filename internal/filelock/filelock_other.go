@@ -0,0 +1,14 @@
+//go:build !unix
+
+package filelock
+
+import "os"
+
+// Other platforms fall back to no locking, which is safe for a single server
+func lock(f *os.File) error {
+	return nil
+}
+
+func unlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,183 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// MaxGrantedUnits is the most units one admin command may grant
+const MaxGrantedUnits = 100
+
+// restriction is a limit an admin put on the player, optionally ending
+// by itself
+type restriction struct {
+	on    bool
+	until time.Time
+}
+
+func (r restriction) active(now time.Time) bool {
+	return r.on && (r.until.IsZero() || now.Before(r.until))
+}
+
+func (gs *GameState) checkCanMove() error {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	now := time.Now()
+	switch {
+	case gs.Paused:
+		return errors.New("the game is paused, you can not move units")
+	case gs.held.active(now):
+		return errors.New("an admin paused your game, you can not move units")
+	case gs.muted.active(now):
+		return errors.New("an admin muted you, you can not move units")
+	}
+	return nil
+}
+
+func (gs *GameState) restrict(r *restriction, on bool, until time.Time) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	*r = restriction{on: on, until: until}
+}
+
+// HandleAdmin applies an admin command targeted at the player and tells
+// them about it. Kicks are left to the caller, which has to leave the game
+func (gs *GameState) HandleAdmin(cmd routing.AdminCommand) error {
+	if err := ValidateAdmin(cmd); err != nil {
+		return err
+	}
+	var text string
+	switch cmd.Action {
+	case routing.AdminMute:
+		gs.restrict(&gs.muted, true, cmd.Until)
+		text = "An admin muted you, you can not move units " + until(cmd.Until, "until unmuted")
+	case routing.AdminUnmute:
+		gs.restrict(&gs.muted, false, time.Time{})
+		text = "An admin unmuted you, you can move units again"
+	case routing.AdminPausePlayer:
+		gs.restrict(&gs.held, true, cmd.Until)
+		text = "An admin paused your game " + until(cmd.Until, "until resumed")
+	case routing.AdminResumePlayer:
+		gs.restrict(&gs.held, false, time.Time{})
+		text = "An admin resumed your game"
+	case routing.AdminGrantUnits:
+		units := gs.grantUnits(Location(cmd.Location), UnitRank(cmd.Rank), cmd.Count)
+		text = fmt.Sprintf("An admin granted you %d %s in %s with id(s) %s", len(units), cmd.Rank, cmd.Location, unitIDs(units))
+	case routing.AdminRemoveUnits:
+		units := gs.removeUnits(cmd.UnitIDs)
+		if len(units) == 0 {
+			return errors.New("none of the units to remove exist")
+		}
+		text = "An admin removed your unit(s) with id(s) " + unitIDs(units)
+	default:
+		return fmt.Errorf("%s commands are not applied to the game", cmd.Action)
+	}
+	if cmd.Reason != "" {
+		text += ": " + cmd.Reason
+	}
+	gs.Render(Notice{Text: text})
+	return nil
+}
+
+// ValidateAdmin checks cmd can be applied, so the server refuses bad
+// commands instead of the player
+func ValidateAdmin(cmd routing.AdminCommand) error {
+	switch cmd.Action {
+	case routing.AdminKick, routing.AdminUnmute, routing.AdminResumePlayer:
+	case routing.AdminMute, routing.AdminPausePlayer:
+		if !cmd.Until.IsZero() && !cmd.Until.After(time.Now()) {
+			return errors.New("the end of the command has already passed")
+		}
+	case routing.AdminGrantUnits:
+		if _, ok := getAllLocations()[Location(cmd.Location)]; !ok {
+			return fmt.Errorf("%s is not a valid location", cmd.Location)
+		}
+		if _, ok := getAllRanks()[UnitRank(cmd.Rank)]; !ok {
+			return fmt.Errorf("%s is not a valid unit", cmd.Rank)
+		}
+		if cmd.Count < 1 || cmd.Count > MaxGrantedUnits {
+			return fmt.Errorf("can not grant %d units, at most %d at once", cmd.Count, MaxGrantedUnits)
+		}
+	case routing.AdminRemoveUnits:
+		if len(cmd.UnitIDs) == 0 {
+			return errors.New("no units to remove")
+		}
+	default:
+		return fmt.Errorf("unknown admin action %q", cmd.Action)
+	}
+	return nil
+}
+
+// DescribeAdmin says what cmd does to its player, for logs and the admin
+func DescribeAdmin(cmd routing.AdminCommand) string {
+	var text string
+	switch cmd.Action {
+	case routing.AdminKick:
+		text = "kicked by an admin"
+	case routing.AdminMute:
+		text = "muted by an admin " + until(cmd.Until, "until unmuted")
+	case routing.AdminUnmute:
+		text = "unmuted by an admin"
+	case routing.AdminPausePlayer:
+		text = "paused by an admin " + until(cmd.Until, "until resumed")
+	case routing.AdminResumePlayer:
+		text = "resumed by an admin"
+	case routing.AdminGrantUnits:
+		text = fmt.Sprintf("granted %d %s in %s by an admin", cmd.Count, cmd.Rank, cmd.Location)
+	case routing.AdminRemoveUnits:
+		ids := make([]string, 0, len(cmd.UnitIDs))
+		for _, id := range cmd.UnitIDs {
+			ids = append(ids, fmt.Sprint(id))
+		}
+		text = "stripped of unit(s) " + strings.Join(ids, ", ") + " by an admin"
+	default:
+		text = fmt.Sprintf("sent the unknown admin command %q", cmd.Action)
+	}
+	if cmd.Reason != "" {
+		text += ": " + cmd.Reason
+	}
+	return text
+}
+
+func until(t time.Time, otherwise string) string {
+	if t.IsZero() {
+		return otherwise
+	}
+	return "until " + t.Local().Format(time.DateTime)
+}
+
+func (gs *GameState) grantUnits(location Location, rank UnitRank, count int) []Unit {
+	units := make([]Unit, 0, count)
+	for i := 0; i < count; i++ {
+		unit := Unit{ID: gs.newUnitID(), Rank: rank, Location: location}
+		gs.addUnit(unit)
+		units = append(units, unit)
+	}
+	return units
+}
+
+// removeUnits deletes the units with ids and returns those that existed
+func (gs *GameState) removeUnits(ids []int) []Unit {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	removed := []Unit{}
+	for _, id := range ids {
+		if unit, ok := gs.Player.Units[id]; ok {
+			delete(gs.Player.Units, id)
+			removed = append(removed, unit)
+		}
+	}
+	return removed
+}
+
+func unitIDs(units []Unit) string {
+	ids := make([]string, 0, len(units))
+	for _, unit := range units {
+		ids = append(ids, fmt.Sprint(unit.ID))
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,49 @@
+package gamelogic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func TestValidateAdmin(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Minute)
+	grant := func(location, rank string, count int) routing.AdminCommand {
+		return routing.AdminCommand{Action: routing.AdminGrantUnits, Location: location, Rank: rank, Count: count}
+	}
+	tests := []struct {
+		name    string
+		cmd     routing.AdminCommand
+		wantErr bool
+	}{
+		{name: "kick", cmd: routing.AdminCommand{Action: routing.AdminKick, Reason: "spam"}},
+		{name: "mute until unmuted", cmd: routing.AdminCommand{Action: routing.AdminMute}},
+		{name: "mute for a while", cmd: routing.AdminCommand{Action: routing.AdminMute, Until: later}},
+		{name: "mute ended already", cmd: routing.AdminCommand{Action: routing.AdminMute, Until: earlier}, wantErr: true},
+		{name: "unmute", cmd: routing.AdminCommand{Action: routing.AdminUnmute}},
+		{name: "pause player for a while", cmd: routing.AdminCommand{Action: routing.AdminPausePlayer, Until: later}},
+		{name: "pause player ended already", cmd: routing.AdminCommand{Action: routing.AdminPausePlayer, Until: earlier}, wantErr: true},
+		{name: "resume player", cmd: routing.AdminCommand{Action: routing.AdminResumePlayer}},
+		{name: "grant", cmd: grant("europe", "infantry", 1)},
+		{name: "grant the most", cmd: grant("asia", "artillery", MaxGrantedUnits)},
+		{name: "grant too many", cmd: grant("asia", "artillery", MaxGrantedUnits+1), wantErr: true},
+		{name: "grant none", cmd: grant("asia", "artillery", 0), wantErr: true},
+		{name: "grant negative", cmd: grant("asia", "artillery", -2), wantErr: true},
+		{name: "grant in an unknown location", cmd: grant("atlantis", "infantry", 1), wantErr: true},
+		{name: "grant an unknown unit", cmd: grant("europe", "dragon", 1), wantErr: true},
+		{name: "remove", cmd: routing.AdminCommand{Action: routing.AdminRemoveUnits, UnitIDs: []int{1, 3}}},
+		{name: "remove nothing", cmd: routing.AdminCommand{Action: routing.AdminRemoveUnits}, wantErr: true},
+		{name: "unknown action", cmd: routing.AdminCommand{Action: "ban"}, wantErr: true},
+		{name: "no action", cmd: routing.AdminCommand{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAdmin(tt.cmd)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAdmin(%+v) = %v, want an error: %v", tt.cmd, err, tt.wantErr)
+			}
+		})
+	}
+}
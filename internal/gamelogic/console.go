@@ -0,0 +1,183 @@
+package gamelogic
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const separator = "------------------------"
+
+// ConsoleRenderer prints events as text for the line based client
+type ConsoleRenderer struct {
+	W io.Writer
+	// Prompt reprints the prompt after events that arrive while the player
+	// may be typing a command
+	Prompt bool
+}
+
+func (c ConsoleRenderer) Render(e Event) {
+	switch e := e.(type) {
+	case PauseChanged:
+		fmt.Fprintln(c.W)
+		if e.Paused {
+			fmt.Fprintln(c.W, "==== Pause Detected ====")
+			if !e.ResumeAt.IsZero() {
+				fmt.Fprintf(c.W, "The game resumes %s.\n", Remaining(e.ResumeAt))
+			}
+		} else {
+			fmt.Fprintln(c.W, "==== Resume Detected ====")
+		}
+		fmt.Fprintln(c.W, separator)
+
+	case MoveDetected:
+		c.renderMove(e)
+
+	case WarResolved:
+		c.renderWar(e)
+		if e.Outcome != WarOutcomeNotInvolved && e.Outcome != WarOutcomeNoUnits {
+			fmt.Fprintln(c.W, NewWarLog(e.Player, e.War, e.Outcome, e.Winner, e.Loser).Message)
+		}
+
+	case UnitSpawned:
+		fmt.Fprintf(c.W, "Spawned a(n) %s in %s with id %v\n", e.Unit.Rank, e.Unit.Location, e.Unit.ID)
+		return
+
+	case UnitsMoved:
+		fmt.Fprintf(c.W, "Moved %v units to %s\n", len(e.Move.Units), e.Move.ToLocation)
+		return
+
+	case StatusReported:
+		if e.Paused {
+			fmt.Fprintln(c.W, "The game is paused.")
+			if !e.ResumeAt.IsZero() {
+				fmt.Fprintf(c.W, "It resumes %s.\n", Remaining(e.ResumeAt))
+			}
+			return
+		}
+		fmt.Fprintln(c.W, "The game is not paused.")
+		fmt.Fprintf(c.W, "You are %s, and you have %d units.\n", e.Username, len(e.Units))
+		for _, unit := range e.Units {
+			fmt.Fprintf(c.W, "* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+		}
+		return
+
+	case PlayersListed:
+		c.renderPlayers(e.Players)
+		return
+
+	case PresenceChanged:
+		switch e.Status {
+		case PresenceLeave:
+			fmt.Fprintf(c.W, "\n%s left the game\n", e.Username)
+		case PresenceJoin:
+			fmt.Fprintf(c.W, "\n%s joined the game\n", e.Username)
+		default:
+			fmt.Fprintf(c.W, "\n%s is playing\n", e.Username)
+		}
+
+	case Notice:
+		fmt.Fprintln(c.W, e.Text)
+		return
+
+	default:
+		fmt.Fprintf(c.W, "%+v\n", e)
+		return
+	}
+
+	if c.Prompt {
+		fmt.Fprint(c.W, "> ")
+	}
+}
+
+func (c ConsoleRenderer) renderMove(e MoveDetected) {
+	fmt.Fprintln(c.W)
+	fmt.Fprintln(c.W, "==== Move Detected ====")
+	fmt.Fprintf(c.W, "%s is moving %v unit(s) to %s\n", e.Move.Player.Username, len(e.Move.Units), e.Move.ToLocation)
+	for _, unit := range e.Move.Units {
+		fmt.Fprintf(c.W, "* %v\n", unit.Rank)
+	}
+	switch e.Outcome {
+	case MoveOutcomeMakeWar:
+		fmt.Fprintf(c.W, "You have units in %s! You are at war with %s!\n", e.Front, e.Move.Player.Username)
+	case MoveOutComeSafe:
+		fmt.Fprintf(c.W, "You are safe from %s's units.\n", e.Move.Player.Username)
+	}
+	fmt.Fprintln(c.W, separator)
+}
+
+func (c ConsoleRenderer) renderWar(e WarResolved) {
+	defer fmt.Fprintln(c.W, separator)
+	fmt.Fprintln(c.W)
+	fmt.Fprintln(c.W, "==== War Declared ====")
+	fmt.Fprintf(c.W, "%s has declared war on %s!\n", e.War.Attacker.Username, e.War.Defender.Username)
+
+	switch e.Outcome {
+	case WarOutcomeNotInvolved:
+		if e.Player == e.War.Defender.Username {
+			fmt.Fprintf(c.W, "%s, you published the war.\n", e.Player)
+		} else {
+			fmt.Fprintf(c.W, "%s, you are not involved in this war.\n", e.Player)
+		}
+		return
+	case WarOutcomeNoUnits:
+		fmt.Fprintf(c.W, "Error! No units are in the same location. No war will be fought.\n")
+		return
+	}
+
+	fmt.Fprintf(c.W, "%s's units:\n", e.War.Attacker.Username)
+	for _, unit := range e.AttackerUnits {
+		fmt.Fprintf(c.W, "  * %v\n", unit.Rank)
+	}
+	fmt.Fprintf(c.W, "%s's units:\n", e.War.Defender.Username)
+	for _, unit := range e.DefenderUnits {
+		fmt.Fprintf(c.W, "  * %v\n", unit.Rank)
+	}
+	fmt.Fprintf(c.W, "Attacker has a power level of %v\n", e.AttackerPower)
+	fmt.Fprintf(c.W, "Defender has a power level of %v\n", e.DefenderPower)
+
+	if e.Outcome == WarOutcomeDraw {
+		fmt.Fprintln(c.W, "The war ended in a draw!")
+		fmt.Fprintf(c.W, "Your units in %s have been killed.\n", e.Front)
+		return
+	}
+	fmt.Fprintf(c.W, "%s has won the war!\n", e.Winner)
+	if e.Outcome == WarOutcomeOpponentWon {
+		fmt.Fprintln(c.W, "You have lost the war!")
+		fmt.Fprintf(c.W, "Your units in %s have been killed.\n", e.Front)
+	}
+}
+
+func (c ConsoleRenderer) renderPlayers(players []PlayerInfo) {
+	if len(players) == 0 {
+		fmt.Fprintln(c.W, "No players are online.")
+		return
+	}
+	fmt.Fprintf(c.W, "%d player(s) online:\n", len(players))
+	for _, info := range players {
+		fmt.Fprintf(c.W, "* %s: %d unit(s), power level %d, last seen %v ago\n",
+			info.Player.Username,
+			len(info.Player.Units),
+			PowerLevel(info.Player),
+			time.Since(info.LastSeen).Round(time.Second),
+		)
+	}
+}
+
+// Labelled renders events like the console but starts every line with
+// label, telling apart the players of a process running several of them
+func Labelled(w io.Writer, label string) Renderer {
+	return RendererFunc(func(e Event) {
+		var text strings.Builder
+		ConsoleRenderer{W: &text}.Render(e)
+		var out strings.Builder
+		for _, line := range strings.Split(strings.TrimRight(text.String(), "\n"), "\n") {
+			if line != "" && line != separator {
+				out.WriteString(label + line + "\n")
+			}
+		}
+		// one write per event keeps the lines of concurrent players apart
+		io.WriteString(w, out.String())
+	})
+}
@@ -0,0 +1,95 @@
+package gamelogic
+
+import "time"
+
+// Event is something a player should be shown. The game logic reports what
+// happened as events and leaves showing them to a Renderer
+type Event interface {
+	event()
+}
+
+// Renderer shows events to a player, e.g. on the console, in the terminal
+// UI or not at all for bots
+type Renderer interface {
+	Render(Event)
+}
+
+// RendererFunc lets a function be used as a Renderer
+type RendererFunc func(Event)
+
+func (f RendererFunc) Render(e Event) { f(e) }
+
+// Discard drops every event
+var Discard Renderer = RendererFunc(func(Event) {})
+
+// PauseChanged is the game being paused or resumed by the server
+type PauseChanged struct {
+	Paused   bool
+	ResumeAt time.Time // zero unless the pause is timed
+}
+
+// MoveDetected is a move of any player, including our own, arriving
+type MoveDetected struct {
+	Player  string // who saw the move
+	Move    ArmyMove
+	Outcome MoveOutcome
+	Front   Location // where the armies meet when Outcome is MoveOutcomeMakeWar
+}
+
+// WarResolved is a declaration of war arriving, whether or not the player
+// fights in it
+type WarResolved struct {
+	Player        string // who saw the war
+	War           RecognitionOfWar
+	Outcome       WarOutcome
+	Winner        string
+	Loser         string
+	Front         Location
+	AttackerUnits []Unit
+	DefenderUnits []Unit
+	AttackerPower int
+	DefenderPower int
+}
+
+type UnitSpawned struct {
+	Unit Unit
+}
+
+type UnitsMoved struct {
+	Move ArmyMove
+}
+
+// StatusReported answers the status command
+type StatusReported struct {
+	Username string
+	Paused   bool
+	ResumeAt time.Time // zero unless the pause is timed
+	Units    []Unit    // sorted by ID
+}
+
+// PlayersListed answers the players command
+type PlayersListed struct {
+	Players []PlayerInfo
+}
+
+// PresenceChanged is another player joining, leaving or being seen for the
+// first time
+type PresenceChanged struct {
+	Username string
+	Status   PresenceStatus
+}
+
+// Notice is any other message for the player
+type Notice struct {
+	Text string
+}
+
+func (PauseChanged) event()    {}
+func (MoveDetected) event()    {}
+func (WarResolved) event()     {}
+func (UnitSpawned) event()     {}
+func (UnitsMoved) event()      {}
+func (StatusReported) event()  {}
+func (PlayersListed) event()   {}
+func (PresenceChanged) event() {}
+func (Notice) event()          {}
@@ -1,5 +1,7 @@
 package gamelogic
 
+import "slices"
+
 type Player struct {
 	Username string
 	Units    map[int]Unit
@@ -50,3 +52,18 @@ func getAllLocations() map[Location]struct{} {
 		"antarctica": {},
 	}
 }
+
+// Locations lists every location units can be in, sorted by name
+func Locations() []Location {
+	locations := make([]Location, 0, len(getAllLocations()))
+	for location := range getAllLocations() {
+		locations = append(locations, location)
+	}
+	slices.Sort(locations)
+	return locations
+}
+
+// Ranks lists every unit rank from the weakest to the strongest
+func Ranks() []UnitRank {
+	return []UnitRank{RankInfantry, RankCavalry, RankArtillery}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"strings"
@@ -18,44 +19,103 @@ func PrintClientHelp() {
 	fmt.Println("    example:")
 	fmt.Println("    spawn europe infantry")
 	fmt.Println("* status")
-	fmt.Println("* spam <n>")
+	fmt.Println("* players")
+	fmt.Println("* save")
+	fmt.Println("* rotate")
+	fmt.Println("* wait <duration>")
+	fmt.Println("    example:")
+	fmt.Println("    wait 2s")
+	fmt.Println("* spam <n> [-rate <msgs/s>] [-workers <n>] [-size <bytes>]")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
+	fmt.Println("    spam 1000 -rate 200 -workers 4 -size 512")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
 
 func ClientWelcome() (string, error) {
 	fmt.Println("Welcome to the Peril client!")
+	return PromptUsername()
+}
+
+func PromptUsername() (string, error) {
 	fmt.Println("Please enter your username:")
 	words := GetInput()
 	if len(words) == 0 {
 		return "", errors.New("you must enter a username. goodbye")
 	}
-	username := words[0]
+	return words[0], nil
+}
+
+// PrintWelcome greets a player once the server accepted their username
+func PrintWelcome(username string) {
 	fmt.Printf("Welcome, %s!\n", username)
 	PrintClientHelp()
-	return username, nil
 }
 
 func PrintServerHelp() {
 	fmt.Println("Possible commands:")
-	fmt.Println("* pause")
+	fmt.Println("* pause [<duration>]")
+	fmt.Println("    example:")
+	fmt.Println("    pause 30s")
+	fmt.Println("* pause at <time> [for <duration>] [every <duration>]")
+	fmt.Println("    example:")
+	fmt.Println("    pause at 18:00")
+	fmt.Println("    pause at 03:00 for 30m every 24h")
 	fmt.Println("* resume")
+	fmt.Println("* schedule")
+	fmt.Println("* unschedule <id>")
+	fmt.Println("* players")
+	fmt.Println("* games")
+	fmt.Println("* create <game>")
+	fmt.Println("* use <game>")
+	fmt.Println("    example:")
+	fmt.Println("    use default")
+	fmt.Println("* kick <player> [<reason>]")
+	fmt.Println("* mute <player> [<duration>] [<reason>]")
+	fmt.Println("* unmute <player>")
+	fmt.Println("* grant <player> <location> <rank> [<count>]")
+	fmt.Println("    example:")
+	fmt.Println("    grant alice europe infantry 3")
+	fmt.Println("* remove <player> <unitID> <unitID>...")
+	fmt.Println("* pause-player <player> [<duration>] [<reason>]")
+	fmt.Println("* resume-player <player>")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
 
+var (
+	input       = bufio.NewScanner(os.Stdin)
+	interactive = true
+)
+
+// SetInput makes commands come from r. Interactive input is prompted for,
+// other input is echoed back so a transcript shows what was run
+func SetInput(r io.Reader, isInteractive bool) {
+	input = bufio.NewScanner(r)
+	interactive = isInteractive
+}
+
+// GetInput reads the next line as words, nil once the input is exhausted
 func GetInput() []string {
-	fmt.Print("> ")
-	scanner := bufio.NewScanner(os.Stdin)
-	scanned := scanner.Scan()
-	if !scanned {
-		return nil
+	words, _ := ReadInput()
+	return words
+}
+
+// ReadInput reads the next line as words. It reports false once the input
+// is exhausted
+func ReadInput() ([]string, bool) {
+	if interactive {
+		fmt.Print("> ")
+	}
+	if !input.Scan() {
+		return nil, false
+	}
+	line := strings.TrimSpace(input.Text())
+	if !interactive {
+		fmt.Printf("> %s\n", line)
 	}
-	line := scanner.Text()
-	line = strings.TrimSpace(line)
-	return strings.Fields(line)
+	return strings.Fields(line), true
 }
 
 func GetMaliciousLog() string {
@@ -76,17 +136,13 @@ func PrintQuit() {
 	fmt.Println("I hate this game! (╯°□°)╯︵ ┻━┻")
 }
 
-func (gs *GameState) CommandStatus() {
-	if gs.isPaused() {
-		fmt.Println("The game is paused.")
-		return
-	} else {
-		fmt.Println("The game is not paused.")
-	}
+// Status describes the player and their units, sorted by ID so the output
+// is the same every time
+func (gs *GameState) Status() StatusReported {
+	save := gs.Snapshot()
+	return StatusReported{Username: save.Username, Paused: save.Paused, ResumeAt: gs.ResumeAt(), Units: save.Units}
+}
 
-	p := gs.GetPlayerSnap()
-	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
-	for _, unit := range p.Units {
-		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
-	}
+func (gs *GameState) CommandStatus() {
+	gs.Render(gs.Status())
 }
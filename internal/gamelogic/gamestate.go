@@ -1,13 +1,20 @@
 package gamelogic
 
 import (
+	"os"
 	"sync"
+	"time"
 )
 
 type GameState struct {
-	Player Player
-	Paused bool
-	mu     *sync.RWMutex
+	Player   Player
+	Paused   bool
+	resumeAt time.Time   // end of a timed pause
+	held     restriction // paused by an admin for this player only
+	muted    restriction // may not move units
+	nextID   int
+	mu       *sync.RWMutex
+	renderer Renderer
 }
 
 func NewGameState(username string) *GameState {
@@ -16,27 +23,50 @@ func NewGameState(username string) *GameState {
 			Username: username,
 			Units:    map[int]Unit{},
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:   false,
+		nextID:   1,
+		mu:       &sync.RWMutex{},
+		renderer: ConsoleRenderer{W: os.Stdout, Prompt: true},
 	}
 }
 
+// SetRenderer replaces the console as the place events are shown. It must
+// be called before any messages are handled
+func (gs *GameState) SetRenderer(r Renderer) {
+	gs.renderer = r
+}
+
+// Render shows e to the player
+func (gs *GameState) Render(e Event) {
+	gs.renderer.Render(e)
+}
+
 func (gs *GameState) resumeGame() {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.Paused = false
+	gs.resumeAt = time.Time{}
 }
 
-func (gs *GameState) pauseGame() {
+func (gs *GameState) pauseGame(resumeAt time.Time) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.Paused = true
+	gs.resumeAt = resumeAt
+}
+
+// ResumeAt is when the server said it ends the current pause, zero when
+// the game runs or the pause has no end yet
+func (gs *GameState) ResumeAt() time.Time {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.resumeAt
 }
 
 func (gs *GameState) isPaused() bool {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
-	return gs.Paused
+	return gs.Paused || gs.held.active(time.Now())
 }
 
 func (gs *GameState) addUnit(u Unit) {
@@ -45,6 +75,15 @@ func (gs *GameState) addUnit(u Unit) {
 	gs.Player.Units[u.ID] = u
 }
 
+// newUnitID hands out unit IDs that are never reused, even after units die
+func (gs *GameState) newUnitID() int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	id := gs.nextID
+	gs.nextID++
+	return id
+}
+
 func (gs *GameState) removeUnitsInLocation(loc Location) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -2,7 +2,7 @@ package gamelogic
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
@@ -14,7 +14,7 @@ const logsFile = "game.log"
 const writeToDiskSleep = 1 * time.Second
 
 func WriteLog(gamelog routing.GameLog) error {
-	log.Printf("received game log...")
+	slog.Debug("received game log", "player", gamelog.Username)
 	time.Sleep(writeToDiskSleep)
 
 	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -23,10 +23,136 @@ func WriteLog(gamelog routing.GameLog) error {
 	}
 	defer f.Close()
 
-	str := fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, gamelog.Message)
-	_, err = f.WriteString(str)
+	_, err = f.WriteString(FormatLog(gamelog))
 	if err != nil {
 		return fmt.Errorf("could not write to logs file: %v", err)
 	}
 	return nil
 }
+
+// FormatLog renders a game log as a single line of the game log file
+func FormatLog(gamelog routing.GameLog) string {
+	return fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, RenderLog(gamelog))
+}
+
+// RenderLog returns the human readable message of a game log. Free text
+// logs keep their message, structured ones are rendered from their fields
+func RenderLog(gamelog routing.GameLog) string {
+	switch gamelog.Event {
+	case routing.EventWarWon, routing.EventWarLost:
+		if gamelog.Location == "" {
+			return fmt.Sprintf("%s won a war against %s", gamelog.Winner, gamelog.Loser)
+		}
+		return fmt.Sprintf("%s won a war against %s in %s", gamelog.Winner, gamelog.Loser, gamelog.Location)
+	case routing.EventWarDraw:
+		if gamelog.Location == "" {
+			return fmt.Sprintf("A war between %s and %s resulted in a draw", gamelog.Winner, gamelog.Loser)
+		}
+		return fmt.Sprintf("A war between %s and %s in %s resulted in a draw", gamelog.Winner, gamelog.Loser, gamelog.Location)
+	case routing.EventSpawn:
+		if len(gamelog.Units) == 1 {
+			unit := gamelog.Units[0]
+			return fmt.Sprintf("spawned a(n) %s in %s with id %v", unit.Rank, unit.Location, unit.ID)
+		}
+	case routing.EventMove:
+		return fmt.Sprintf("moved %v unit(s) to %s", len(gamelog.Units), gamelog.Location)
+	case routing.EventJoin:
+		return "joined the game"
+	case routing.EventLeave:
+		return "left the game"
+	case routing.EventPause:
+		return "the game was paused"
+	case routing.EventResume:
+		return "the game was resumed"
+	}
+	return gamelog.Message
+}
+
+func newGameLog(username string, event routing.EventType) routing.GameLog {
+	return routing.GameLog{
+		CurrentTime: time.Now(),
+		Username:    username,
+		Event:       event,
+	}
+}
+
+func withMessage(gamelog routing.GameLog) routing.GameLog {
+	gamelog.Message = RenderLog(gamelog)
+	return gamelog
+}
+
+func loggedUnits(player string, units []Unit) []routing.LoggedUnit {
+	logged := make([]routing.LoggedUnit, 0, len(units))
+	for _, unit := range units {
+		logged = append(logged, routing.LoggedUnit{
+			Player:   player,
+			ID:       unit.ID,
+			Rank:     string(unit.Rank),
+			Location: string(unit.Location),
+		})
+	}
+	return logged
+}
+
+// NewWarLog describes the outcome of a war from the point of view of username
+func NewWarLog(username string, rw RecognitionOfWar, outcome WarOutcome, winner, loser string) routing.GameLog {
+	var event routing.EventType
+	switch outcome {
+	case WarOutcomeYouWon:
+		event = routing.EventWarWon
+	case WarOutcomeOpponentWon:
+		event = routing.EventWarLost
+	case WarOutcomeDraw:
+		event = routing.EventWarDraw
+	}
+
+	gamelog := newGameLog(username, event)
+	gamelog.Winner = winner
+	gamelog.Loser = loser
+	gamelog.Opponent = rw.Attacker.Username
+	if username == rw.Attacker.Username {
+		gamelog.Opponent = rw.Defender.Username
+	}
+
+	location, attackerUnits, defenderUnits := rw.Front()
+	gamelog.Location = string(location)
+	gamelog.Units = append(loggedUnits(rw.Attacker.Username, attackerUnits), loggedUnits(rw.Defender.Username, defenderUnits)...)
+	return withMessage(gamelog)
+}
+
+func NewSpawnLog(username string, unit Unit) routing.GameLog {
+	gamelog := newGameLog(username, routing.EventSpawn)
+	gamelog.Location = string(unit.Location)
+	gamelog.Units = loggedUnits(username, []Unit{unit})
+	return withMessage(gamelog)
+}
+
+func NewMoveLog(mv ArmyMove) routing.GameLog {
+	gamelog := newGameLog(mv.Player.Username, routing.EventMove)
+	gamelog.Location = string(mv.ToLocation)
+	gamelog.Units = loggedUnits(mv.Player.Username, mv.Units)
+	return withMessage(gamelog)
+}
+
+func NewJoinLog(username string) routing.GameLog {
+	return withMessage(newGameLog(username, routing.EventJoin))
+}
+
+func NewLeaveLog(username string) routing.GameLog {
+	return withMessage(newGameLog(username, routing.EventLeave))
+}
+
+// NewAdminLog records an admin command sent to username
+func NewAdminLog(username string, cmd routing.AdminCommand) routing.GameLog {
+	gamelog := newGameLog(username, routing.EventAdmin)
+	gamelog.Location = cmd.Location
+	gamelog.Message = DescribeAdmin(cmd)
+	return gamelog
+}
+
+func NewPauseLog(username string, ps routing.PlayingState) routing.GameLog {
+	if ps.IsPaused {
+		return withMessage(newGameLog(username, routing.EventPause))
+	}
+	return withMessage(newGameLog(username, routing.EventResume))
+}
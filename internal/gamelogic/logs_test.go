@@ -0,0 +1,94 @@
+package gamelogic
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// legacyGameLog is routing.GameLog as clients and servers sent it before it
+// had structured fields
+type legacyGameLog struct {
+	CurrentTime time.Time
+	Message     string
+	Username    string
+}
+
+func regob(t *testing.T, from, to any) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(from); err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewDecoder(&buf).Decode(to); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyGameLogDecodes(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	var gl routing.GameLog
+	regob(t, legacyGameLog{CurrentTime: at, Message: "alice won a war against bob", Username: "alice"}, &gl)
+
+	if !gl.CurrentTime.Equal(at) || gl.Username != "alice" || gl.Message != "alice won a war against bob" {
+		t.Errorf("decoded %+v, lost the legacy fields", gl)
+	}
+	if gl.Event != routing.EventMessage || gl.Location != "" || gl.Units != nil {
+		t.Errorf("decoded %+v, want empty structured fields", gl)
+	}
+	if got := RenderLog(gl); got != gl.Message {
+		t.Errorf("RenderLog = %q, want the message %q", got, gl.Message)
+	}
+	if got, want := FormatLog(gl), "2026-01-02T03:04:05Z alice: alice won a war against bob\n"; got != want {
+		t.Errorf("FormatLog = %q, want %q", got, want)
+	}
+}
+
+func TestGameLogDecodesAsLegacy(t *testing.T) {
+	war := RecognitionOfWar{
+		Attacker: Player{Username: "alice", Units: map[int]Unit{1: {ID: 1, Rank: RankArtillery, Location: "asia"}}},
+		Defender: Player{Username: "bob", Units: map[int]Unit{1: {ID: 1, Rank: RankInfantry, Location: "asia"}}},
+	}
+	tests := []struct {
+		name string
+		gl   routing.GameLog
+	}{
+		{"war", NewWarLog("alice", war, WarOutcomeYouWon, "alice", "bob")},
+		{"spawn", NewSpawnLog("alice", Unit{ID: 2, Rank: RankCavalry, Location: "europe"})},
+		{"join", NewJoinLog("alice")},
+		{"free text", routing.GameLog{CurrentTime: time.Now(), Username: "alice", Message: "GG"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// servers that predate the structured fields only see the message
+			var legacy legacyGameLog
+			regob(t, tt.gl, &legacy)
+			if legacy.Username != tt.gl.Username || legacy.Message != RenderLog(tt.gl) || legacy.Message == "" {
+				t.Errorf("decoded %+v, want %q by %s", legacy, RenderLog(tt.gl), tt.gl.Username)
+			}
+		})
+	}
+}
+
+func TestRenderLogFallsBackToMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		gl   routing.GameLog
+		want string
+	}{
+		{"unknown event", routing.GameLog{Event: "surrender", Message: "alice gave up"}, "alice gave up"},
+		{"spawn without its unit", routing.GameLog{Event: routing.EventSpawn, Message: "spawned something"}, "spawned something"},
+		{"war without a location", routing.GameLog{Event: routing.EventWarWon, Winner: "alice", Loser: "bob"}, "alice won a war against bob"},
+		{"draw without a location", routing.GameLog{Event: routing.EventWarDraw, Winner: "alice", Loser: "bob"}, "A war between alice and bob resulted in a draw"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderLog(tt.gl); got != tt.want {
+				t.Errorf("RenderLog = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package gamelogic
+
+import (
+	"github.com/MichalGul/learn-pub-sub-starter/internal/metrics"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// Only the server counts game activity, from the game logs of every
+// player. Clients counting their own as well would count everything twice
+// on a dashboard summing the clients and servers
+var (
+	spawns = metrics.NewCounter("peril_game_spawns_total",
+		"Units spawned, by rank", "rank")
+	moves = metrics.NewCounter("peril_game_moves_total",
+		"Armies moved")
+	movedUnits = metrics.NewCounter("peril_game_moved_units_total",
+		"Units moved")
+	wars = metrics.NewCounter("peril_game_wars_total",
+		"Wars fought, by outcome for the attacker: won, lost or draw", "outcome")
+)
+
+// RecordGameLog counts the spawn, move or war a game log reports
+func RecordGameLog(gl routing.GameLog) {
+	switch gl.Event {
+	case routing.EventSpawn:
+		for _, unit := range gl.Units {
+			spawns.Inc(unit.Rank)
+		}
+	case routing.EventMove:
+		moves.Inc()
+		movedUnits.Add(float64(len(gl.Units)))
+	case routing.EventWarWon:
+		wars.Inc("won")
+	case routing.EventWarLost:
+		wars.Inc("lost")
+	case routing.EventWarDraw:
+		wars.Inc("draw")
+	}
+}
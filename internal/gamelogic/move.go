@@ -15,27 +15,22 @@ const (
 )
 
 func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
-	defer fmt.Println("------------------------")
 	player := gs.GetPlayerSnap()
-
-	fmt.Println()
-	fmt.Println("==== Move Detected ====")
-	fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
-	for _, unit := range move.Units {
-		fmt.Printf("* %v\n", unit.Rank)
-	}
+	e := MoveDetected{Player: player.Username, Move: move}
+	defer func() { gs.Render(e) }()
 
 	if player.Username == move.Player.Username {
-		return MoveOutcomeSamePlayer
+		e.Outcome = MoveOutcomeSamePlayer
+		return e.Outcome
 	}
 
-	overlappingLocation := getOverlappingLocation(player, move.Player)
-	if overlappingLocation != "" {
-		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
-		return MoveOutcomeMakeWar
+	e.Front = getOverlappingLocation(player, move.Player)
+	if e.Front != "" {
+		e.Outcome = MoveOutcomeMakeWar
+		return e.Outcome
 	}
-	fmt.Printf("You are safe from %s's units.\n", move.Player.Username)
-	return MoveOutComeSafe
+	e.Outcome = MoveOutComeSafe
+	return e.Outcome
 }
 
 func getOverlappingLocation(p1 Player, p2 Player) Location {
@@ -50,8 +45,8 @@ func getOverlappingLocation(p1 Player, p2 Player) Location {
 }
 
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
-	if gs.isPaused() {
-		return ArmyMove{}, errors.New("the game is paused, you can not move units")
+	if err := gs.checkCanMove(); err != nil {
+		return ArmyMove{}, err
 	}
 	if len(words) < 3 {
 		return ArmyMove{}, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
@@ -87,6 +82,6 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		Units:      newUnits,
 		Player:     gs.GetPlayerSnap(),
 	}
-	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
+	gs.Render(UnitsMoved{Move: mv})
 	return mv, nil
 }
@@ -2,18 +2,26 @@ package gamelogic
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
 )
 
 func (gs *GameState) HandlePause(ps routing.PlayingState) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
 	if ps.IsPaused {
-		fmt.Println("==== Pause Detected ====")
-		gs.pauseGame()
+		gs.pauseGame(ps.ResumeAt)
 	} else {
-		fmt.Println("==== Resume Detected ====")
 		gs.resumeGame()
 	}
+	gs.Render(PauseChanged{Paused: ps.IsPaused, ResumeAt: ps.ResumeAt})
+}
+
+// Remaining describes the time left until resumeAt for the player, rounded
+// to the second
+func Remaining(resumeAt time.Time) string {
+	left := time.Until(resumeAt).Round(time.Second)
+	if left <= 0 {
+		return "any moment now"
+	}
+	return fmt.Sprintf("in %v (at %s)", left, resumeAt.Local().Format(time.TimeOnly))
 }
@@ -0,0 +1,113 @@
+package gamelogic
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const DefaultSaveDir = "saves"
+
+// SavedGame is the part of a GameState that survives a restart
+type SavedGame struct {
+	Username string
+	Units    []Unit
+	NextID   int
+	// Paused is restored with the save, but a save may be older than the
+	// last pause or resume. The PlayingState the server sends on
+	// registration overrides it
+	Paused  bool
+	SavedAt time.Time
+}
+
+func SavePath(dir, username string) string {
+	return filepath.Join(dir, username+".json")
+}
+
+func (gs *GameState) Snapshot() SavedGame {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	units := make([]Unit, 0, len(gs.Player.Units))
+	for _, unit := range gs.Player.Units {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	return SavedGame{
+		Username: gs.Player.Username,
+		Units:    units,
+		NextID:   gs.nextID,
+		Paused:   gs.Paused,
+		SavedAt:  time.Now(),
+	}
+}
+
+// Restore replaces the player's units and paused flag with the ones from a
+// saved game
+func (gs *GameState) Restore(save SavedGame) error {
+	if save.Username != gs.GetUsername() {
+		return fmt.Errorf("saved game belongs to %s, not %s", save.Username, gs.GetUsername())
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Player.Units = map[int]Unit{}
+	gs.nextID = save.NextID
+	gs.Paused = save.Paused
+	gs.resumeAt = time.Time{}
+	for _, unit := range save.Units {
+		gs.Player.Units[unit.ID] = unit
+		if unit.ID >= gs.nextID {
+			gs.nextID = unit.ID + 1
+		}
+	}
+	return nil
+}
+
+// SaveGame writes the save to a temporary file first, so a crash while
+// saving never leaves a half written save behind
+func SaveGame(path string, save SavedGame) error {
+	data, err := json.MarshalIndent(save, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode saved game: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create saves directory: %v", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("could not write saved game: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write saved game: %v", err)
+	}
+	return nil
+}
+
+// LoadGame reads a save written by SaveGame. A missing save is reported
+// with an error matching os.ErrNotExist
+func LoadGame(path string) (SavedGame, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SavedGame{}, err
+	}
+	var save SavedGame
+	if err := json.Unmarshal(data, &save); err != nil {
+		return SavedGame{}, fmt.Errorf("could not decode saved game %s: %v", path, err)
+	}
+	return save, nil
+}
+
+// AskResume offers to continue a saved game
+func AskResume(save SavedGame) bool {
+	fmt.Printf("Found a saved game from %s with %d unit(s).\n", save.SavedAt.Format(time.RFC1123), len(save.Units))
+	fmt.Println("Do you want to resume it? (y/n)")
+	words := GetInput()
+	return len(words) > 0 && (words[0] == "y" || words[0] == "yes")
+}
@@ -0,0 +1,125 @@
+package gamelogic
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func quietState(username string) *GameState {
+	gs := NewGameState(username)
+	gs.SetRenderer(ConsoleRenderer{W: io.Discard})
+	return gs
+}
+
+func TestSaveLoadRestore(t *testing.T) {
+	tests := []struct {
+		name   string
+		save   SavedGame
+		nextID int // of the next spawned unit
+	}{
+		{
+			name:   "no units",
+			save:   SavedGame{Username: "alice", NextID: 1},
+			nextID: 1,
+		},
+		{
+			name: "units and next id",
+			save: SavedGame{Username: "alice", NextID: 7, Units: []Unit{
+				{ID: 2, Rank: RankInfantry, Location: "asia"},
+				{ID: 5, Rank: RankArtillery, Location: "europe"},
+			}},
+			nextID: 7,
+		},
+		{
+			name: "next id behind the units",
+			save: SavedGame{Username: "alice", NextID: 1, Units: []Unit{
+				{ID: 3, Rank: RankCavalry, Location: "africa"},
+			}},
+			nextID: 4,
+		},
+		{
+			name:   "paused",
+			save:   SavedGame{Username: "alice", NextID: 1, Paused: true},
+			nextID: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := SavePath(filepath.Join(t.TempDir(), "saves"), "alice")
+			tt.save.SavedAt = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			if err := SaveGame(path, tt.save); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("SaveGame left its temporary file behind: %v", err)
+			}
+			loaded, err := LoadGame(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(loaded, tt.save) {
+				t.Errorf("LoadGame = %+v, want %+v", loaded, tt.save)
+			}
+
+			gs := quietState("alice")
+			if err := gs.Restore(loaded); err != nil {
+				t.Fatal(err)
+			}
+			snapshot := gs.Snapshot()
+			if !slices.Equal(snapshot.Units, loaded.Units) {
+				t.Errorf("restored units %+v, want %+v", snapshot.Units, loaded.Units)
+			}
+			if snapshot.Paused != loaded.Paused {
+				t.Errorf("restored paused %v, want %v", snapshot.Paused, loaded.Paused)
+			}
+			unit, err := gs.CommandSpawn([]string{"spawn", "asia", "infantry"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unit.ID != tt.nextID {
+				t.Errorf("spawned unit %d after the restore, want %d", unit.ID, tt.nextID)
+			}
+		})
+	}
+}
+
+func TestRestoreReplacesState(t *testing.T) {
+	gs := quietState("alice")
+	if _, err := gs.CommandSpawn([]string{"spawn", "asia", "infantry"}); err != nil {
+		t.Fatal(err)
+	}
+	gs.pauseGame(time.Now().Add(time.Minute))
+
+	if err := gs.Restore(SavedGame{Username: "alice", NextID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if save := gs.Snapshot(); len(save.Units) != 0 || save.Paused || !gs.ResumeAt().IsZero() {
+		t.Errorf("restored %+v resuming at %v, want no units and a running game", save, gs.ResumeAt())
+	}
+
+	if err := gs.Restore(SavedGame{Username: "bob"}); err == nil {
+		t.Error("restored the save of another player")
+	}
+}
+
+func TestLoadGameErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadGame(SavePath(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadGame of a missing save = %v, want %v", err, os.ErrNotExist)
+	}
+
+	corrupt := SavePath(dir, "corrupt")
+	if err := os.WriteFile(corrupt, []byte(`{"Username": "alice", "Units": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadGame(corrupt)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadGame of a corrupt save = %v, want a decoding error", err)
+	}
+}
@@ -0,0 +1,148 @@
+package gamelogic
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	HeartbeatInterval = 5 * time.Second
+	// players that miss three heartbeats in a row are considered gone
+	PresenceTimeout = 3 * HeartbeatInterval
+)
+
+type PresenceStatus string
+
+const (
+	PresenceJoin      PresenceStatus = "join"
+	PresenceHeartbeat PresenceStatus = "heartbeat"
+	PresenceLeave     PresenceStatus = "leave"
+)
+
+// Presence is published by every client when it joins, periodically while
+// it plays and when it leaves. It carries a snapshot of the player's units
+type Presence struct {
+	Player Player
+	Status PresenceStatus
+	SentAt time.Time
+}
+
+func (gs *GameState) NewPresence(status PresenceStatus) Presence {
+	return Presence{
+		Player: gs.GetPlayerSnap(),
+		Status: status,
+		SentAt: time.Now(),
+	}
+}
+
+type PlayerInfo struct {
+	Player   Player
+	JoinedAt time.Time
+	LastSeen time.Time
+}
+
+// Roster tracks the players currently in the game and their last known units
+type Roster struct {
+	players map[string]PlayerInfo
+	timeout time.Duration
+	now     func() time.Time // when presence messages arrive, tests replace it
+	mu      *sync.RWMutex
+}
+
+func NewRoster(timeout time.Duration) *Roster {
+	return &Roster{
+		players: map[string]PlayerInfo{},
+		timeout: timeout,
+		now:     time.Now,
+		mu:      &sync.RWMutex{},
+	}
+}
+
+// Update applies a presence message and reports whether the player is new
+func (r *Roster) Update(p Presence) bool {
+	if p.Status == PresenceLeave {
+		r.Remove(p.Player.Username)
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	info, known := r.players[p.Player.Username]
+	if !known {
+		info.JoinedAt = now
+	}
+	info.Player = p.Player
+	info.LastSeen = now
+	r.players[p.Player.Username] = info
+	return !known
+}
+
+// SeeMove refreshes the mover's units from the snapshot in a move
+func (r *Roster) SeeMove(mv ArmyMove) {
+	r.Update(Presence{Player: mv.Player, Status: PresenceHeartbeat, SentAt: time.Now()})
+}
+
+// Remove forgets a player along with their units and reports whether
+// the player was known
+func (r *Roster) Remove(username string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, known := r.players[username]
+	delete(r.players, username)
+	return known
+}
+
+// Expire removes every player not heard from within the timeout before
+// now and returns their names. Until then Get still finds them
+func (r *Roster) Expire(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := []string{}
+	for username, info := range r.players {
+		if now.Sub(info.LastSeen) > r.timeout {
+			delete(r.players, username)
+			expired = append(expired, username)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+func (r *Roster) Get(username string) (PlayerInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info, ok := r.players[username]
+	return info, ok
+}
+
+// Players returns the known players sorted by username
+func (r *Roster) Players() []PlayerInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	players := make([]PlayerInfo, 0, len(r.players))
+	for _, info := range r.players {
+		players = append(players, info)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Player.Username < players[j].Player.Username
+	})
+	return players
+}
+
+// PrintPlayers lists players on the console for the server, clients render
+// PlayersListed events instead
+func PrintPlayers(players []PlayerInfo) {
+	ConsoleRenderer{W: os.Stdout}.Render(PlayersListed{Players: players})
+}
+
+// PowerLevel is the combined strength of all of a player's units
+func PowerLevel(p Player) int {
+	units := make([]Unit, 0, len(p.Units))
+	for _, unit := range p.Units {
+		units = append(units, unit)
+	}
+	return unitsToPowerLevel(units)
+}
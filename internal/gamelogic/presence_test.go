@@ -0,0 +1,141 @@
+package gamelogic
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// clock is a roster clock the test moves by hand
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time          { return c.now }
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func presence(username string, status PresenceStatus, units ...Unit) Presence {
+	p := Player{Username: username, Units: map[int]Unit{}}
+	for _, unit := range units {
+		p.Units[unit.ID] = unit
+	}
+	return Presence{Player: p, Status: status}
+}
+
+func newTestRoster() (*Roster, *clock) {
+	c := &clock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	r := NewRoster(PresenceTimeout)
+	r.now = c.Now
+	return r, c
+}
+
+func TestRosterUpdate(t *testing.T) {
+	r, c := newTestRoster()
+	joined := c.now
+
+	if !r.Update(presence("alice", PresenceJoin)) {
+		t.Error("first presence of alice is not reported new")
+	}
+	c.Advance(HeartbeatInterval)
+	if r.Update(presence("alice", PresenceHeartbeat, Unit{ID: 1, Rank: RankInfantry, Location: "asia"})) {
+		t.Error("heartbeat of a known player is reported new")
+	}
+
+	info, ok := r.Get("alice")
+	if !ok {
+		t.Fatal("alice is not in the roster")
+	}
+	if !info.JoinedAt.Equal(joined) || !info.LastSeen.Equal(c.now) || len(info.Player.Units) != 1 {
+		t.Errorf("alice is %+v, want joined at %v, seen at %v with one unit", info, joined, c.now)
+	}
+
+	// a heartbeat is enough to be seen, joins can be missed
+	if !r.Update(presence("bob", PresenceHeartbeat)) {
+		t.Error("first heartbeat of bob is not reported new")
+	}
+	c.Advance(time.Second)
+	r.SeeMove(ArmyMove{Player: Player{Username: "bob", Units: map[int]Unit{2: {ID: 2, Rank: RankCavalry, Location: "europe"}}}})
+	if info, _ := r.Get("bob"); !info.LastSeen.Equal(c.now) || len(info.Player.Units) != 1 {
+		t.Errorf("bob is %+v after a move, want the units of the move seen at %v", info, c.now)
+	}
+
+	if r.Update(presence("alice", PresenceLeave)) {
+		t.Error("leave is reported as a new player")
+	}
+	if _, ok := r.Get("alice"); ok {
+		t.Error("alice is still in the roster after leaving")
+	}
+	players := []string{}
+	for _, info := range r.Players() {
+		players = append(players, info.Player.Username)
+	}
+	if !slices.Equal(players, []string{"bob"}) {
+		t.Errorf("Players = %q, want bob only", players)
+	}
+}
+
+func TestRosterRemove(t *testing.T) {
+	r, _ := newTestRoster()
+	r.Update(presence("alice", PresenceJoin))
+	if !r.Remove("alice") {
+		t.Error("first Remove did not know alice")
+	}
+	if r.Remove("alice") {
+		t.Error("second Remove still knew alice")
+	}
+	if !r.Update(presence("alice", PresenceJoin)) {
+		t.Error("alice is not new after being removed")
+	}
+}
+
+func TestRosterExpire(t *testing.T) {
+	tests := []struct {
+		name    string
+		silence time.Duration // since the last presence of alice
+		expired bool
+	}{
+		{"heard from just now", 0, false},
+		{"missed two heartbeats", 2 * HeartbeatInterval, false},
+		{"exactly the timeout", PresenceTimeout, false},
+		{"past the timeout", PresenceTimeout + time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, c := newTestRoster()
+			r.Update(presence("alice", PresenceJoin))
+			c.Advance(tt.silence)
+			r.Update(presence("bob", PresenceJoin))
+
+			// the name stays taken until the roster is swept
+			if _, ok := r.Get("alice"); !ok {
+				t.Error("alice is gone before the roster was swept")
+			}
+
+			want := []string{}
+			if tt.expired {
+				want = []string{"alice"}
+			}
+			if got := r.Expire(c.now); !slices.Equal(got, want) {
+				t.Errorf("Expire = %q, want %q", got, want)
+			}
+			if _, ok := r.Get("alice"); ok == tt.expired {
+				t.Errorf("alice in the roster is %v after the sweep, want %v", ok, !tt.expired)
+			}
+			if _, ok := r.Get("bob"); !ok {
+				t.Error("bob expired right after being seen")
+			}
+		})
+	}
+}
+
+func TestRosterExpireSorts(t *testing.T) {
+	r, c := newTestRoster()
+	for _, username := range []string{"carol", "alice", "bob"} {
+		r.Update(presence(username, PresenceJoin))
+	}
+	c.Advance(time.Hour)
+	if got := r.Expire(c.now); !slices.Equal(got, []string{"alice", "bob", "carol"}) {
+		t.Errorf("Expire = %q, want all players by name", got)
+	}
+	if len(r.Players()) != 0 {
+		t.Errorf("players %+v left after all expired", r.Players())
+	}
+}
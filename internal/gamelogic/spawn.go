@@ -5,30 +5,31 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+func (gs *GameState) CommandSpawn(words []string) (Unit, error) {
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return Unit{}, errors.New("usage: spawn <location> <rank>")
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return Unit{}, fmt.Errorf("error: %s is not a valid location", locationName)
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return Unit{}, fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
+	id := gs.newUnitID()
+	unit := Unit{
 		ID:       id,
 		Rank:     UnitRank(rank),
 		Location: Location(locationName),
-	})
+	}
+	gs.addUnit(unit)
 
-	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+	gs.Render(UnitSpawned{Unit: unit})
+	return unit, nil
 }
@@ -1,9 +1,5 @@
 package gamelogic
 
-import (
-	"fmt"
-)
-
 type WarOutcome int
 
 const (
@@ -15,79 +11,68 @@ const (
 )
 
 func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
-	fmt.Println("==== War Declared ====")
-	fmt.Printf("%s has declared war on %s!\n", rw.Attacker.Username, rw.Defender.Username)
-
 	player := gs.GetPlayerSnap()
+	e := WarResolved{Player: player.Username, War: rw}
+	defer func() {
+		e.Outcome, e.Winner, e.Loser = outcome, winner, loser
+		gs.Render(e)
+	}()
 
 	if player.Username == rw.Defender.Username {
-		fmt.Printf("%s, you published the war.\n", player.Username)
 		return WarOutcomeNotInvolved, "", ""
 	}
 
 	if player.Username != rw.Attacker.Username {
-		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
 		return WarOutcomeNotInvolved, "", ""
 	}
 
-	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
+	overlappingLocation, attackerUnits, defenderUnits := rw.Front()
 	if overlappingLocation == "" {
-		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
 		return WarOutcomeNoUnits, "", ""
 	}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
-		}
-	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
-		}
-	}
-
-	fmt.Printf("%s's units:\n", rw.Attacker.Username)
-	for _, unit := range attackerUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	fmt.Printf("%s's units:\n", rw.Defender.Username)
-	for _, unit := range defenderUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
 	attackerPower := unitsToPowerLevel(attackerUnits)
 	defenderPower := unitsToPowerLevel(defenderUnits)
-	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
-	fmt.Printf("Defender has a power level of %v\n", defenderPower)
+	e.Front = overlappingLocation
+	e.AttackerUnits, e.DefenderUnits = attackerUnits, defenderUnits
+	e.AttackerPower, e.DefenderPower = attackerPower, defenderPower
 	if attackerPower > defenderPower {
-		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
 		if player.Username == rw.Defender.Username {
-			fmt.Println("You have lost the war!")
 			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
 			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
 		}
 		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
 	} else if defenderPower > attackerPower {
-		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
 		if player.Username == rw.Attacker.Username {
-			fmt.Println("You have lost the war!")
 			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
 			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
 		}
 		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
 	}
-	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
 	gs.removeUnitsInLocation(overlappingLocation)
 	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
 }
 
+// Front returns the location the war is fought in and the units each side
+// has there. The location is empty when the armies do not meet
+func (rw RecognitionOfWar) Front() (location Location, attackerUnits []Unit, defenderUnits []Unit) {
+	location = getOverlappingLocation(rw.Attacker, rw.Defender)
+	if location == "" {
+		return "", nil, nil
+	}
+	for _, unit := range rw.Attacker.Units {
+		if unit.Location == location {
+			attackerUnits = append(attackerUnits, unit)
+		}
+	}
+	for _, unit := range rw.Defender.Units {
+		if unit.Location == location {
+			defenderUnits = append(defenderUnits, unit)
+		}
+	}
+	return location, attackerUnits, defenderUnits
+}
+
 func unitsToPowerLevel(units []Unit) int {
 	power := 0
 	for _, unit := range units {
@@ -0,0 +1,132 @@
+// Package leader elects one of the servers sharing a broker to do the work
+// only one of them may do, like pausing the game.
+//
+// The leader holds an exclusive queue. The broker refuses it to everyone
+// else and deletes it when the leader's connection closes, so the follower
+// declaring it next takes over. A leader cut off from the broker learns it
+// lost the lead once its heartbeats time out, the broker may hand the queue
+// to a follower slightly earlier
+package leader
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultRetry is how often followers try to take over the lead
+const DefaultRetry = 2 * time.Second
+
+// Election campaigns for the lead until closed
+type Election struct {
+	conn     *amqp.Connection
+	queue    string
+	retry    time.Duration
+	onChange func(leading bool)
+
+	mu      sync.Mutex
+	leading bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Campaign competes for queue on conn, trying again every retry while
+// another connection holds it. onChange is called from the election's
+// goroutine whenever the lead is won or lost, it may be nil
+func Campaign(conn *amqp.Connection, queue string, retry time.Duration, onChange func(leading bool)) *Election {
+	if retry <= 0 {
+		retry = DefaultRetry
+	}
+	e := &Election{
+		conn:     conn,
+		queue:    queue,
+		retry:    retry,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Leading reports whether this process leads right now
+func (e *Election) Leading() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+// Close stops campaigning. A leader hands the lead over right away instead
+// of when its connection closes
+func (e *Election) Close() {
+	select {
+	case <-e.stop:
+	default:
+		close(e.stop)
+	}
+	<-e.done
+}
+
+func (e *Election) run() {
+	defer close(e.done)
+	for {
+		if e.conn.IsClosed() {
+			return
+		}
+		if channel, ok := e.acquire(); ok {
+			e.lead(channel)
+		}
+		select {
+		case <-e.stop:
+			return
+		case <-time.After(e.retry):
+		}
+	}
+}
+
+// acquire declares the exclusive queue, which only works while nobody
+// else holds it
+func (e *Election) acquire() (*amqp.Channel, bool) {
+	channel, err := e.conn.Channel()
+	if err != nil {
+		slog.Debug("could not open election channel", "queue", e.queue, "err", err)
+		return nil, false
+	}
+	// the refusal closes the channel
+	if _, err := channel.QueueDeclare(e.queue, false, false, true, false, nil); err != nil {
+		slog.Debug("lead is taken", "queue", e.queue, "err", err)
+		channel.Close()
+		return nil, false
+	}
+	return channel, true
+}
+
+// lead holds the lead until the channel closes or the election is closed
+func (e *Election) lead(channel *amqp.Channel) {
+	closed := channel.NotifyClose(make(chan *amqp.Error, 1))
+	e.set(true)
+	slog.Info("took the lead", "queue", e.queue)
+
+	select {
+	case err := <-closed:
+		slog.Warn("lost the lead", "queue", e.queue, "err", err)
+	case <-e.stop:
+		if _, err := channel.QueueDelete(e.queue, false, false, false); err != nil {
+			slog.Warn("could not hand over the lead", "queue", e.queue, "err", err)
+		}
+		channel.Close()
+		slog.Info("handed over the lead", "queue", e.queue)
+	}
+	e.set(false)
+}
+
+func (e *Election) set(leading bool) {
+	e.mu.Lock()
+	e.leading = leading
+	e.mu.Unlock()
+	if e.onChange != nil {
+		e.onChange(leading)
+	}
+}
@@ -0,0 +1,142 @@
+package leader
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/membroker"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	testQueue = "leader"
+	testRetry = 100 * time.Millisecond
+	// slack is the time a candidate may take beyond the retry, for
+	// declaring the queue and a slow test machine
+	slack = 200 * time.Millisecond
+)
+
+func dial(t *testing.T, b *membroker.Broker, name string) *amqp.Connection {
+	t.Helper()
+	conn, err := b.Dial(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// candidate campaigns on a connection of its own and records the changes
+// of its lead
+type candidate struct {
+	conn     *amqp.Connection
+	election *Election
+
+	mu      sync.Mutex
+	changes []bool
+}
+
+func campaign(t *testing.T, b *membroker.Broker, name string) *candidate {
+	t.Helper()
+	c := &candidate{conn: dial(t, b, name)}
+	c.election = Campaign(c.conn, testQueue, testRetry, func(leading bool) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.changes = append(c.changes, leading)
+	})
+	t.Cleanup(c.election.Close)
+	return c
+}
+
+func (c *candidate) Changes() []bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]bool(nil), c.changes...)
+}
+
+// waitLeading waits until c leads or stops leading and returns how long
+// that took
+func waitLeading(t *testing.T, c *candidate, leading bool, within time.Duration) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for c.election.Leading() != leading {
+		if time.Since(start) > within {
+			t.Fatalf("leading is still %v after %v", !leading, within)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return time.Since(start)
+}
+
+func TestFailover(t *testing.T) {
+	b := membroker.New()
+	t.Cleanup(b.Close)
+
+	first := campaign(t, b, "first")
+	waitLeading(t, first, true, testRetry+slack)
+	second := campaign(t, b, "second")
+
+	// a few rounds of the second candidate finding the lead taken
+	time.Sleep(3 * testRetry)
+	if second.election.Leading() {
+		t.Fatal("both candidates lead")
+	}
+
+	// the broker deletes the queue of the lost connection, the second
+	// candidate takes it on its next try
+	first.conn.Close()
+	took := waitLeading(t, second, true, testRetry+slack)
+	t.Logf("the second candidate took over after %v", took)
+	waitLeading(t, first, false, slack)
+
+	if changes := first.Changes(); len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("the first candidate saw %v, want it to win and lose the lead", changes)
+	}
+	if changes := second.Changes(); len(changes) != 1 || !changes[0] {
+		t.Errorf("the second candidate saw %v, want it to win the lead", changes)
+	}
+}
+
+func TestCloseHandsOver(t *testing.T) {
+	b := membroker.New()
+	t.Cleanup(b.Close)
+
+	first := campaign(t, b, "first")
+	waitLeading(t, first, true, testRetry+slack)
+	second := campaign(t, b, "second")
+
+	// the connection stays up, Close deletes the queue itself
+	first.election.Close()
+	if first.election.Leading() {
+		t.Error("the closed election still leads")
+	}
+	waitLeading(t, second, true, testRetry+slack)
+
+	// a closed election no longer competes
+	second.election.Close()
+	time.Sleep(3 * testRetry)
+	if first.election.Leading() {
+		t.Error("the closed election took the lead again")
+	}
+}
+
+func TestOneLeader(t *testing.T) {
+	b := membroker.New()
+	t.Cleanup(b.Close)
+
+	var candidates []*candidate
+	for _, name := range []string{"a", "b", "c", "d"} {
+		candidates = append(candidates, campaign(t, b, name))
+	}
+	time.Sleep(3 * testRetry)
+	leaders := 0
+	for _, c := range candidates {
+		if c.election.Leading() {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("%d candidates lead, want 1", leaders)
+	}
+}
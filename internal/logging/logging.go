@@ -0,0 +1,108 @@
+// Package logging sets up the diagnostic log every command writes with
+// log/slog. Diagnostics go to stderr so they never mix with the game shown
+// to the player on stdout
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Config selects how much is logged and in which format
+type Config struct {
+	Level  slog.Level
+	Format string // "text" or "json"
+	// NoTime leaves out timestamps, so the output of a script is the same
+	// on every run
+	NoTime bool
+}
+
+func DefaultConfig() Config {
+	return Config{Level: slog.LevelInfo, Format: "text"}
+}
+
+// Flags registers -log-level and -log-format on fs, defaulting to the
+// PERIL_LOG_LEVEL and PERIL_LOG_FORMAT environment variables. The returned
+// function validates them once fs is parsed
+func Flags(fs *flag.FlagSet, defaults Config) func() (Config, error) {
+	level := fs.String("log-level", envOr("PERIL_LOG_LEVEL", strings.ToLower(defaults.Level.String())), "diagnostic log level: debug, info, warn or error (default $PERIL_LOG_LEVEL)")
+	format := fs.String("log-format", envOr("PERIL_LOG_FORMAT", defaults.Format), "diagnostic log format: text or json (default $PERIL_LOG_FORMAT)")
+	return func() (Config, error) {
+		cfg := defaults
+		if err := cfg.Level.UnmarshalText([]byte(*level)); err != nil {
+			return cfg, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", *level)
+		}
+		cfg.Format = strings.ToLower(*format)
+		if cfg.Format != "text" && cfg.Format != "json" {
+			return cfg, fmt.Errorf("invalid log format %q, expected text or json", *format)
+		}
+		return cfg, nil
+	}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Setup makes cfg the default slog logger, which the standard log package
+// then writes through as well
+func Setup(cfg Config) {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	if cfg.NoTime {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+	var handler slog.Handler
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(output, opts)
+	} else {
+		handler = slog.NewTextHandler(output, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// Fatal logs msg with args at error level and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Redirect sends the log to w until the returned function is called, e.g.
+// while a full screen UI owns the terminal
+func Redirect(w io.Writer) func() {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	previous := output.w
+	output.w = w
+	return func() {
+		output.mu.Lock()
+		defer output.mu.Unlock()
+		output.w = previous
+	}
+}
+
+var output = &switchWriter{w: os.Stderr}
+
+// switchWriter lets the log be redirected after the handler was created
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,237 @@
+package logsink
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+var ErrClosed = errors.New("log sink is closed")
+
+// Config controls where and when buffered game logs are flushed to disk
+type Config struct {
+	Dir           string // directory relative Path and StorePath are resolved against
+	Path          string
+	StorePath     string        // structured JSON Lines copy of the logs, empty disables it
+	Rotate        RotateConfig  // rotation of the Path file, the store is rotated with it
+	BatchSize     int           // flush as soon as this many logs are buffered
+	FlushInterval time.Duration // flush a partial batch after this long
+	QueueSize     int           // logs waiting for the writer before Write blocks
+	Fsync         bool          // fsync the file after every flush
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Dir:           ".",
+		Path:          "game.log",
+		StorePath:     "game.jsonl",
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		QueueSize:     1000,
+		Fsync:         true,
+	}
+}
+
+type entry struct {
+	gameLog routing.GameLog
+	done    func(error)
+}
+
+// Sink buffers game logs and writes them to the log file in batches
+// from a single goroutine
+type Sink struct {
+	cfg     Config
+	file    *rotatingFile
+	store   *logstore.Store
+	entries chan entry
+	stopped chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func New(cfg Config) (*Sink, error) {
+	if cfg.BatchSize <= 0 {
+		return nil, errors.New("batch size must be at least 1")
+	}
+	if cfg.FlushInterval <= 0 {
+		return nil, errors.New("flush interval must be positive")
+	}
+	if cfg.QueueSize < 0 {
+		return nil, errors.New("queue size can not be negative")
+	}
+
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("could not create logs directory: %v", err)
+		}
+		cfg.Path = inDir(cfg.Dir, cfg.Path)
+		if cfg.StorePath != "" {
+			cfg.StorePath = inDir(cfg.Dir, cfg.StorePath)
+		}
+	}
+
+	f, err := openRotatingFile(cfg.Path, cfg.Rotate)
+	if err != nil {
+		return nil, err
+	}
+
+	var store *logstore.Store
+	if cfg.StorePath != "" {
+		store, err = logstore.Open(cfg.StorePath)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.companions = append(f.companions, companion{path: cfg.StorePath, rotate: store.Rotate})
+	}
+
+	s := &Sink{
+		cfg:     cfg,
+		file:    f,
+		store:   store,
+		entries: make(chan entry, cfg.QueueSize),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write queues a game log. done is called from the writer goroutine once
+// the batch holding the log was flushed, with the flush error if any.
+// Write blocks while the queue is full, which is how the sink pushes back
+// on the subscriber
+func (s *Sink) Write(gameLog routing.GameLog, done func(error)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		done(ErrClosed)
+		return
+	}
+	s.entries <- entry{gameLog: gameLog, done: done}
+}
+
+// Pending returns how many logs are queued and not yet picked up by the writer
+func (s *Sink) Pending() int {
+	return len(s.entries)
+}
+
+// StorePath is where the structured copy of the logs is kept, empty when
+// it is disabled
+func (s *Sink) StorePath() string {
+	return s.cfg.StorePath
+}
+
+// Close flushes everything still queued and closes the log file
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	close(s.entries)
+	s.mu.Unlock()
+
+	<-s.stopped
+	if s.store != nil {
+		if err := s.store.Close(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+	return s.file.Close()
+}
+
+func (s *Sink) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]entry, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case e, ok := <-s.entries:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= s.cfg.BatchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (s *Sink) flush(batch []entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := s.writeBatch(batch)
+	for _, e := range batch {
+		e.done(err)
+	}
+}
+
+// writeBatch fails only when the batch did not reach game.log, the done
+// funcs then requeue it. The store is a queryable copy of game.log, a batch
+// that reached game.log is not retried for it, as that would write every
+// line to game.log twice
+func (s *Sink) writeBatch(batch []entry) error {
+	var lines bytes.Buffer
+	for _, e := range batch {
+		lines.WriteString(gamelogic.FormatLog(e.gameLog))
+	}
+	// game.log goes first, its rotation rotates the store before the batch
+	// reaches it
+	if err := s.file.Write(lines.Bytes(), s.cfg.Fsync); err != nil {
+		return err
+	}
+
+	if s.store == nil {
+		return nil
+	}
+	gameLogs := make([]routing.GameLog, len(batch))
+	for i, e := range batch {
+		gameLogs[i] = e.gameLog
+	}
+	if err := s.appendToStore(gameLogs); err != nil {
+		slog.Error("game logs are missing from the log store", "path", s.cfg.StorePath, "logs", len(gameLogs), "err", err)
+	}
+	return nil
+}
+
+func (s *Sink) appendToStore(gameLogs []routing.GameLog) error {
+	if err := s.store.Append(gameLogs); err != nil {
+		return err
+	}
+	if s.cfg.Fsync {
+		if err := s.store.Sync(); err != nil {
+			return fmt.Errorf("could not sync log store: %v", err)
+		}
+	}
+	return nil
+}
+
+func inDir(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,170 @@
+package logsink
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func newSink(t *testing.T, batchSize int, interval time.Duration) (*Sink, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Dir = dir
+	cfg.BatchSize = batchSize
+	cfg.FlushInterval = interval
+	cfg.Fsync = false
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+// flushed is what a done func reported, along with the number of lines
+// game.log held when it was called
+type flushed struct {
+	err   error
+	lines int
+}
+
+// write queues a log and returns the channel its done func reports to
+func write(s *Sink, message string) chan flushed {
+	done := make(chan flushed, 1)
+	gl := routing.GameLog{CurrentTime: time.Now(), Username: "alice", Message: message}
+	s.Write(gl, func(err error) {
+		data, _ := os.ReadFile(s.cfg.Path)
+		done <- flushed{err: err, lines: strings.Count(string(data), "\n")}
+	})
+	return done
+}
+
+func waitFlushed(t *testing.T, done chan flushed) flushed {
+	t.Helper()
+	select {
+	case f := <-done:
+		return f
+	case <-time.After(5 * time.Second):
+		t.Fatal("log was never flushed")
+		return flushed{}
+	}
+}
+
+func notFlushed(t *testing.T, done chan flushed, wait time.Duration) {
+	t.Helper()
+	select {
+	case f := <-done:
+		t.Fatalf("log flushed early: %+v", f)
+	case <-time.After(wait):
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+	}{
+		{"batch size", func(c *Config) { c.BatchSize = 0 }},
+		{"flush interval", func(c *Config) { c.FlushInterval = 0 }},
+		{"queue size", func(c *Config) { c.QueueSize = -1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Dir = t.TempDir()
+			tt.change(&cfg)
+			if _, err := New(cfg); err == nil {
+				t.Error("New accepted the config")
+			}
+		})
+	}
+}
+
+func TestFlushOnBatchSize(t *testing.T) {
+	s, _ := newSink(t, 3, time.Hour)
+	defer s.Close()
+
+	first := write(s, "one")
+	second := write(s, "two")
+	notFlushed(t, first, 50*time.Millisecond)
+	third := write(s, "three")
+
+	// the done funcs run once the whole batch is in game.log
+	for _, done := range []chan flushed{first, second, third} {
+		if f := waitFlushed(t, done); f.err != nil || f.lines != 3 {
+			t.Errorf("flushed with %v, game.log had %d line(s), want 3", f.err, f.lines)
+		}
+	}
+}
+
+func TestFlushOnInterval(t *testing.T) {
+	s, _ := newSink(t, 100, 20*time.Millisecond)
+	defer s.Close()
+
+	start := time.Now()
+	if f := waitFlushed(t, write(s, "one")); f.err != nil || f.lines != 1 {
+		t.Errorf("flushed with %v, game.log had %d line(s), want 1", f.err, f.lines)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("partial batch flushed after %v", time.Since(start))
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	s, dir := newSink(t, 100, time.Hour)
+	pending := []chan flushed{}
+	for range 5 {
+		pending = append(pending, write(s, "queued"))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, done := range pending {
+		if f := waitFlushed(t, done); f.err != nil || f.lines != 5 {
+			t.Errorf("flushed with %v, game.log had %d line(s), want 5", f.err, f.lines)
+		}
+	}
+
+	records, err := logstore.Find(filepath.Join(dir, "game.jsonl"), logstore.Query{Player: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Errorf("store holds %d record(s), want 5", len(records))
+	}
+
+	if f := waitFlushed(t, write(s, "late")); !errors.Is(f.err, ErrClosed) {
+		t.Errorf("write after Close flushed with %v, want %v", f.err, ErrClosed)
+	}
+	if err := s.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestStoreFailureKeepsBatch(t *testing.T) {
+	s, _ := newSink(t, 1, time.Hour)
+	defer s.Close()
+
+	// a batch that reached game.log is acked even though the store fails,
+	// redelivering it would write it to game.log again
+	s.store.Close()
+	if f := waitFlushed(t, write(s, "one")); f.err != nil || f.lines != 1 {
+		t.Errorf("flushed with %v, game.log had %d line(s), want 1", f.err, f.lines)
+	}
+}
+
+func TestFileFailureFailsBatch(t *testing.T) {
+	s, _ := newSink(t, 1, time.Hour)
+	defer s.Close()
+
+	s.file.lock.Close()
+	if f := waitFlushed(t, write(s, "one")); f.err == nil {
+		t.Error("batch that never reached game.log flushed without an error")
+	}
+}
@@ -0,0 +1,316 @@
+package logsink
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/filelock"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotateConfig controls rotation and retention of the game log file and
+// the log store rotated with it. Zero values disable the corresponding rule
+type RotateConfig struct {
+	MaxSize    int64         // rotate before the file grows beyond this many bytes
+	Every      time.Duration // rotate when a new period of this length starts, e.g. 24h
+	Compress   bool          // gzip rotated game log files, store backups stay queryable
+	MaxBackups int           // number of rotated files kept
+	MaxAge     time.Duration // rotated files older than this are removed
+}
+
+func (c RotateConfig) enabled() bool {
+	return c.MaxSize > 0 || c.Every > 0
+}
+
+// companion is a file rotated together with the log file, e.g. the log
+// store. Its backups get the same timestamp and retention
+type companion struct {
+	path   string
+	rotate func(backup string) error
+}
+
+// rotatingFile appends to a log file that may be rotated by this or any
+// other server writing to the same path. Writers coordinate through an
+// advisory lock on "<path>.lock", which is never renamed itself
+type rotatingFile struct {
+	path       string
+	cfg        RotateConfig
+	lock       *os.File
+	file       *os.File
+	companions []companion
+
+	// compressions still running in the background
+	pending sync.WaitGroup
+}
+
+func openRotatingFile(path string, cfg RotateConfig) (*rotatingFile, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open logs lock file: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("could not open logs file: %v", err)
+	}
+	return &rotatingFile{path: path, cfg: cfg, lock: lock, file: f}, nil
+}
+
+// Write appends p in one piece, rotating the file first if p would break
+// one of the rotation rules
+func (r *rotatingFile) Write(p []byte, fsync bool) error {
+	if err := filelock.Lock(r.lock); err != nil {
+		return fmt.Errorf("could not lock logs file: %v", err)
+	}
+	defer filelock.Unlock(r.lock)
+
+	if err := r.reopenIfMoved(); err != nil {
+		return err
+	}
+
+	rotated := ""
+	if r.shouldRotate(int64(len(p))) {
+		var err error
+		if rotated, err = r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.file.Write(p); err != nil {
+		return fmt.Errorf("could not write to logs file: %v", err)
+	}
+	if fsync {
+		if err := r.file.Sync(); err != nil {
+			return fmt.Errorf("could not sync logs file: %v", err)
+		}
+	}
+
+	if rotated != "" {
+		r.afterRotate(rotated)
+	}
+	return nil
+}
+
+func (r *rotatingFile) Close() error {
+	r.pending.Wait()
+	lockErr := r.lock.Close()
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	return lockErr
+}
+
+// reopenIfMoved switches to the current file at path when another server
+// rotated the one we still hold open
+func (r *rotatingFile) reopenIfMoved() error {
+	onDisk, err := os.Stat(r.path)
+	if err == nil {
+		held, err := r.file.Stat()
+		if err == nil && os.SameFile(onDisk, held) {
+			return nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+	return r.reopen()
+}
+
+func (r *rotatingFile) reopen() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	r.file.Close()
+	r.file = f
+	return nil
+}
+
+func (r *rotatingFile) shouldRotate(incoming int64) bool {
+	if !r.cfg.enabled() {
+		return false
+	}
+	info, err := r.file.Stat()
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+	if r.cfg.MaxSize > 0 && info.Size()+incoming > r.cfg.MaxSize {
+		return true
+	}
+	if r.cfg.Every > 0 && !info.ModTime().Truncate(r.cfg.Every).Equal(time.Now().Truncate(r.cfg.Every)) {
+		return true
+	}
+	return false
+}
+
+// rotate renames the current file to a timestamped backup and starts a new
+// one, then rotates the companions with the same timestamp
+func (r *rotatingFile) rotate() (string, error) {
+	stamp := time.Now().UTC().Format(backupTimeFormat)
+	backup := backupPath(r.path, stamp)
+	if err := os.Rename(r.path, backup); err != nil {
+		return "", fmt.Errorf("could not rotate logs file: %v", err)
+	}
+	if err := r.reopen(); err != nil {
+		return "", err
+	}
+	// the game log was rotated already, the batch is written either way
+	for _, c := range r.companions {
+		if err := c.rotate(backupPath(c.path, stamp)); err != nil {
+			slog.Error("could not rotate file with the game log", "path", c.path, "err", err)
+		}
+	}
+	return backup, nil
+}
+
+// backupPath is path with the rotation time before its extension
+func backupPath(path, stamp string) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), stamp, ext)
+}
+
+func (r *rotatingFile) afterRotate(backup string) {
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		if r.cfg.Compress {
+			if err := compressFile(backup); err != nil {
+				slog.Error("could not compress rotated game log", "path", backup, "err", err)
+			}
+		}
+		if err := r.removeExpired(); err != nil {
+			slog.Error("could not clean up rotated game logs", "err", err)
+		}
+	}()
+}
+
+// compressFile replaces path with path.gz
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+type backupFile struct {
+	paths   []string // the plain and compressed copy while compression runs
+	rotated time.Time
+}
+
+// removeExpired applies MaxBackups and MaxAge to the rotated files of the
+// log file and of every companion
+func (r *rotatingFile) removeExpired() error {
+	if r.cfg.MaxBackups <= 0 && r.cfg.MaxAge <= 0 {
+		return nil
+	}
+
+	errs := []error{r.removeExpiredBackups(r.path)}
+	for _, c := range r.companions {
+		errs = append(errs, r.removeExpiredBackups(c.path))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *rotatingFile) removeExpiredBackups(path string) error {
+	backups, err := listBackups(path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, backup := range backups {
+		expired := r.cfg.MaxAge > 0 && time.Since(backup.rotated) > r.cfg.MaxAge
+		if !expired && (r.cfg.MaxBackups <= 0 || i < r.cfg.MaxBackups) {
+			continue
+		}
+		for _, path := range backup.paths {
+			// another server may have removed it already
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listBackups returns the rotated copies of path, newest first. A store
+// backup and its index count as one
+func listBackups(path string) ([]backupFile, error) {
+	ext := filepath.Ext(path)
+	prefix := filepath.Base(strings.TrimSuffix(path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	byTime := map[string]*backupFile{}
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, found := strings.CutPrefix(name, prefix)
+		if !found || entry.IsDir() {
+			continue
+		}
+		stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, ".gz"), logstore.IndexSuffix)
+		stamp, found = strings.CutSuffix(stamp, ext)
+		if !found {
+			continue
+		}
+		rotated, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		backup, ok := byTime[stamp]
+		if !ok {
+			backup = &backupFile{rotated: rotated}
+			byTime[stamp] = backup
+		}
+		backup.paths = append(backup.paths, filepath.Join(filepath.Dir(path), name))
+	}
+
+	backups := make([]backupFile, 0, len(byTime))
+	for _, backup := range byTime {
+		backups = append(backups, *backup)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotated.After(backups[j].rotated)
+	})
+	return backups, nil
+}
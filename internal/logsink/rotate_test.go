@@ -0,0 +1,206 @@
+package logsink
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func TestBackupPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"game.log", "game-20260102T030405.000.log"},
+		{"logs/game.jsonl", "logs/game-20260102T030405.000.jsonl"},
+		{"logs/game", "logs/game-20260102T030405.000"},
+		{"my.game.log", "my.game-20260102T030405.000.log"},
+	}
+	for _, tt := range tests {
+		if got := backupPath(tt.path, "20260102T030405.000"); got != tt.want {
+			t.Errorf("backupPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func stamp(age time.Duration) string {
+	return time.Now().Add(-age).UTC().Format(backupTimeFormat)
+}
+
+func touch(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListBackups(t *testing.T) {
+	dir := t.TempDir()
+	newer, older := stamp(time.Minute), stamp(time.Hour)
+	touch(t, dir,
+		"game.log",
+		"game-"+older+".log.gz",
+		"game-"+newer+".log",
+		"game-"+newer+".log.gz", // compression still running
+		"game-notastamp.log",
+		"game.log.lock",
+		"game-"+newer+".jsonl",
+		"game-"+newer+".jsonl"+logstore.IndexSuffix,
+		"other-"+newer+".log",
+	)
+
+	tests := []struct {
+		path string
+		want [][]string
+	}{
+		{"game.log", [][]string{
+			{"game-" + newer + ".log", "game-" + newer + ".log.gz"},
+			{"game-" + older + ".log.gz"},
+		}},
+		{"game.jsonl", [][]string{
+			{"game-" + newer + ".jsonl", "game-" + newer + ".jsonl" + logstore.IndexSuffix},
+		}},
+		{"missing.log", [][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			backups, err := listBackups(filepath.Join(dir, tt.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := [][]string{}
+			for _, backup := range backups {
+				names := []string{}
+				for _, path := range backup.paths {
+					names = append(names, filepath.Base(path))
+				}
+				slices.Sort(names)
+				got = append(got, names)
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("listBackups = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	ages := []time.Duration{time.Minute, time.Hour, 48 * time.Hour}
+	tests := []struct {
+		name string
+		cfg  RotateConfig
+		kept []int // indexes into ages, for the log and the store alike
+	}{
+		{"no limits", RotateConfig{}, []int{0, 1, 2}},
+		{"max backups", RotateConfig{MaxBackups: 2}, []int{0, 1}},
+		{"max age", RotateConfig{MaxAge: 24 * time.Hour}, []int{0, 1}},
+		{"both", RotateConfig{MaxBackups: 2, MaxAge: 30 * time.Minute}, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stamps := []string{}
+			for _, age := range ages {
+				s := stamp(age)
+				stamps = append(stamps, s)
+				touch(t, dir, "game-"+s+".log.gz", "game-"+s+".jsonl", "game-"+s+".jsonl"+logstore.IndexSuffix)
+			}
+			r := &rotatingFile{
+				path:       filepath.Join(dir, "game.log"),
+				cfg:        tt.cfg,
+				companions: []companion{{path: filepath.Join(dir, "game.jsonl")}},
+			}
+			if err := r.removeExpired(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{}
+			for _, i := range tt.kept {
+				s := stamps[i]
+				want = append(want, "game-"+s+".log.gz", "game-"+s+".jsonl", "game-"+s+".jsonl"+logstore.IndexSuffix)
+			}
+			slices.Sort(want)
+			if got := dirNames(t, dir); !slices.Equal(got, want) {
+				t.Errorf("kept %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestRotateWithStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := logstore.Open(filepath.Join(dir, "game.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	r, err := openRotatingFile(filepath.Join(dir, "game.log"), RotateConfig{MaxSize: 10, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.companions = []companion{{path: filepath.Join(dir, "game.jsonl"), rotate: store.Rotate}}
+
+	for i := range 3 {
+		// like the sink, the batch goes to game.log first, which rotates
+		// the store before the batch reaches it
+		if err := r.Write([]byte("a full line\n"), false); err != nil {
+			t.Fatal(err)
+		}
+		gl := routing.GameLog{CurrentTime: time.Now(), Username: "alice", Message: "line"}
+		if err := store.Append([]routing.GameLog{gl}); err != nil {
+			t.Fatal(err)
+		}
+		// backups of the same millisecond would share a name
+		if i < 2 {
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs, stores, indexes int
+	for _, name := range dirNames(t, dir) {
+		switch {
+		case !strings.HasPrefix(name, "game-"):
+		case strings.HasSuffix(name, ".log"):
+			logs++
+		case strings.HasSuffix(name, ".jsonl"):
+			stores++
+		case strings.HasSuffix(name, ".jsonl"+logstore.IndexSuffix):
+			indexes++
+		}
+	}
+	if logs != 1 || stores != 1 || indexes != 1 {
+		t.Errorf("kept %d log, %d store and %d index backup(s), want one each: %q", logs, stores, indexes, dirNames(t, dir))
+	}
+
+	// the live store only holds what was appended since the last rotation
+	records, err := logstore.Find(filepath.Join(dir, "game.jsonl"), logstore.Query{Player: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Errorf("live store holds %d record(s), want 1", len(records))
+	}
+}
@@ -0,0 +1,216 @@
+package logstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+const followPollInterval = 500 * time.Millisecond
+
+// Query filters records, zero values match everything
+type Query struct {
+	Player string
+	Events []routing.EventType // match any of these, "message" matches free text logs
+	Since  time.Time
+	Until  time.Time
+	Text   string // case insensitive match against the message
+	Limit  int    // keep only the last Limit matches
+}
+
+func (q Query) Match(r Record) bool {
+	if q.Player != "" && r.Username != q.Player {
+		return false
+	}
+	if len(q.Events) > 0 && !slices.Contains(q.Events, r.Event) {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.Time.After(q.Until) {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(r.Message), strings.ToLower(q.Text)) {
+		return false
+	}
+	return true
+}
+
+// Find returns the records matching q in the order they were stored.
+// Player queries only read the lines listed in the index
+func Find(path string, q Query) ([]Record, error) {
+	data, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open log store: %v", err)
+	}
+	defer data.Close()
+
+	var records []Record
+	if q.Player != "" {
+		records, err = findIndexed(data, path+IndexSuffix, q)
+	} else {
+		records, _, err = scan(data, 0, q)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records, nil
+}
+
+// Follow calls fn for every matching record appended to the store after it
+// was called, until ctx is cancelled or fn returns an error. It carries on
+// with the new store once the followed one was rotated
+func Follow(ctx context.Context, path string, q Query, fn func(Record) error) error {
+	data, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open log store: %v", err)
+	}
+	defer func() { data.Close() }()
+
+	offset, err := data.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("could not read log store: %v", err)
+	}
+
+	q.Limit = 0
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// checked before reading, so the lines written to the old store
+		// right before it was rotated are read too
+		current, moved := reopenIfMoved(path, data)
+
+		records, next, err := scan(data, offset, q)
+		if err == nil {
+			offset = next
+			err = emit(records, fn)
+		}
+		if err != nil {
+			if moved {
+				current.Close()
+			}
+			return err
+		}
+
+		if moved {
+			data.Close()
+			data, offset = current, 0
+		}
+	}
+}
+
+func emit(records []Record, fn func(Record) error) error {
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reopenIfMoved opens the file at path when it is no longer the one held
+func reopenIfMoved(path string, held *os.File) (*os.File, bool) {
+	onDisk, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	heldInfo, err := held.Stat()
+	if err != nil || os.SameFile(onDisk, heldInfo) {
+		return nil, false
+	}
+	current, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	return current, true
+}
+
+func findIndexed(data *os.File, indexPath string, q Query) ([]Record, error) {
+	index, err := os.Open(indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		records, _, err := scan(data, 0, q)
+		return records, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open log store index: %v", err)
+	}
+	defer index.Close()
+
+	entries, err := readIndex(index)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	reader := bufio.NewReader(data)
+	for _, entry := range entries {
+		if entry.username != q.Player {
+			continue
+		}
+		if _, err := data.Seek(entry.offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("could not read log store: %v", err)
+		}
+		reader.Reset(data)
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		if q.Match(record) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// scan reads complete lines starting at offset and returns the matching
+// records along with the offset right after the last complete line
+func scan(data *os.File, offset int64, q Query) ([]Record, int64, error) {
+	if _, err := data.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, fmt.Errorf("could not read log store: %v", err)
+	}
+
+	records := []Record{}
+	reader := bufio.NewReader(data)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return records, offset, nil
+		}
+		if err != nil {
+			return nil, offset, fmt.Errorf("could not read log store: %v", err)
+		}
+		offset += int64(len(line))
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		if q.Match(record) {
+			records = append(records, record)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package logstore
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func TestFind(t *testing.T) {
+	s, path := openStore(t)
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	logs := []routing.GameLog{
+		gameLog("alice", routing.EventSpawn, "alice spawned infantry", start),
+		gameLog("bob", routing.EventMove, "bob moved to europe", start.Add(time.Minute)),
+		gameLog("alice", routing.EventWarWon, "alice won a war", start.Add(2*time.Minute)),
+		gameLog("bob smith", routing.EventMessage, "hello from Bob Smith", start.Add(3*time.Minute)),
+		gameLog("alice", routing.EventMessage, "GG", start.Add(4*time.Minute)),
+	}
+	// two batches, the offsets of the second follow the first
+	if err := s.Append(logs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(logs[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string // messages, in order
+	}{
+		{"everything", Query{}, []string{"alice spawned infantry", "bob moved to europe", "alice won a war", "hello from Bob Smith", "GG"}},
+		{"player", Query{Player: "alice"}, []string{"alice spawned infantry", "alice won a war", "GG"}},
+		{"player with a space", Query{Player: "bob smith"}, []string{"hello from Bob Smith"}},
+		{"prefix of a player", Query{Player: "bob"}, []string{"bob moved to europe"}},
+		{"unknown player", Query{Player: "carol"}, []string{}},
+		{"events", Query{Events: []routing.EventType{routing.EventMove, routing.EventWarWon}}, []string{"bob moved to europe", "alice won a war"}},
+		{"since and until", Query{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, []string{"bob moved to europe", "alice won a war", "hello from Bob Smith"}},
+		{"text ignores case", Query{Text: "bob"}, []string{"bob moved to europe", "hello from Bob Smith"}},
+		{"limit keeps the last", Query{Player: "alice", Limit: 2}, []string{"alice won a war", "GG"}},
+		{"player and event", Query{Player: "alice", Events: []routing.EventType{routing.EventMessage}}, []string{"GG"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := Find(path, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, r := range records {
+				got = append(got, r.Message)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Find = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindWithoutIndex(t *testing.T) {
+	s, path := openStore(t)
+	at := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	if err := s.Append([]routing.GameLog{gameLog("alice", routing.EventSpawn, "spawned", at)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path + IndexSuffix); err != nil {
+		t.Fatal(err)
+	}
+	records, err := Find(path, Query{Player: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Errorf("found %d records by scanning, want 1", len(records))
+	}
+}
+
+func TestFindMissingStore(t *testing.T) {
+	if _, err := Find(t.TempDir()+"/missing.jsonl", Query{}); err == nil {
+		t.Error("Find of a missing store succeeded")
+	}
+}
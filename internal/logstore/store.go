@@ -0,0 +1,332 @@
+// Package logstore keeps game logs as JSON Lines together with a per player
+// index of line offsets, so logs can be queried without parsing game.log
+package logstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/filelock"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+const (
+	IndexSuffix = ".idx" // the index of a store is kept at its path plus IndexSuffix
+	lockSuffix  = ".lock"
+)
+
+// Record is a single stored game log
+type Record struct {
+	Time     time.Time            `json:"time"`
+	Username string               `json:"username"`
+	Message  string               `json:"message"`
+	Event    routing.EventType    `json:"event,omitempty"`
+	Location string               `json:"location,omitempty"`
+	Opponent string               `json:"opponent,omitempty"`
+	Winner   string               `json:"winner,omitempty"`
+	Loser    string               `json:"loser,omitempty"`
+	Units    []routing.LoggedUnit `json:"units,omitempty"`
+}
+
+func FromGameLog(gl routing.GameLog) Record {
+	return Record{
+		Time:     gl.CurrentTime,
+		Username: gl.Username,
+		Message:  gl.Message,
+		Event:    gl.Event,
+		Location: gl.Location,
+		Opponent: gl.Opponent,
+		Winner:   gl.Winner,
+		Loser:    gl.Loser,
+		Units:    gl.Units,
+	}
+}
+
+func (r Record) GameLog() routing.GameLog {
+	return routing.GameLog{
+		CurrentTime: r.Time,
+		Username:    r.Username,
+		Message:     r.Message,
+		Event:       r.Event,
+		Location:    r.Location,
+		Opponent:    r.Opponent,
+		Winner:      r.Winner,
+		Loser:       r.Loser,
+		Units:       r.Units,
+	}
+}
+
+// Store appends game logs to a JSON Lines file. Every record also gets a
+// "<quoted username> <offset>" line in the index file next to it. Servers sharing
+// the store coordinate through an advisory lock on "<path>.lock", which
+// stays in place when the store is rotated
+type Store struct {
+	path  string
+	lock  *os.File
+	data  *os.File
+	index *os.File
+}
+
+func Open(path string) (*Store, error) {
+	lock, err := os.OpenFile(path+lockSuffix, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open log store lock file: %v", err)
+	}
+	s := &Store{path: path, lock: lock}
+	if err := s.open(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	if err := filelock.Lock(s.lock); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("could not lock log store: %v", err)
+	}
+	defer filelock.Unlock(s.lock)
+	if err := s.repairIndex(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) open() error {
+	data, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open log store: %v", err)
+	}
+	index, err := os.OpenFile(s.path+IndexSuffix, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		data.Close()
+		return fmt.Errorf("could not open log store index: %v", err)
+	}
+	if s.data != nil {
+		s.data.Close()
+		s.index.Close()
+	}
+	s.data, s.index = data, index
+	return nil
+}
+
+// reopenIfMoved switches to the current files at path when another server
+// rotated the ones we still hold open
+func (s *Store) reopenIfMoved() error {
+	onDisk, err := os.Stat(s.path)
+	if err == nil {
+		held, err := s.data.Stat()
+		if err == nil && os.SameFile(onDisk, held) {
+			return nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not stat log store: %v", err)
+	}
+	return s.open()
+}
+
+// Rotate moves the store to backup and its index to backup.idx, then
+// starts an empty store at the old path
+func (s *Store) Rotate(backup string) error {
+	if err := filelock.Lock(s.lock); err != nil {
+		return fmt.Errorf("could not lock log store: %v", err)
+	}
+	defer filelock.Unlock(s.lock)
+
+	if err := s.reopenIfMoved(); err != nil {
+		return err
+	}
+	info, err := s.data.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat log store: %v", err)
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+
+	// the index goes first, a store without one is still read by scanning
+	if err := os.Rename(s.path+IndexSuffix, backup+IndexSuffix); err != nil {
+		return fmt.Errorf("could not rotate log store index: %v", err)
+	}
+	if err := os.Rename(s.path, backup); err != nil {
+		return fmt.Errorf("could not rotate log store: %v", err)
+	}
+	return s.open()
+}
+
+// Append writes a batch of game logs. The whole batch is written while
+// holding the store lock so concurrent servers never interleave
+func (s *Store) Append(logs []routing.GameLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	if err := filelock.Lock(s.lock); err != nil {
+		return fmt.Errorf("could not lock log store: %v", err)
+	}
+	defer filelock.Unlock(s.lock)
+
+	if err := s.reopenIfMoved(); err != nil {
+		return err
+	}
+
+	info, err := s.data.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat log store: %v", err)
+	}
+	offset := info.Size()
+
+	var data, index bytes.Buffer
+	for _, gl := range logs {
+		line, err := json.Marshal(FromGameLog(gl))
+		if err != nil {
+			return fmt.Errorf("could not encode game log: %v", err)
+		}
+		writeIndexEntry(&index, gl.Username, offset+int64(data.Len()))
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+
+	// data goes first, a missing index entry is rebuilt on the next Open
+	if _, err := s.data.Write(data.Bytes()); err != nil {
+		return fmt.Errorf("could not write to log store: %v", err)
+	}
+	if _, err := s.index.Write(index.Bytes()); err != nil {
+		return fmt.Errorf("could not write to log store index: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) Sync() error {
+	if err := s.data.Sync(); err != nil {
+		return err
+	}
+	return s.index.Sync()
+}
+
+func (s *Store) Close() error {
+	lockErr := s.lock.Close()
+	indexErr := s.index.Close()
+	if err := s.data.Close(); err != nil {
+		return err
+	}
+	if indexErr != nil {
+		return indexErr
+	}
+	return lockErr
+}
+
+// repairIndex indexes records that were written to the data file but never
+// made it into the index, e.g. because the server crashed in between.
+// The caller holds the store lock
+func (s *Store) repairIndex() error {
+	next, err := nextUnindexedOffset(s.index, s.data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.data.Seek(next, io.SeekStart); err != nil {
+		return fmt.Errorf("could not read log store: %v", err)
+	}
+	var index bytes.Buffer
+	offset := next
+	reader := bufio.NewReader(s.data)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// a partial last line is left alone, it is skipped when reading
+			break
+		}
+		var record Record
+		if json.Unmarshal(line, &record) == nil {
+			writeIndexEntry(&index, record.Username, offset)
+		}
+		offset += int64(len(line))
+	}
+
+	if index.Len() == 0 {
+		return nil
+	}
+	if _, err := s.index.Write(index.Bytes()); err != nil {
+		return fmt.Errorf("could not repair log store index: %v", err)
+	}
+	return nil
+}
+
+// nextUnindexedOffset returns the offset of the line following the last
+// indexed record
+func nextUnindexedOffset(index, data *os.File) (int64, error) {
+	entries, err := readIndex(index)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	last := entries[len(entries)-1].offset
+	if _, err := data.Seek(last, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("could not read log store: %v", err)
+	}
+	line, err := bufio.NewReader(data).ReadBytes('\n')
+	if err != nil {
+		return last, nil
+	}
+	return last + int64(len(line)), nil
+}
+
+type indexEntry struct {
+	username string
+	offset   int64
+}
+
+// writeIndexEntry quotes the username, so one with spaces or line breaks
+// still takes exactly one index line
+func writeIndexEntry(w io.Writer, username string, offset int64) {
+	fmt.Fprintf(w, "%s %d\n", strconv.Quote(username), offset)
+}
+
+// parseIndexEntry reads a line written by writeIndexEntry. Indexes written
+// before usernames were quoted hold them as they are
+func parseIndexEntry(line string) (indexEntry, bool) {
+	space := strings.LastIndexByte(line, ' ')
+	if space < 0 {
+		return indexEntry{}, false
+	}
+	offset, err := strconv.ParseInt(line[space+1:], 10, 64)
+	if err != nil {
+		return indexEntry{}, false
+	}
+	username := line[:space]
+	if strings.HasPrefix(username, `"`) {
+		if username, err = strconv.Unquote(username); err != nil {
+			return indexEntry{}, false
+		}
+	}
+	return indexEntry{username: username, offset: offset}, true
+}
+
+func readIndex(r io.ReadSeeker) ([]indexEntry, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("could not read log store index: %v", err)
+	}
+	entries := []indexEntry{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry, ok := parseIndexEntry(scanner.Text())
+		if !ok {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read log store index: %v", err)
+	}
+	return entries, nil
+}
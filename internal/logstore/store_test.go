@@ -0,0 +1,153 @@
+package logstore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func TestIndexEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		offset   int64
+	}{
+		{"plain", "alice", 0},
+		{"space", "alice smith", 42},
+		{"line break", "alice\nbob 7", 1 << 40},
+		{"quote", `"alice"`, 3},
+		{"empty", "", 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var line bytes.Buffer
+			writeIndexEntry(&line, tt.username, tt.offset)
+			if bytes.Count(line.Bytes(), []byte("\n")) != 1 {
+				t.Fatalf("entry %q takes more than one line", line.String())
+			}
+			entry, ok := parseIndexEntry(string(bytes.TrimSuffix(line.Bytes(), []byte("\n"))))
+			if !ok {
+				t.Fatalf("could not parse %q", line.String())
+			}
+			if entry.username != tt.username || entry.offset != tt.offset {
+				t.Errorf("parsed %+v, want %q at %d", entry, tt.username, tt.offset)
+			}
+		})
+	}
+}
+
+func TestParseIndexEntry(t *testing.T) {
+	tests := []struct {
+		line string
+		want indexEntry
+		ok   bool
+	}{
+		{`"alice" 12`, indexEntry{"alice", 12}, true},
+		{"alice 12", indexEntry{"alice", 12}, true}, // written before quoting
+		{`"a b" 5`, indexEntry{"a b", 5}, true},
+		{"alice", indexEntry{}, false},
+		{"alice twelve", indexEntry{}, false},
+		{`"alice 12`, indexEntry{}, false},
+		{"", indexEntry{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok := parseIndexEntry(tt.line)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseIndexEntry(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func gameLog(username string, event routing.EventType, message string, at time.Time) routing.GameLog {
+	return routing.GameLog{CurrentTime: at, Username: username, Event: event, Message: message}
+}
+
+func openStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "game.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func TestRepairIndex(t *testing.T) {
+	s, path := openStore(t)
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := s.Append([]routing.GameLog{gameLog("alice", routing.EventSpawn, "spawned", at)}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// a record that made it to the data file but not to the index, then a
+	// partial line of a crashed write
+	data, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.WriteString(`{"time":"2026-01-02T03:04:06Z","username":"bob smith","message":"moved","event":"move"}` + "\n")
+	data.WriteString(`{"time":"2026-01-02T03:04:07Z","username":"bob smith"`)
+	data.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	records, err := Find(path, Query{Player: "bob smith"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Message != "moved" {
+		t.Errorf("found %+v, want the repaired record only", records)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s, path := openStore(t)
+	backup := filepath.Join(filepath.Dir(path), "game-1.jsonl")
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// an empty store is left alone
+	if err := s.Rotate(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Fatalf("rotating an empty store created %s", backup)
+	}
+
+	if err := s.Append([]routing.GameLog{gameLog("alice", routing.EventSpawn, "before", at)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rotate(backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append([]routing.GameLog{gameLog("alice", routing.EventSpawn, "after", at)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{backup, "before"},
+		{path, "after"},
+	}
+	for _, tt := range tests {
+		records, err := Find(tt.path, Query{Player: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0].Message != tt.want {
+			t.Errorf("%s holds %+v, want only %q", filepath.Base(tt.path), records, tt.want)
+		}
+	}
+}
@@ -0,0 +1,487 @@
+// Package membroker is an AMQP 0-9-1 broker kept in memory, so the
+// scenario runner and tests play Peril without RabbitMQ.
+//
+// It speaks the part of the protocol Peril relies on: direct, topic and
+// fanout exchanges, durable, exclusive and auto deleted queues, consumers
+// with a prefetch, acks and nacks, dead lettering, message and queue TTLs,
+// length limits, single active consumers, mandatory publishing, publisher
+// confirms and RabbitMQ's direct reply-to. Quorum queues and streams behave
+// like classic queues and nothing outlives the Broker
+package membroker
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// directReplyTo is the pseudo queue RabbitMQ delivers replies from
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+// Exchange kinds
+const (
+	Direct = "direct"
+	Topic  = "topic"
+	Fanout = "fanout"
+)
+
+// Broker routes messages between the connections opened with Dial
+type Broker struct {
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+	conns     map[*conn]bool
+	lastID    int // numbers generated queue names and consumer tags
+}
+
+type exchange struct {
+	name     string
+	kind     string
+	bindings []binding
+}
+
+type binding struct {
+	queue, key string
+}
+
+type queue struct {
+	name       string
+	durable    bool
+	autoDelete bool
+	owner      *conn // of an exclusive queue
+
+	deadLetterExchange string
+	deadLetterKey      string // replaces the routing key of dead letters when set
+	ttl                time.Duration
+	hasTTL             bool
+	maxLength          int
+	maxLengthBytes     int
+	overflow           string
+	singleActive       bool
+
+	messages  []*message
+	consumers []*consumer
+	next      int  // the consumer to try first
+	consumed  bool // had a consumer, an auto deleted queue goes with the last one
+}
+
+type message struct {
+	exchange    string
+	key         string
+	props       properties
+	body        []byte
+	expiresAt   time.Time
+	redelivered bool
+}
+
+type consumer struct {
+	tag       string
+	queue     *queue
+	channel   *channel
+	noAck     bool
+	exclusive bool
+	prefetch  int
+	unacked   int
+}
+
+// delivery is a message handed to a consumer and not settled yet
+type delivery struct {
+	msg      *message
+	queue    *queue
+	consumer *consumer
+}
+
+func New() *Broker {
+	b := &Broker{
+		exchanges: map[string]*exchange{},
+		queues:    map[string]*queue{},
+		conns:     map[*conn]bool{},
+	}
+	// the default exchange routes to the queue named by the routing key
+	b.exchanges[""] = &exchange{kind: Direct}
+	b.exchanges["amq.direct"] = &exchange{name: "amq.direct", kind: Direct}
+	b.exchanges["amq.topic"] = &exchange{name: "amq.topic", kind: Topic}
+	b.exchanges["amq.fanout"] = &exchange{name: "amq.fanout", kind: Fanout}
+	return b
+}
+
+// DeclareExchange adds an exchange of kind Direct, Topic or Fanout, like
+// an operator setting up the broker would. Declaring it again is a no-op
+func (b *Broker) DeclareExchange(name, kind string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.declareExchange(name, kind)
+}
+
+func (b *Broker) declareExchange(name, kind string) error {
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - inequivalent arg 'type' for exchange '%s': received '%s' but current is '%s'", name, kind, ex.kind)
+		}
+		return nil
+	}
+	if kind != Direct && kind != Topic && kind != Fanout {
+		return channelError(commandInvalid, "COMMAND_INVALID - unknown exchange type '%s'", kind)
+	}
+	b.exchanges[name] = &exchange{name: name, kind: kind}
+	return nil
+}
+
+// Dial opens a connection to the broker, name shows up as its connection
+// name like it would in the management UI
+func (b *Broker) Dial(name string) (*amqp.Connection, error) {
+	client, server := net.Pipe()
+	c := b.accept(server)
+	go c.serve()
+
+	properties := amqp.NewConnectionProperties()
+	if name != "" {
+		properties.SetClientConnectionName(name)
+	}
+	conn, err := amqp.Open(client, amqp.Config{
+		SASL:       []amqp.Authentication{&amqp.PlainAuth{Username: "guest", Password: "guest"}},
+		Vhost:      "/",
+		Locale:     "en_US",
+		Properties: properties,
+	})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not connect to the memory broker: %v", err)
+	}
+	return conn, nil
+}
+
+// Close drops every connection, like a broker shutting down
+func (b *Broker) Close() {
+	b.mu.Lock()
+	conns := make([]*conn, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+	for _, c := range conns {
+		c.net.Close()
+	}
+}
+
+func (b *Broker) newID() int {
+	b.lastID++
+	return b.lastID
+}
+
+// live reports whether q was not deleted
+func (b *Broker) live(q *queue) bool {
+	return b.queues[q.name] == q
+}
+
+func (b *Broker) route(ex *exchange, key string) []*queue {
+	if ex.name == "" {
+		if q, ok := b.queues[key]; ok {
+			return []*queue{q}
+		}
+		return nil
+	}
+	var queues []*queue
+	for _, bind := range ex.bindings {
+		if !ex.matches(bind.key, key) {
+			continue
+		}
+		q, ok := b.queues[bind.queue]
+		if ok && !slices.Contains(queues, q) {
+			queues = append(queues, q)
+		}
+	}
+	return queues
+}
+
+func (ex *exchange) matches(pattern, key string) bool {
+	switch ex.kind {
+	case Fanout:
+		return true
+	case Topic:
+		return topicMatch(strings.Split(pattern, "."), strings.Split(key, "."))
+	}
+	return pattern == key
+}
+
+// topicMatch matches routing key words against a binding, where * stands
+// for one word and # for any number of them
+func topicMatch(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatch(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatch(pattern[1:], words[1:])
+	}
+	return len(words) > 0 && words[0] == pattern[0] && topicMatch(pattern[1:], words[1:])
+}
+
+// publish routes a message from ch
+func (b *Broker) publish(ch *channel, p *publishing) error {
+	ex, ok := b.exchanges[p.exchange]
+	if !ok {
+		return channelError(notFound, "NOT_FOUND - no exchange '%s' in vhost '/'", p.exchange)
+	}
+	if p.props.str(propReplyTo) == directReplyTo {
+		if ch.replyQueue == "" {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - fast reply consumer does not exist")
+		}
+		p.props.setStr(propReplyTo, ch.replyQueue)
+	}
+
+	msg := &message{exchange: p.exchange, key: p.key, props: p.props, body: p.body}
+	queues := b.route(ex, p.key)
+	if len(queues) == 0 && p.mandatory {
+		ch.conn.sendContent(ch.id, basicReturn, func(e *encoder) {
+			e.short(noRoute)
+			e.shortstr("NO_ROUTE")
+			e.shortstr(p.exchange)
+			e.shortstr(p.key)
+		}, msg)
+	}
+	for _, q := range queues {
+		b.enqueue(q, msg)
+	}
+	if ch.confirming {
+		ch.published++
+		ch.conn.sendMethod(ch.id, basicAck, func(e *encoder) {
+			e.longlong(ch.published)
+			e.bits(false)
+		})
+	}
+	for _, q := range queues {
+		b.dispatch(q)
+	}
+	return nil
+}
+
+// enqueue adds a copy of msg to q, applying the TTL and length limits
+func (b *Broker) enqueue(q *queue, msg *message) {
+	m := *msg
+	m.redelivered = false
+	now := time.Now()
+	if ms, ok := m.props.expiration(); ok {
+		m.expiresAt = now.Add(time.Duration(ms) * time.Millisecond)
+	}
+	if q.hasTTL && (m.expiresAt.IsZero() || now.Add(q.ttl).Before(m.expiresAt)) {
+		m.expiresAt = now.Add(q.ttl)
+	}
+
+	for q.full(&m) {
+		if q.overflow == "reject-publish" || q.overflow == "reject-publish-dlx" {
+			if q.overflow == "reject-publish-dlx" {
+				b.deadLetter(q, &m)
+			}
+			return
+		}
+		if len(q.messages) == 0 {
+			// a single message over the byte limit
+			b.deadLetter(q, &m)
+			return
+		}
+		head := q.messages[0]
+		q.messages = q.messages[1:]
+		b.deadLetter(q, head)
+	}
+	q.messages = append(q.messages, &m)
+}
+
+// full reports whether adding m would break a length limit
+func (q *queue) full(m *message) bool {
+	if q.maxLength > 0 && len(q.messages)+1 > q.maxLength {
+		return true
+	}
+	if q.maxLengthBytes > 0 {
+		size := len(m.body)
+		for _, queued := range q.messages {
+			size += len(queued.body)
+		}
+		return size > q.maxLengthBytes
+	}
+	return false
+}
+
+// deadLetter republishes a rejected, expired or dropped message to the
+// dead letter exchange of q, if it has one
+func (b *Broker) deadLetter(q *queue, msg *message) {
+	ex, ok := b.exchanges[q.deadLetterExchange]
+	if q.deadLetterExchange == "" || !ok {
+		return
+	}
+	m := *msg
+	m.exchange = ex.name
+	if q.deadLetterKey != "" {
+		m.key = q.deadLetterKey
+	}
+	// the TTL is not carried over, or the message would expire again
+	m.props.setStr(propExpiration, "")
+	m.expiresAt = time.Time{}
+	for _, target := range b.route(ex, m.key) {
+		b.enqueue(target, &m)
+		if target != q {
+			b.dispatch(target)
+		}
+	}
+}
+
+// dispatch hands queued messages to consumers with room for them
+func (b *Broker) dispatch(q *queue) {
+	for len(q.messages) > 0 {
+		m := q.messages[0]
+		if !m.expiresAt.IsZero() && time.Now().After(m.expiresAt) {
+			q.messages = q.messages[1:]
+			b.deadLetter(q, m)
+			continue
+		}
+		c := q.pick()
+		if c == nil {
+			return
+		}
+		q.messages = q.messages[1:]
+		c.deliver(m)
+	}
+}
+
+// pick takes turns among the consumers with room for another message
+func (q *queue) pick() *consumer {
+	candidates := q.consumers
+	if q.singleActive && len(candidates) > 0 {
+		candidates = candidates[:1]
+	}
+	for i := range candidates {
+		c := candidates[(q.next+i)%len(candidates)]
+		if c.ready() {
+			q.next = (q.next + i + 1) % len(candidates)
+			return c
+		}
+	}
+	return nil
+}
+
+func (c *consumer) ready() bool {
+	return !c.channel.closing && (c.noAck || c.prefetch == 0 || c.unacked < c.prefetch)
+}
+
+func (c *consumer) deliver(m *message) {
+	ch := c.channel
+	ch.lastTag++
+	tag := ch.lastTag
+	if !c.noAck {
+		ch.unacked[tag] = &delivery{msg: m, queue: c.queue, consumer: c}
+		c.unacked++
+	}
+	ch.conn.sendContent(ch.id, basicDeliver, func(e *encoder) {
+		e.shortstr(c.tag)
+		e.longlong(tag)
+		e.bits(m.redelivered)
+		e.shortstr(m.exchange)
+		e.shortstr(m.key)
+	}, m)
+}
+
+func (q *queue) removeConsumer(c *consumer) {
+	q.consumers = slices.DeleteFunc(q.consumers, func(other *consumer) bool {
+		return other == c
+	})
+	q.next = 0
+}
+
+// maybeAutoDelete deletes an auto deleted queue once its last consumer
+// is gone and reports whether it did
+func (b *Broker) maybeAutoDelete(q *queue) bool {
+	if !q.autoDelete || !q.consumed || len(q.consumers) > 0 || !b.live(q) {
+		return false
+	}
+	b.deleteQueue(q)
+	return true
+}
+
+// deleteQueue drops q with its messages and bindings and tells its
+// consumers they were cancelled
+func (b *Broker) deleteQueue(q *queue) {
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		ex.bindings = slices.DeleteFunc(ex.bindings, func(bind binding) bool {
+			return bind.queue == q.name
+		})
+	}
+	for _, c := range q.consumers {
+		delete(c.channel.consumers, c.tag)
+		if !c.channel.closing {
+			c.channel.conn.sendMethod(c.channel.id, basicCancel, func(e *encoder) {
+				e.shortstr(c.tag)
+				e.bits(true)
+			})
+		}
+	}
+	q.consumers = nil
+	q.messages = nil
+}
+
+// configure reads the x- arguments of a queue declaration
+func (q *queue) configure(args map[string]any) error {
+	if value, ok := args["x-dead-letter-exchange"]; ok {
+		name, ok := value.(string)
+		if !ok {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - invalid arg 'x-dead-letter-exchange'")
+		}
+		q.deadLetterExchange = name
+	}
+	if value, ok := args["x-dead-letter-routing-key"]; ok {
+		key, ok := value.(string)
+		if !ok {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - invalid arg 'x-dead-letter-routing-key'")
+		}
+		q.deadLetterKey = key
+	}
+	if value, ok := args["x-message-ttl"]; ok {
+		ms, ok := value.(int64)
+		if !ok || ms < 0 {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - invalid arg 'x-message-ttl'")
+		}
+		q.ttl = time.Duration(ms) * time.Millisecond
+		q.hasTTL = true
+	}
+	if value, ok := args["x-max-length"]; ok {
+		length, ok := value.(int64)
+		if !ok || length < 0 {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - invalid arg 'x-max-length'")
+		}
+		q.maxLength = int(length)
+	}
+	if value, ok := args["x-max-length-bytes"]; ok {
+		length, ok := value.(int64)
+		if !ok || length < 0 {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - invalid arg 'x-max-length-bytes'")
+		}
+		q.maxLengthBytes = int(length)
+	}
+	if value, ok := args["x-overflow"]; ok {
+		overflow, _ := value.(string)
+		if overflow != "drop-head" && overflow != "reject-publish" && overflow != "reject-publish-dlx" {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - invalid arg 'x-overflow'")
+		}
+		q.overflow = overflow
+	}
+	if value, ok := args["x-single-active-consumer"]; ok {
+		single, ok := value.(bool)
+		if !ok {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - invalid arg 'x-single-active-consumer'")
+		}
+		q.singleActive = single
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package membroker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"army_moves.*", "army_moves.alice", true},
+		{"army_moves.*", "army_moves", false},
+		{"army_moves.*", "army_moves.alice.bob", false},
+		{"game_logs.#", "game_logs", true},
+		{"game_logs.#", "game_logs.alice.x", true},
+		{"#", "anything.at.all", true},
+		{"#.alice", "war.alice", true},
+		{"#.alice", "war.bob", false},
+		{"*.*.alice", "games.one.alice", true},
+		{"pause", "pause", true},
+		{"pause", "pauses", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.key, func(t *testing.T) {
+			got := topicMatch(strings.Split(tt.pattern, "."), strings.Split(tt.key, "."))
+			if got != tt.want {
+				t.Errorf("topicMatch(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func dial(t *testing.T, b *Broker) *amqp.Channel {
+	t.Helper()
+	conn, err := b.Dial(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func receive(t *testing.T, deliveries <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+		return amqp.Delivery{}
+	}
+}
+
+func TestPublishConsume(t *testing.T) {
+	b := New()
+	defer b.Close()
+	if err := b.DeclareExchange("peril_topic", Topic); err != nil {
+		t.Fatal(err)
+	}
+	ch := dial(t, b)
+	if _, err := ch.QueueDeclare("moves", false, false, false, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.QueueBind("moves", "army_moves.*", "peril_topic", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := ch.Consume("moves", "", false, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// large enough to need several body frames
+	body := []byte(strings.Repeat("x", 3*frameMax))
+	if err := ch.Publish("peril_topic", "army_moves.alice", false, false, amqp.Publishing{Body: body, ReplyTo: "someone"}); err != nil {
+		t.Fatal(err)
+	}
+	d := receive(t, deliveries)
+	if string(d.Body) != string(body) || d.RoutingKey != "army_moves.alice" || d.ReplyTo != "someone" {
+		t.Fatalf("got a delivery of %d bytes to %q replying to %q", len(d.Body), d.RoutingKey, d.ReplyTo)
+	}
+
+	// a requeued message comes back redelivered
+	if err := d.Nack(false, true); err != nil {
+		t.Fatal(err)
+	}
+	d = receive(t, deliveries)
+	if !d.Redelivered {
+		t.Error("requeued message is not marked redelivered")
+	}
+	d.Ack(false)
+}
+
+func TestDeadLetter(t *testing.T) {
+	b := New()
+	defer b.Close()
+	if err := b.DeclareExchange("peril_dlx", Fanout); err != nil {
+		t.Fatal(err)
+	}
+	ch := dial(t, b)
+	for _, name := range []string{"work", "dead"} {
+		args := amqp.Table{}
+		if name == "work" {
+			args["x-dead-letter-exchange"] = "peril_dlx"
+		}
+		if _, err := ch.QueueDeclare(name, false, false, false, false, args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ch.QueueBind("dead", "", "peril_dlx", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	work, err := ch.Consume("work", "", false, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := ch.Consume("dead", "", true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ch.Publish("", "work", false, false, amqp.Publishing{Body: []byte("poison")}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, work).Nack(false, false)
+	if d := receive(t, dead); string(d.Body) != "poison" {
+		t.Errorf("dead letter is %q", d.Body)
+	}
+}
+
+func TestExclusiveQueue(t *testing.T) {
+	b := New()
+	defer b.Close()
+	first, second := dial(t, b), dial(t, b)
+	if _, err := first.QueueDeclare("leader", false, false, true, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := second.QueueDeclare("leader", false, false, true, false, nil)
+	if amqpErr, ok := err.(*amqp.Error); !ok || amqpErr.Code != amqp.ResourceLocked {
+		t.Fatalf("second declaration failed with %v, want resource locked", err)
+	}
+}
+
+func TestDirectReplyTo(t *testing.T) {
+	b := New()
+	defer b.Close()
+	server, client := dial(t, b), dial(t, b)
+	if _, err := server.QueueDeclare("requests", false, false, false, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	requests, err := server.Consume("requests", "", true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies, err := client.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.Publish("", "requests", true, false, amqp.Publishing{Body: []byte("ping"), ReplyTo: directReplyTo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := receive(t, requests)
+	if req.ReplyTo == directReplyTo || !strings.HasPrefix(req.ReplyTo, directReplyTo) {
+		t.Fatalf("request replies to %q", req.ReplyTo)
+	}
+	if err := server.Publish("", req.ReplyTo, false, false, amqp.Publishing{Body: []byte("pong")}); err != nil {
+		t.Fatal(err)
+	}
+	if reply := receive(t, replies); string(reply.Body) != "pong" {
+		t.Errorf("reply is %q", reply.Body)
+	}
+}
+
+func TestMandatoryReturn(t *testing.T) {
+	b := New()
+	defer b.Close()
+	ch := dial(t, b)
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+	if err := ch.Publish("", "nobody", true, false, amqp.Publishing{Body: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ret := <-returns:
+		if ret.ReplyCode != amqp.NoRoute || string(ret.Body) != "hello" {
+			t.Errorf("returned %d with %q", ret.ReplyCode, ret.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unroutable message was not returned")
+	}
+}
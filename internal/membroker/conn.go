@@ -0,0 +1,842 @@
+package membroker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Reply codes of the errors the broker raises
+const (
+	noRoute            = 312
+	accessRefused      = 403
+	notFound           = 404
+	resourceLocked     = 405
+	preconditionFailed = 406
+	frameError         = 501
+	syntaxError        = 502
+	commandInvalid     = 503
+	channelErr         = 504
+	unexpectedFrame    = 505
+	notAllowed         = 530
+	notImplemented     = 540
+)
+
+// amqpError closes the channel, or the whole connection, that caused it
+type amqpError struct {
+	code       uint16
+	text       string
+	connection bool
+}
+
+func (e *amqpError) Error() string {
+	return e.text
+}
+
+func channelError(code uint16, format string, args ...any) error {
+	return &amqpError{code: code, text: fmt.Sprintf(format, args...)}
+}
+
+func connectionError(code uint16, format string, args ...any) error {
+	return &amqpError{code: code, text: fmt.Sprintf(format, args...), connection: true}
+}
+
+// conn is the broker's side of a connection. Frames are handled one at a
+// time under the broker's lock, writes are queued so handling never waits
+// on a client that is busy writing itself
+type conn struct {
+	broker   *Broker
+	net      net.Conn
+	channels map[uint16]*channel
+	frameMax int
+	closing  bool // sent connection.close, waiting for close-ok
+
+	outMu   sync.Mutex
+	outCond *sync.Cond
+	out     [][]byte
+	done    bool
+}
+
+type channel struct {
+	id         uint16
+	conn       *conn
+	closing    bool // sent channel.close, waiting for close-ok
+	prefetch   int
+	lastTag    uint64
+	unacked    map[uint64]*delivery
+	consumers  map[string]*consumer
+	confirming bool
+	published  uint64
+	publishing *publishing // the message whose content is arriving
+	replyQueue string      // of the direct reply-to consumer
+}
+
+// publishing is a basic.publish waiting for its content
+type publishing struct {
+	exchange   string
+	key        string
+	mandatory  bool
+	props      properties
+	size       uint64
+	body       []byte
+	headerSeen bool
+}
+
+func (b *Broker) accept(netConn net.Conn) *conn {
+	c := &conn{
+		broker:   b,
+		net:      netConn,
+		channels: map[uint16]*channel{},
+		frameMax: frameMax,
+	}
+	c.outCond = sync.NewCond(&c.outMu)
+	b.mu.Lock()
+	b.conns[c] = true
+	b.mu.Unlock()
+	return c
+}
+
+func (c *conn) serve() {
+	go c.write()
+	defer c.shutdown()
+
+	r := bufio.NewReader(c.net)
+	header := make([]byte, len(protocolHeader))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return
+	}
+	if !bytes.Equal(header, protocolHeader) {
+		c.send(protocolHeader)
+		return
+	}
+	c.sendMethod(0, connectionStart, func(e *encoder) {
+		e.octet(0)
+		e.octet(9)
+		e.table(map[string]any{
+			"product": "membroker",
+			"capabilities": map[string]any{
+				"publisher_confirms":           true,
+				"basic.nack":                   true,
+				"consumer_cancel_notify":       true,
+				"per_consumer_qos":             true,
+				"direct_reply_to":              true,
+				"authentication_failure_close": true,
+			},
+		})
+		e.longstr([]byte("PLAIN AMQPLAIN"))
+		e.longstr([]byte("en_US"))
+	})
+
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		c.broker.mu.Lock()
+		stop := c.handle(f)
+		c.broker.mu.Unlock()
+		if stop {
+			return
+		}
+	}
+}
+
+// shutdown drops everything the connection held
+func (c *conn) shutdown() {
+	b := c.broker
+	b.mu.Lock()
+	for _, ch := range c.channels {
+		b.closeChannel(ch)
+	}
+	for _, q := range b.queues {
+		if q.owner == c {
+			b.deleteQueue(q)
+		}
+	}
+	delete(b.conns, c)
+	b.mu.Unlock()
+
+	c.outMu.Lock()
+	c.done = true
+	c.outCond.Signal()
+	c.outMu.Unlock()
+}
+
+// write sends the queued frames and closes the connection once shutdown
+// has run and everything went out
+func (c *conn) write() {
+	defer c.net.Close()
+	broken := false
+	for {
+		c.outMu.Lock()
+		for len(c.out) == 0 && !c.done {
+			c.outCond.Wait()
+		}
+		out, done := c.out, c.done
+		c.out = nil
+		c.outMu.Unlock()
+
+		for _, b := range out {
+			if broken {
+				break
+			}
+			if _, err := c.net.Write(b); err != nil {
+				// keep draining so senders never pile up
+				broken = true
+				c.net.Close()
+			}
+		}
+		if done && len(out) == 0 {
+			return
+		}
+	}
+}
+
+func (c *conn) send(b []byte) {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	if c.done {
+		return
+	}
+	c.out = append(c.out, b)
+	c.outCond.Signal()
+}
+
+func (c *conn) sendMethod(channel uint16, id methodID, fields func(*encoder)) {
+	var e encoder
+	e.method(id)
+	if fields != nil {
+		fields(&e)
+	}
+	c.send(frame{kind: frameMethod, channel: channel, payload: e.Bytes()}.encode())
+}
+
+// sendContent sends a method carrying m, like a delivery or a return
+func (c *conn) sendContent(channel uint16, id methodID, fields func(*encoder), m *message) {
+	c.sendMethod(channel, id, fields)
+	header := contentHeader{size: uint64(len(m.body)), props: m.props}
+	c.send(frame{kind: frameHeader, channel: channel, payload: header.encode()}.encode())
+	chunk := c.frameMax - 8
+	for body := m.body; len(body) > 0; {
+		n := min(chunk, len(body))
+		c.send(frame{kind: frameBody, channel: channel, payload: body[:n]}.encode())
+		body = body[n:]
+	}
+}
+
+// handle acts on a frame and reports whether the connection is done
+func (c *conn) handle(f frame) bool {
+	if c.closing {
+		if f.kind != frameMethod || f.channel != 0 {
+			return false
+		}
+		d := decoder{buf: f.payload}
+		id := d.method()
+		return id == connectionCloseOk || id == connectionClose
+	}
+
+	var id methodID
+	var err error
+	switch f.kind {
+	case frameHeartbeat:
+		return false
+	case frameMethod:
+		d := decoder{buf: f.payload}
+		id = d.method()
+		if f.channel == 0 {
+			var stop bool
+			stop, err = c.connectionMethod(id, &d)
+			if err == nil {
+				return stop
+			}
+		} else {
+			err = c.channelMethod(f.channel, id, &d)
+		}
+		if err == nil && d.err != nil {
+			err = connectionError(syntaxError, "SYNTAX_ERROR - could not decode method %s: %v", id, d.err)
+		}
+	case frameHeader, frameBody:
+		id = basicPublish
+		err = c.content(f)
+	default:
+		err = connectionError(frameError, "FRAME_ERROR - unknown frame type %d", f.kind)
+	}
+	if err == nil {
+		return false
+	}
+
+	var amqpErr *amqpError
+	if !errors.As(err, &amqpErr) {
+		amqpErr = &amqpError{code: syntaxError, text: "SYNTAX_ERROR - " + err.Error(), connection: true}
+	}
+	if ch, ok := c.channels[f.channel]; ok && !amqpErr.connection {
+		c.sendMethod(ch.id, channelClose, func(e *encoder) {
+			e.short(amqpErr.code)
+			e.shortstr(amqpErr.text)
+			e.short(id.class)
+			e.short(id.method)
+		})
+		c.broker.closeChannel(ch)
+		return false
+	}
+	c.sendMethod(0, connectionClose, func(e *encoder) {
+		e.short(amqpErr.code)
+		e.shortstr(amqpErr.text)
+		e.short(id.class)
+		e.short(id.method)
+	})
+	c.closing = true
+	return false
+}
+
+func (c *conn) connectionMethod(id methodID, d *decoder) (bool, error) {
+	switch id {
+	case connectionStartOk:
+		d.table()    // client properties
+		d.shortstr() // mechanism, any credentials will do
+		d.longstr()
+		d.shortstr() // locale
+		c.sendMethod(0, connectionTune, func(e *encoder) {
+			e.short(2047)
+			e.long(frameMax)
+			e.short(0) // no heartbeats, the pipe cannot break
+		})
+	case connectionTuneOk:
+		d.short()
+		if size := int(d.long()); size > 0 && size < c.frameMax {
+			c.frameMax = size
+		}
+		d.short()
+	case connectionOpen:
+		c.sendMethod(0, connectionOpenOk, func(e *encoder) {
+			e.shortstr("")
+		})
+	case connectionClose:
+		c.sendMethod(0, connectionCloseOk, nil)
+		return true, nil
+	default:
+		return false, connectionError(commandInvalid, "COMMAND_INVALID - unexpected method %s on channel 0", id)
+	}
+	return false, d.err
+}
+
+func (c *conn) channelMethod(channelID uint16, id methodID, d *decoder) error {
+	ch, ok := c.channels[channelID]
+	if id == channelOpen {
+		if ok {
+			return connectionError(channelErr, "CHANNEL_ERROR - second 'channel.open' seen")
+		}
+		c.channels[channelID] = &channel{
+			id:        channelID,
+			conn:      c,
+			unacked:   map[uint64]*delivery{},
+			consumers: map[string]*consumer{},
+		}
+		c.sendMethod(channelID, channelOpenOk, func(e *encoder) {
+			e.longstr(nil)
+		})
+		return nil
+	}
+	if !ok {
+		return connectionError(channelErr, "CHANNEL_ERROR - expected 'channel.open'")
+	}
+	if ch.closing {
+		switch id {
+		case channelClose:
+			c.sendMethod(channelID, channelCloseOk, nil)
+			delete(c.channels, channelID)
+		case channelCloseOk:
+			delete(c.channels, channelID)
+		}
+		return nil
+	}
+	if ch.publishing != nil {
+		return connectionError(unexpectedFrame, "UNEXPECTED_FRAME - expected content header for class 60, got method %s", id)
+	}
+
+	b := c.broker
+	switch id {
+	case channelClose:
+		b.closeChannel(ch)
+		c.sendMethod(channelID, channelCloseOk, nil)
+		delete(c.channels, channelID)
+		return nil
+	case exchangeDeclare:
+		return b.exchangeDeclare(ch, d)
+	case queueDeclare:
+		return b.queueDeclare(ch, d)
+	case queueBind:
+		return b.queueBind(ch, d)
+	case queueUnbind:
+		return b.queueUnbind(ch, d)
+	case queuePurge:
+		return b.queuePurge(ch, d)
+	case queueDelete:
+		return b.queueDelete(ch, d)
+	case basicQos:
+		d.long() // prefetch size
+		ch.prefetch = int(d.short())
+		d.octet() // global
+		c.sendMethod(channelID, basicQosOk, nil)
+		return nil
+	case basicConsume:
+		return b.basicConsume(ch, d)
+	case basicCancel:
+		return b.basicCancel(ch, d)
+	case basicPublish:
+		d.short()
+		p := &publishing{exchange: d.shortstr(), key: d.shortstr()}
+		bits := d.octet()
+		if bits&2 != 0 {
+			return connectionError(notImplemented, "NOT_IMPLEMENTED - immediate=true")
+		}
+		p.mandatory = bits&1 != 0
+		ch.publishing = p
+		return nil
+	case basicAck:
+		tag := d.longlong()
+		multiple := d.octet()&1 != 0
+		return b.settle(ch, tag, multiple, func(*delivery) {})
+	case basicReject:
+		tag := d.longlong()
+		requeue := d.octet()&1 != 0
+		return b.settle(ch, tag, false, b.discard(requeue))
+	case basicNack:
+		tag := d.longlong()
+		bits := d.octet()
+		return b.settle(ch, tag, bits&1 != 0, b.discard(bits&2 != 0))
+	case confirmSelect:
+		nowait := d.octet()&1 != 0
+		ch.confirming = true
+		if !nowait {
+			c.sendMethod(channelID, confirmSelectOk, nil)
+		}
+		return nil
+	}
+	return connectionError(notImplemented, "NOT_IMPLEMENTED - method %s", id)
+}
+
+// content collects the header and body of the message being published
+func (c *conn) content(f frame) error {
+	ch, ok := c.channels[f.channel]
+	if !ok {
+		return connectionError(channelErr, "CHANNEL_ERROR - expected 'channel.open'")
+	}
+	if ch.closing {
+		return nil
+	}
+	p := ch.publishing
+	if p == nil || p.headerSeen != (f.kind == frameBody) {
+		return connectionError(unexpectedFrame, "UNEXPECTED_FRAME - content frame without a basic.publish")
+	}
+	if f.kind == frameHeader {
+		header, err := decodeContentHeader(f.payload)
+		if err != nil {
+			return connectionError(frameError, "FRAME_ERROR - could not decode content header: %v", err)
+		}
+		p.headerSeen = true
+		p.size = header.size
+		p.props = header.props
+		p.body = make([]byte, 0, min(p.size, frameMax))
+	} else {
+		p.body = append(p.body, f.payload...)
+	}
+	if uint64(len(p.body)) > p.size {
+		return connectionError(frameError, "FRAME_ERROR - body of %d bytes is larger than announced %d", len(p.body), p.size)
+	}
+	if uint64(len(p.body)) < p.size {
+		return nil
+	}
+	ch.publishing = nil
+	return c.broker.publish(ch, p)
+}
+
+// closeChannel cancels the consumers of ch and requeues what it had not
+// settled yet
+func (b *Broker) closeChannel(ch *channel) {
+	ch.closing = true
+	ch.publishing = nil
+
+	tags := make([]uint64, 0, len(ch.unacked))
+	for tag := range ch.unacked {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	var touched []*queue
+	// backwards, so the messages end up in front in their old order
+	for i := len(tags) - 1; i >= 0; i-- {
+		d := ch.unacked[tags[i]]
+		b.requeue(d)
+		touched = append(touched, d.queue)
+	}
+	ch.unacked = map[uint64]*delivery{}
+
+	for _, cons := range ch.consumers {
+		cons.queue.removeConsumer(cons)
+		if !b.maybeAutoDelete(cons.queue) {
+			touched = append(touched, cons.queue)
+		}
+	}
+	ch.consumers = map[string]*consumer{}
+	b.dispatchAll(touched)
+}
+
+func (b *Broker) dispatchAll(queues []*queue) {
+	var done []*queue
+	for _, q := range queues {
+		if slices.Contains(done, q) || !b.live(q) {
+			continue
+		}
+		done = append(done, q)
+		b.dispatch(q)
+	}
+}
+
+// requeue puts a delivered message back in front of its queue
+func (b *Broker) requeue(d *delivery) {
+	if !b.live(d.queue) {
+		return
+	}
+	d.msg.redelivered = true
+	d.queue.messages = slices.Insert(d.queue.messages, 0, d.msg)
+}
+
+// discard returns what a reject or nack does with a message
+func (b *Broker) discard(requeue bool) func(*delivery) {
+	if requeue {
+		return b.requeue
+	}
+	return func(d *delivery) {
+		if b.live(d.queue) {
+			b.deadLetter(d.queue, d.msg)
+		}
+	}
+}
+
+// settle applies fn to the deliveries up to tag, or to tag alone unless
+// multiple, in the order they were delivered when they are dropped and in
+// reverse when requeued, so requeued messages keep their order
+func (b *Broker) settle(ch *channel, tag uint64, multiple bool, fn func(*delivery)) error {
+	var tags []uint64
+	if multiple {
+		for t := range ch.unacked {
+			if tag == 0 || t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		slices.Sort(tags)
+	} else {
+		if _, ok := ch.unacked[tag]; !ok {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - unknown delivery tag %d", tag)
+		}
+		tags = []uint64{tag}
+	}
+
+	var touched []*queue
+	deliveries := make([]*delivery, len(tags))
+	for i, t := range tags {
+		d := ch.unacked[t]
+		delete(ch.unacked, t)
+		d.consumer.unacked--
+		deliveries[i] = d
+		touched = append(touched, d.queue)
+	}
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		fn(deliveries[i])
+	}
+	b.dispatchAll(touched)
+	return nil
+}
+
+func (b *Broker) exchangeDeclare(ch *channel, d *decoder) error {
+	d.short()
+	name, kind := d.shortstr(), d.shortstr()
+	bits := d.octet()
+	d.table()
+	passive, nowait := bits&1 != 0, bits&16 != 0
+	if d.err != nil {
+		return d.err
+	}
+
+	if passive {
+		if _, ok := b.exchanges[name]; !ok {
+			return channelError(notFound, "NOT_FOUND - no exchange '%s' in vhost '/'", name)
+		}
+	} else {
+		if _, ok := b.exchanges[name]; !ok && (name == "" || strings.HasPrefix(name, "amq.")) {
+			return channelError(accessRefused, "ACCESS_REFUSED - exchange name '%s' contains reserved prefix 'amq.*'", name)
+		}
+		if err := b.declareExchange(name, kind); err != nil {
+			return err
+		}
+	}
+	if !nowait {
+		ch.conn.sendMethod(ch.id, exchangeDeclareOk, nil)
+	}
+	return nil
+}
+
+// lockedQueue is the error for an exclusive queue of another connection
+func lockedQueue(name string) error {
+	return channelError(resourceLocked, "RESOURCE_LOCKED - cannot obtain exclusive access to locked queue '%s' in vhost '/'. It could be originally declared on another connection or the exclusive property value does not match that of the original declaration.", name)
+}
+
+func (b *Broker) queueDeclare(ch *channel, d *decoder) error {
+	d.short()
+	name := d.shortstr()
+	bits := d.octet()
+	args := d.table()
+	if d.err != nil {
+		return d.err
+	}
+	passive, durable, exclusive := bits&1 != 0, bits&2 != 0, bits&4 != 0
+	autoDelete, nowait := bits&8 != 0, bits&16 != 0
+
+	q, ok := b.queues[name]
+	switch {
+	case ok && q.owner != nil && q.owner != ch.conn:
+		return lockedQueue(name)
+	case passive:
+		if !ok {
+			return channelError(notFound, "NOT_FOUND - no queue '%s' in vhost '/'", name)
+		}
+	case ok:
+		if q.durable != durable {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - inequivalent arg 'durable' for queue '%s' in vhost '/': received '%t' but current is '%t'", name, durable, q.durable)
+		}
+		if exclusive && q.owner == nil {
+			return lockedQueue(name)
+		}
+	default:
+		if strings.HasPrefix(name, "amq.") {
+			return channelError(accessRefused, "ACCESS_REFUSED - queue name '%s' contains reserved prefix 'amq.*'", name)
+		}
+		if name == "" {
+			name = fmt.Sprintf("amq.gen-%d", b.newID())
+		}
+		q = &queue{name: name, durable: durable, autoDelete: autoDelete}
+		if exclusive {
+			q.owner = ch.conn
+		}
+		if err := q.configure(args); err != nil {
+			return err
+		}
+		b.queues[name] = q
+	}
+
+	if !nowait {
+		ch.conn.sendMethod(ch.id, queueDeclareOk, func(e *encoder) {
+			e.shortstr(q.name)
+			e.long(uint32(len(q.messages)))
+			e.long(uint32(len(q.consumers)))
+		})
+	}
+	return nil
+}
+
+// usableQueue finds a queue ch may work with
+func (b *Broker) usableQueue(ch *channel, name string) (*queue, error) {
+	q, ok := b.queues[name]
+	if !ok {
+		return nil, channelError(notFound, "NOT_FOUND - no queue '%s' in vhost '/'", name)
+	}
+	if q.owner != nil && q.owner != ch.conn {
+		return nil, lockedQueue(name)
+	}
+	return q, nil
+}
+
+// bindableExchange finds an exchange queues may be bound to
+func (b *Broker) bindableExchange(name string) (*exchange, error) {
+	if name == "" {
+		return nil, channelError(accessRefused, "ACCESS_REFUSED - operation not permitted on the default exchange")
+	}
+	ex, ok := b.exchanges[name]
+	if !ok {
+		return nil, channelError(notFound, "NOT_FOUND - no exchange '%s' in vhost '/'", name)
+	}
+	return ex, nil
+}
+
+func (b *Broker) queueBind(ch *channel, d *decoder) error {
+	d.short()
+	queueName, exchangeName, key := d.shortstr(), d.shortstr(), d.shortstr()
+	nowait := d.octet()&1 != 0
+	d.table()
+	if d.err != nil {
+		return d.err
+	}
+	q, err := b.usableQueue(ch, queueName)
+	if err != nil {
+		return err
+	}
+	ex, err := b.bindableExchange(exchangeName)
+	if err != nil {
+		return err
+	}
+	bind := binding{queue: q.name, key: key}
+	if !slices.Contains(ex.bindings, bind) {
+		ex.bindings = append(ex.bindings, bind)
+	}
+	if !nowait {
+		ch.conn.sendMethod(ch.id, queueBindOk, nil)
+	}
+	return nil
+}
+
+func (b *Broker) queueUnbind(ch *channel, d *decoder) error {
+	d.short()
+	queueName, exchangeName, key := d.shortstr(), d.shortstr(), d.shortstr()
+	d.table()
+	if d.err != nil {
+		return d.err
+	}
+	q, err := b.usableQueue(ch, queueName)
+	if err != nil {
+		return err
+	}
+	ex, err := b.bindableExchange(exchangeName)
+	if err != nil {
+		return err
+	}
+	ex.bindings = slices.DeleteFunc(ex.bindings, func(bind binding) bool {
+		return bind.queue == q.name && bind.key == key
+	})
+	ch.conn.sendMethod(ch.id, queueUnbindOk, nil)
+	return nil
+}
+
+func (b *Broker) queuePurge(ch *channel, d *decoder) error {
+	d.short()
+	name := d.shortstr()
+	nowait := d.octet()&1 != 0
+	if d.err != nil {
+		return d.err
+	}
+	q, err := b.usableQueue(ch, name)
+	if err != nil {
+		return err
+	}
+	count := len(q.messages)
+	q.messages = nil
+	if !nowait {
+		ch.conn.sendMethod(ch.id, queuePurgeOk, func(e *encoder) {
+			e.long(uint32(count))
+		})
+	}
+	return nil
+}
+
+func (b *Broker) queueDelete(ch *channel, d *decoder) error {
+	d.short()
+	name := d.shortstr()
+	bits := d.octet()
+	if d.err != nil {
+		return d.err
+	}
+	ifUnused, ifEmpty, nowait := bits&1 != 0, bits&2 != 0, bits&4 != 0
+
+	count := 0
+	// deleting a queue that is not there succeeds, like in RabbitMQ
+	if _, ok := b.queues[name]; ok {
+		q, err := b.usableQueue(ch, name)
+		if err != nil {
+			return err
+		}
+		if ifUnused && len(q.consumers) > 0 {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - queue '%s' in vhost '/' in use", name)
+		}
+		if ifEmpty && len(q.messages) > 0 {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - queue '%s' in vhost '/' is not empty", name)
+		}
+		count = len(q.messages)
+		b.deleteQueue(q)
+	}
+	if !nowait {
+		ch.conn.sendMethod(ch.id, queueDeleteOk, func(e *encoder) {
+			e.long(uint32(count))
+		})
+	}
+	return nil
+}
+
+func (b *Broker) basicConsume(ch *channel, d *decoder) error {
+	d.short()
+	name, tag := d.shortstr(), d.shortstr()
+	bits := d.octet()
+	d.table()
+	if d.err != nil {
+		return d.err
+	}
+	noAck, exclusive, nowait := bits&2 != 0, bits&4 != 0, bits&8 != 0
+
+	if name == directReplyTo {
+		if !noAck {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - reply consumer cannot acknowledge")
+		}
+		if ch.replyQueue != "" {
+			return channelError(preconditionFailed, "PRECONDITION_FAILED - reply consumer already set")
+		}
+		// the replies go to a queue of their own that lives as long as the
+		// consumer, under the name the requests carry as their reply-to
+		name = fmt.Sprintf("%s.%d", directReplyTo, b.newID())
+		b.queues[name] = &queue{name: name, autoDelete: true, owner: ch.conn}
+		ch.replyQueue = name
+	}
+
+	q, err := b.usableQueue(ch, name)
+	if err != nil {
+		return err
+	}
+	if len(q.consumers) > 0 && (exclusive || q.consumers[0].exclusive) {
+		return channelError(accessRefused, "ACCESS_REFUSED - queue '%s' in vhost '/' in exclusive use", name)
+	}
+	if tag == "" {
+		tag = fmt.Sprintf("amq.ctag-%d", b.newID())
+	}
+	if _, ok := ch.consumers[tag]; ok {
+		return connectionError(notAllowed, "NOT_ALLOWED - attempt to reuse consumer tag '%s'", tag)
+	}
+
+	cons := &consumer{tag: tag, queue: q, channel: ch, noAck: noAck, exclusive: exclusive, prefetch: ch.prefetch}
+	ch.consumers[tag] = cons
+	q.consumers = append(q.consumers, cons)
+	q.consumed = true
+	if !nowait {
+		ch.conn.sendMethod(ch.id, basicConsumeOk, func(e *encoder) {
+			e.shortstr(tag)
+		})
+	}
+	b.dispatch(q)
+	return nil
+}
+
+func (b *Broker) basicCancel(ch *channel, d *decoder) error {
+	tag := d.shortstr()
+	nowait := d.octet()&1 != 0
+	if d.err != nil {
+		return d.err
+	}
+	if cons, ok := ch.consumers[tag]; ok {
+		delete(ch.consumers, tag)
+		cons.queue.removeConsumer(cons)
+		if cons.queue.name == ch.replyQueue {
+			ch.replyQueue = ""
+		}
+		if !b.maybeAutoDelete(cons.queue) {
+			b.dispatch(cons.queue)
+		}
+	}
+	if !nowait {
+		ch.conn.sendMethod(ch.id, basicCancelOk, func(e *encoder) {
+			e.shortstr(tag)
+		})
+	}
+	return nil
+}
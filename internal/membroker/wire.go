@@ -0,0 +1,428 @@
+package membroker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+
+	// largest frame either side sends, the client may ask for less
+	frameMax = 128 * 1024
+)
+
+var protocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+var errShortFrame = errors.New("frame ends in the middle of a field")
+
+type frame struct {
+	kind    byte
+	channel uint16
+	payload []byte
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var head [7]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return frame{}, err
+	}
+	size := binary.BigEndian.Uint32(head[3:])
+	if size > frameMax {
+		return frame{}, fmt.Errorf("frame of %d bytes is larger than %d", size, frameMax)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return frame{}, err
+	}
+	if payload[size] != frameEnd {
+		return frame{}, errors.New("frame does not end with a frame end")
+	}
+	return frame{kind: head[0], channel: binary.BigEndian.Uint16(head[1:3]), payload: payload[:size]}, nil
+}
+
+func (f frame) encode() []byte {
+	out := make([]byte, 7, 8+len(f.payload))
+	out[0] = f.kind
+	binary.BigEndian.PutUint16(out[1:3], f.channel)
+	binary.BigEndian.PutUint32(out[3:7], uint32(len(f.payload)))
+	out = append(out, f.payload...)
+	return append(out, frameEnd)
+}
+
+// methodID is the class and method of a method frame
+type methodID struct {
+	class, method uint16
+}
+
+func (id methodID) String() string {
+	return fmt.Sprintf("%d.%d", id.class, id.method)
+}
+
+var (
+	connectionStart   = methodID{10, 10}
+	connectionStartOk = methodID{10, 11}
+	connectionTune    = methodID{10, 30}
+	connectionTuneOk  = methodID{10, 31}
+	connectionOpen    = methodID{10, 40}
+	connectionOpenOk  = methodID{10, 41}
+	connectionClose   = methodID{10, 50}
+	connectionCloseOk = methodID{10, 51}
+
+	channelOpen    = methodID{20, 10}
+	channelOpenOk  = methodID{20, 11}
+	channelClose   = methodID{20, 40}
+	channelCloseOk = methodID{20, 41}
+
+	exchangeDeclare   = methodID{40, 10}
+	exchangeDeclareOk = methodID{40, 11}
+
+	queueDeclare   = methodID{50, 10}
+	queueDeclareOk = methodID{50, 11}
+	queueBind      = methodID{50, 20}
+	queueBindOk    = methodID{50, 21}
+	queuePurge     = methodID{50, 30}
+	queuePurgeOk   = methodID{50, 31}
+	queueDelete    = methodID{50, 40}
+	queueDeleteOk  = methodID{50, 41}
+	queueUnbind    = methodID{50, 50}
+	queueUnbindOk  = methodID{50, 51}
+
+	basicQos       = methodID{60, 10}
+	basicQosOk     = methodID{60, 11}
+	basicConsume   = methodID{60, 20}
+	basicConsumeOk = methodID{60, 21}
+	basicCancel    = methodID{60, 30}
+	basicCancelOk  = methodID{60, 31}
+	basicPublish   = methodID{60, 40}
+	basicReturn    = methodID{60, 50}
+	basicDeliver   = methodID{60, 60}
+	basicAck       = methodID{60, 80}
+	basicReject    = methodID{60, 90}
+	basicNack      = methodID{60, 120}
+
+	confirmSelect   = methodID{85, 10}
+	confirmSelectOk = methodID{85, 11}
+)
+
+// decoder reads AMQP fields, the first error sticks and later reads
+// return zero values
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errShortFrame
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) octet() byte {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) short() uint16 {
+	b := d.take(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *decoder) long() uint32 {
+	b := d.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) longlong() uint64 {
+	b := d.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) shortstr() string {
+	return string(d.take(int(d.octet())))
+}
+
+func (d *decoder) longstr() []byte {
+	return d.take(int(d.long()))
+}
+
+func (d *decoder) method() methodID {
+	return methodID{d.short(), d.short()}
+}
+
+func (d *decoder) table() map[string]any {
+	inner := decoder{buf: d.longstr(), err: d.err}
+	table := map[string]any{}
+	for inner.err == nil && len(inner.buf) > 0 {
+		key := inner.shortstr()
+		table[key] = inner.field()
+	}
+	if d.err == nil {
+		d.err = inner.err
+	}
+	return table
+}
+
+// field decodes a table value. Numbers come back as int64 or float64, so
+// arguments read the same whichever width the client picked
+func (d *decoder) field() any {
+	switch kind := d.octet(); kind {
+	case 't':
+		return d.octet() != 0
+	case 'b':
+		return int64(int8(d.octet()))
+	case 'B':
+		return int64(d.octet())
+	case 's':
+		return int64(int16(d.short()))
+	case 'u':
+		return int64(d.short())
+	case 'I':
+		return int64(int32(d.long()))
+	case 'i':
+		return int64(d.long())
+	case 'l', 'T':
+		return int64(d.longlong())
+	case 'f':
+		return float64(math.Float32frombits(d.long()))
+	case 'd':
+		return math.Float64frombits(d.longlong())
+	case 'D':
+		scale := d.octet()
+		value := int32(d.long())
+		return float64(value) / math.Pow10(int(scale))
+	case 'S':
+		return string(d.longstr())
+	case 'x':
+		return d.longstr()
+	case 'A':
+		inner := decoder{buf: d.longstr(), err: d.err}
+		values := []any{}
+		for inner.err == nil && len(inner.buf) > 0 {
+			values = append(values, inner.field())
+		}
+		if d.err == nil {
+			d.err = inner.err
+		}
+		return values
+	case 'F':
+		return d.table()
+	case 'V':
+		return nil
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown field type %q", kind)
+		}
+		return nil
+	}
+}
+
+// encoder writes AMQP fields
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) octet(b byte) {
+	e.WriteByte(b)
+}
+
+func (e *encoder) short(v uint16) {
+	e.Write(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (e *encoder) long(v uint32) {
+	e.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (e *encoder) longlong(v uint64) {
+	e.Write(binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (e *encoder) shortstr(s string) {
+	if len(s) > math.MaxUint8 {
+		s = s[:math.MaxUint8]
+	}
+	e.octet(byte(len(s)))
+	e.WriteString(s)
+}
+
+func (e *encoder) longstr(b []byte) {
+	e.long(uint32(len(b)))
+	e.Write(b)
+}
+
+func (e *encoder) method(id methodID) {
+	e.short(id.class)
+	e.short(id.method)
+}
+
+func (e *encoder) bits(bits ...bool) {
+	var b byte
+	for i, bit := range bits {
+		if bit {
+			b |= 1 << i
+		}
+	}
+	e.octet(b)
+}
+
+// table encodes the few value types the broker sends itself
+func (e *encoder) table(table map[string]any) {
+	var inner encoder
+	for key, value := range table {
+		inner.shortstr(key)
+		switch value := value.(type) {
+		case bool:
+			inner.octet('t')
+			inner.bits(value)
+		case int64:
+			inner.octet('l')
+			inner.longlong(uint64(value))
+		case string:
+			inner.octet('S')
+			inner.longstr([]byte(value))
+		case map[string]any:
+			inner.octet('F')
+			inner.table(value)
+		default:
+			inner.octet('V')
+		}
+	}
+	e.longstr(inner.Bytes())
+}
+
+// Basic properties, by their bit in the property flags
+const (
+	propContentType     = 15
+	propContentEncoding = 14
+	propHeaders         = 13
+	propDeliveryMode    = 12
+	propPriority        = 11
+	propCorrelationID   = 10
+	propReplyTo         = 9
+	propExpiration      = 8
+	propMessageID       = 7
+	propTimestamp       = 6
+	propType            = 5
+	propUserID          = 4
+	propAppID           = 3
+	propClusterID       = 2
+)
+
+// properties are the basic properties of a message. Only the ones the
+// broker acts on are decoded, the others are passed on as they came
+type properties struct {
+	flags  uint16
+	fields [16][]byte // encoded, by flag bit
+}
+
+// contentHeader is the header frame of a message, it announces the body
+type contentHeader struct {
+	size  uint64
+	props properties
+}
+
+func decodeContentHeader(payload []byte) (contentHeader, error) {
+	d := decoder{buf: payload}
+	d.short() // class
+	d.short() // weight
+	h := contentHeader{size: d.longlong()}
+	h.props.flags = d.short()
+	if h.props.flags&1 != 0 {
+		return h, errors.New("basic properties have no second flags word")
+	}
+	for bit := 15; bit >= 2 && d.err == nil; bit-- {
+		if h.props.flags&(1<<bit) == 0 {
+			continue
+		}
+		start := d.buf
+		switch bit {
+		case propHeaders:
+			d.longstr()
+		case propDeliveryMode, propPriority:
+			d.octet()
+		case propTimestamp:
+			d.longlong()
+		default:
+			d.shortstr()
+		}
+		h.props.fields[bit] = start[:len(start)-len(d.buf)]
+	}
+	return h, d.err
+}
+
+func (h contentHeader) encode() []byte {
+	var e encoder
+	e.short(60)
+	e.short(0)
+	e.longlong(h.size)
+	e.short(h.props.flags)
+	for bit := 15; bit >= 2; bit-- {
+		if h.props.flags&(1<<bit) != 0 {
+			e.Write(h.props.fields[bit])
+		}
+	}
+	return e.Bytes()
+}
+
+func (p properties) str(bit int) string {
+	if p.flags&(1<<bit) == 0 {
+		return ""
+	}
+	d := decoder{buf: p.fields[bit]}
+	return d.shortstr()
+}
+
+func (p *properties) setStr(bit int, value string) {
+	if value == "" {
+		p.flags &^= 1 << bit
+		p.fields[bit] = nil
+		return
+	}
+	var e encoder
+	e.shortstr(value)
+	p.flags |= 1 << bit
+	p.fields[bit] = e.Bytes()
+}
+
+// expiration is the per message TTL, ok is false when there is none
+func (p properties) expiration() (ms int64, ok bool) {
+	value := p.str(propExpiration)
+	if value == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false
+	}
+	return ms, true
+}
@@ -0,0 +1,253 @@
+// Package metrics keeps counters and histograms and exposes them in the
+// Prometheus text format. Metrics register themselves with Default when
+// they are created, usually as package variables
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DurationBuckets suit handler and publish latencies in seconds
+var DurationBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer) error
+}
+
+// Registry is a set of metrics written out together
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// Default holds every metric created by this package's constructors
+var Default = NewRegistry()
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[m.name()] {
+		panic("metrics: " + m.name() + " registered twice")
+	}
+	r.names[m.name()] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText writes all metrics, sorted by name, in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// family is what counters and histograms share: a name, help text and
+// one series per combination of label values
+type family[S any] struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*S
+	values map[string][]string
+}
+
+func newFamily[S any](name, help, kind string, labels []string) *family[S] {
+	return &family[S]{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		series:     map[string]*S{},
+		values:     map[string][]string{},
+	}
+}
+
+func (f *family[S]) name() string { return f.metricName }
+
+// get returns the series for labelValues, creating it with create
+func (f *family[S]) get(labelValues []string, create func() *S) *S {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label value(s), got %d", f.metricName, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = create()
+		f.series[key] = s
+		f.values[key] = append([]string{}, labelValues...)
+	}
+	return s
+}
+
+// each calls fn for every series sorted by label values, holding the lock
+func (f *family[S]) each(fn func(labels string, s *S) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(formatLabels(f.labels, f.values[key]), f.series[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *family[S]) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, escapeHelp(f.help), f.metricName, f.kind)
+	return err
+}
+
+// Counter only goes up
+type Counter struct {
+	*family[float64]
+}
+
+// NewCounter creates and registers a counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily[float64](name, help, "counter", labels)}
+	if len(labels) == 0 {
+		// report 0 rather than nothing until the first increment
+		c.get(nil, func() *float64 { return new(float64) })
+	}
+	Default.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counters can not go down")
+	}
+	s := c.get(labelValues, func() *float64 { return new(float64) })
+	c.mu.Lock()
+	*s += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) error {
+	if err := c.header(w); err != nil {
+		return err
+	}
+	return c.each(func(labels string, v *float64) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", c.metricName, labels, formatValue(*v))
+		return err
+	})
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations into buckets
+type Histogram struct {
+	*family[histogramSeries]
+	buckets []float64
+}
+
+// NewHistogram creates and registers a histogram with the given upper
+// bucket bounds, in increasing order, and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{newFamily[histogramSeries](name, help, "histogram", labels), buckets}
+	Default.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	s := h.get(labelValues, func() *histogramSeries {
+		return &histogramSeries{counts: make([]uint64, len(h.buckets))}
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	if err := h.header(w); err != nil {
+		return err
+	}
+	return h.each(func(labels string, s *histogramSeries) error {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, withLabel(labels, "le", formatValue(bound)), cumulative); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, withLabel(labels, "le", "+Inf"), s.count,
+			h.metricName, labels, formatValue(s.sum),
+			h.metricName, labels, s.count)
+		return err
+	})
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel adds one more label to formatted labels
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + pair + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -2,16 +2,17 @@ package pubsub
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-type simpleQueueType string
 type Acktype int
 
 const (
@@ -20,9 +21,87 @@ const (
 	NackRequeue
 )
 
-const SimpleQueueDurable = "durable"
-const SimpleQueueTransient = "transient"
+// AckFunc settles a delivery once a deferred handler is done with it.
+// It must be called exactly once per message
+type AckFunc func(Acktype)
 
+// SubscribeOption adjusts how a subscription consumes messages
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	verifiers []func(amqp.Delivery) error
+	identify  func(amqp.Delivery) (string, error)
+	stop      <-chan struct{}
+}
+
+// WithStop ends the subscription once stop is closed. Messages not settled
+// by then go back to the queue
+func WithStop(stop <-chan struct{}) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.stop = stop
+	}
+}
+
+// closeOnStop closes channel once stop is closed, stop may be nil
+func closeOnStop(channel *amqp.Channel, stop <-chan struct{}) {
+	if stop == nil {
+		return
+	}
+	closed := channel.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		select {
+		case <-stop:
+			channel.Close()
+		case <-closed:
+		}
+	}()
+}
+
+// WithVerifier checks every delivery before it is decoded. Messages failing
+// the check never reach the handler and are discarded to the dead letter
+// exchange. Several verifiers run in the order they were given
+func WithVerifier(verify func(amqp.Delivery) error) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.verifiers = append(o.verifiers, verify)
+	}
+}
+
+// WithSigner checks every delivery like WithVerifier and hands who signed
+// it to the handler, see Signer. identify returns an empty signer for
+// messages it lets through without a verified signature
+func WithSigner(identify func(amqp.Delivery) (string, error)) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.identify = identify
+	}
+}
+
+type signerKey struct{}
+
+// Signer is who signed the message being handled. It reports false when
+// the subscription verified no signer
+func Signer(ctx context.Context) (string, bool) {
+	signer, ok := ctx.Value(signerKey{}).(string)
+	return signer, ok
+}
+
+func (o subscribeOptions) check(ctx context.Context, msg amqp.Delivery) (context.Context, error) {
+	for _, verify := range o.verifiers {
+		if err := verify(msg); err != nil {
+			return ctx, err
+		}
+	}
+	if o.identify == nil {
+		return ctx, nil
+	}
+	signer, err := o.identify(msg)
+	if err != nil {
+		return ctx, err
+	}
+	if signer != "" {
+		ctx = context.WithValue(ctx, signerKey{}, signer)
+	}
+	return ctx, nil
+}
 
 // Declares and binds a queue
 func DeclareAndBind(
@@ -30,9 +109,13 @@ func DeclareAndBind(
 	exchange,
 	queueName,
 	key string,
-	queueType simpleQueueType, // an enum to represent "durable" or "transient"
+	queue QueueOptions,
 ) (*amqp.Channel, amqp.Queue, error) {
 
+	if err := queue.Validate(); err != nil {
+		return &amqp.Channel{}, amqp.Queue{}, fmt.Errorf("invalid options for queue %s: %v", queueName, err)
+	}
+
 	//Creating new channel
 	channel, err := conn.Channel()
 	if err != nil {
@@ -40,14 +123,14 @@ func DeclareAndBind(
 	}
 
 	declaredQueue, err := channel.QueueDeclare(queueName,
-		queueType == "durable",
-		queueType == "transient",
-		queueType == "transient",
+		queue.Durable,
+		queue.AutoDelete,
+		queue.Exclusive,
 		false,
-		amqp.Table{"x-dead-letter-exchange": "peril_dlx"})
+		queue.arguments())
 
 	if err != nil {
-		log.Println(err)
+		slog.Error("could not declare queue", "queue", queueName, "err", err)
 		return channel, amqp.Queue{}, errors.New("Error declaring queue")
 	}
 
@@ -67,50 +150,27 @@ func SubscribeJSON[T any](
 	exchange,
 	queueName,
 	key string,
-	queueType simpleQueueType, // an enum to represent "durable" or "transient"
+	queue QueueOptions,
 	handler func(T) Acktype,
+	opts ...SubscribeOption,
 ) error {
-
-	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
-	if err != nil {
-		return errors.New("error declaring queue " + queueName + " to exchange" + exchange)
-	}
-
-	deliveryChannel, err := channel.Consume(queueName, "", false, false, false, false, nil)
-
-	go func() error {
-		defer channel.Close()
-		for msg := range deliveryChannel {
-
-			var msgBody T
-			marshallErr := json.Unmarshal(msg.Body, &msgBody)
-
-			if marshallErr != nil {
-				return fmt.Errorf("error unmarshalling message %v", marshallErr)
-			}
-
-			messageAckinfo := handler(msgBody)
-
-			// acknowledge the message and remove from the queue
-			switch messageAckinfo {
-			case Ack:
-				msg.Ack(false)
-				log.Println("Message was acknowledged: Ack")
-			case NackRequeue:
-				msg.Nack(false, true)
-				log.Println("Message was not acknowledged: NackRequeue")
-			case NackDiscard:
-				msg.Nack(false, false)
-				log.Println("Message was not acknowledged: NackDiscard")
-			}
-		}
-
-		return nil
-	}()
-
-	return nil
+	return subscribe(conn, exchange, queueName, key, queue, 0, decodeJSON[T], immediate(withoutContext(handler)), opts)
 }
 
+// SubscribeJSONContext is SubscribeJSON for handlers that publish messages
+// of their own. Publishing with WithContext(ctx) puts them in the trace of
+// the message being handled
+func SubscribeJSONContext[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queue QueueOptions,
+	handler func(context.Context, T) Acktype,
+	opts ...SubscribeOption,
+) error {
+	return subscribe(conn, exchange, queueName, key, queue, 0, decodeJSON[T], immediate(handler), opts)
+}
 
 // Subscribe to Gob publish (GameLogs)
 func SubscribeGob[T any](
@@ -118,50 +178,144 @@ func SubscribeGob[T any](
 	exchange,
 	queueName,
 	key string,
-	queueType simpleQueueType, // an enum to represent "durable" or "transient"
+	queue QueueOptions,
 	handler func(T) Acktype,
+	opts ...SubscribeOption,
+) error {
+	return subscribe(conn, exchange, queueName, key, queue, 0, decodeGob[T], immediate(withoutContext(handler)), opts)
+}
+
+// Subscribe to Gob publish and let the handler settle each message later,
+// e.g. after it was written to disk. prefetch limits how many unsettled
+// messages the broker hands out, so a handler that blocks or acks slowly
+// pushes back on the queue instead of buffering without bound
+func SubscribeGobDeferred[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queue QueueOptions,
+	prefetch int,
+	handler func(T, AckFunc),
+	opts ...SubscribeOption,
 ) error {
+	return subscribe(conn, exchange, queueName, key, queue, prefetch, decodeGob[T], func(_ context.Context, val T, ack AckFunc) {
+		handler(val, ack)
+	}, opts)
+}
 
-	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
+func subscribe[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queue QueueOptions,
+	prefetch int,
+	decode func([]byte) (T, error),
+	handler func(context.Context, T, AckFunc),
+	opts []SubscribeOption,
+) error {
+	options := subscribeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, queue)
 	if err != nil {
-		return errors.New("error declaring queue " + queueName + " to exchange" + exchange)
+		return fmt.Errorf("could not declare queue %s on exchange %s: %v", queueName, exchange, err)
+	}
+
+	if prefetch == 0 && queue.Type == QueueStream {
+		prefetch = streamPrefetch
+	}
+	if prefetch > 0 {
+		if err := channel.Qos(prefetch, 0, false); err != nil {
+			channel.Close()
+			return fmt.Errorf("could not set prefetch on queue %s: %v", queueName, err)
+		}
 	}
 
 	deliveryChannel, err := channel.Consume(queueName, "", false, false, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return fmt.Errorf("could not consume from queue %s: %v", queueName, err)
+	}
 
-	go func() error {
+	closeOnStop(channel, options.stop)
+	go func() {
 		defer channel.Close()
 		for msg := range deliveryChannel {
 
-			bufforData :=  bytes.NewBuffer(msg.Body)
-			var msgBody T
-
-			decoder := gob.NewDecoder(bufforData)
-			decodeError := decoder.Decode(&msgBody)
+			ctx, span := startProcessSpan(queueName, msg)
 
-			if decodeError != nil {
-				log.Printf("error decoding gob message %v", decodeError)
+			ctx, err := options.check(ctx, msg)
+			if err != nil {
+				slog.Warn("rejecting message", "queue", queueName, "err", err)
+				rejectedMessages.Inc(queueName)
+				span.Fail(err)
+				span.End()
+				settle(msg, NackDiscard)
+				continue
 			}
 
-			messageAckinfo := handler(msgBody)
-
-			// acknowledge the message and remove from the queue
-			switch messageAckinfo {
-			case Ack:
-				msg.Ack(false)
-				log.Println("Message was acknowledged: Ack")
-			case NackRequeue:
-				msg.Nack(false, true)
-				log.Println("Message was not acknowledged: NackRequeue")
-			case NackDiscard:
-				msg.Nack(false, false)
-				log.Println("Message was not acknowledged: NackDiscard")
+			msgBody, decodeErr := decode(msg.Body)
+			if decodeErr != nil {
+				slog.Warn("could not decode message", "queue", queueName, "err", decodeErr)
+				decodeFailures.Inc(queueName)
+				span.Fail(decodeErr)
+				span.End()
+				settle(msg, NackDiscard)
+				continue
 			}
+
+			started := time.Now()
+			handler(ctx, msgBody, func(ackType Acktype) {
+				recordHandled(queueName, ackType, started)
+				span.SetAttribute("messaging.rabbitmq.ack", ackType.String())
+				span.End()
+				settle(msg, ackType)
+			})
 		}
-		return nil
 	}()
 
 	return nil
+}
 
+// immediate adapts a handler that settles every message as soon as it returns
+func immediate[T any](handler func(context.Context, T) Acktype) func(context.Context, T, AckFunc) {
+	return func(ctx context.Context, val T, ack AckFunc) {
+		ack(handler(ctx, val))
+	}
+}
+
+func withoutContext[T any](handler func(T) Acktype) func(context.Context, T) Acktype {
+	return func(_ context.Context, val T) Acktype {
+		return handler(val)
+	}
+}
+
+// acknowledge the message and remove from the queue
+func settle(msg amqp.Delivery, ackType Acktype) {
+	switch ackType {
+	case Ack:
+		msg.Ack(false)
+	case NackRequeue:
+		msg.Nack(false, true)
+	case NackDiscard:
+		msg.Nack(false, false)
+	}
+	slog.Debug("message settled", "routing_key", msg.RoutingKey, "ack", ackType)
+}
+
+func decodeJSON[T any](data []byte) (T, error) {
+	var msgBody T
+	err := json.Unmarshal(data, &msgBody)
+	return msgBody, err
+}
 
+func decodeGob[T any](data []byte) (T, error) {
+	var msgBody T
+	decoder := gob.NewDecoder(bytes.NewBuffer(data))
+	err := decoder.Decode(&msgBody)
+	return msgBody, err
 }
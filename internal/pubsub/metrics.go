@@ -0,0 +1,47 @@
+package pubsub
+
+import (
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/metrics"
+)
+
+var (
+	publishedMessages = metrics.NewCounter("peril_pubsub_published_total",
+		"Messages published, by exchange and encoding", "exchange", "encoding")
+	publishErrors = metrics.NewCounter("peril_pubsub_publish_errors_total",
+		"Messages that could not be encoded or published, by exchange", "exchange")
+	consumedMessages = metrics.NewCounter("peril_pubsub_consumed_total",
+		"Messages settled by subscribers, by queue and how they were settled", "queue", "ack")
+	decodeFailures = metrics.NewCounter("peril_pubsub_decode_failures_total",
+		"Messages discarded because they could not be decoded, by queue", "queue")
+	rejectedMessages = metrics.NewCounter("peril_pubsub_rejected_total",
+		"Messages discarded because they failed verification, by queue", "queue")
+	handlerDuration = metrics.NewHistogram("peril_pubsub_handler_duration_seconds",
+		"Time from handing a message to its handler until it was settled, by queue", metrics.DurationBuckets, "queue")
+)
+
+func (a Acktype) String() string {
+	switch a {
+	case Ack:
+		return "ack"
+	case NackRequeue:
+		return "nack_requeue"
+	case NackDiscard:
+		return "nack_discard"
+	}
+	return "unknown"
+}
+
+func recordPublish(exchange, encoding string, err error) {
+	if err != nil {
+		publishErrors.Inc(exchange)
+		return
+	}
+	publishedMessages.Inc(exchange, encoding)
+}
+
+func recordHandled(queue string, ackType Acktype, started time.Time) {
+	handlerDuration.Observe(time.Since(started).Seconds(), queue)
+	consumedMessages.Inc(queue, ackType.String())
+}
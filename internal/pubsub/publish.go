@@ -5,27 +5,55 @@ import (
 	"context"
 	"encoding/gob"
 	"encoding/json"
-	"fmt"
+	"log/slog"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// PublishOption adjusts a message right before it is published with
+// routing key key
+type PublishOption func(key string, msg *amqp.Publishing) error
+
+// WithHeader sets an AMQP header on the published message
+func WithHeader(header string, value any) PublishOption {
+	return func(key string, msg *amqp.Publishing) error {
+		setHeader(msg, header, value)
+		return nil
+	}
+}
+
+func applyPublishOptions(key string, msg *amqp.Publishing, opts []PublishOption) error {
+	for _, opt := range opts {
+		if err := opt(key, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Publishes PublishJSON value of generic Type T into exchange by channel ch
 // value is Marshaled to json
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
+func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) (err error) {
+	defer func() { recordPublish(exchange, "json", err) }()
 
 	bytesVal, err := json.Marshal(val)
 	if err != nil {
-		fmt.Println("error marshalling data to publish", err)
+		slog.Debug("could not encode message", "exchange", exchange, "routing_key", key, "err", err)
 		return err
 	}
 	msg := amqp.Publishing{
 		ContentType: "application/json",
 		Body:        bytesVal,
 	}
+	if err := applyPublishOptions(key, &msg, opts); err != nil {
+		slog.Debug("could not prepare message", "exchange", exchange, "routing_key", key, "err", err)
+		return err
+	}
+	span := startPublishSpan(exchange, key, &msg)
 	publishErr := ch.PublishWithContext(context.Background(), exchange, key, false, false, msg)
+	endPublishSpan(span, publishErr)
 	if publishErr != nil {
-		fmt.Printf("error publishing message to queue: %v\n", publishErr)
+		slog.Debug("could not publish message", "exchange", exchange, "routing_key", key, "err", publishErr)
 		return publishErr
 	}
 
@@ -35,30 +63,34 @@ func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
 // Publishes PublishGob value of generic Type T into exchange by channel ch
 // value is parsed to gob type
 
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
+func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T, opts ...PublishOption) (err error) {
+	defer func() { recordPublish(exchange, "gob", err) }()
 
 	var bytesBuffer bytes.Buffer
 	gobEncoder := gob.NewEncoder(&bytesBuffer)
 
 	gobEncodingError := gobEncoder.Encode(val)
 	if gobEncodingError != nil {
-		fmt.Printf("error encoding data to job to publish: %v \n", gobEncodingError)
+		slog.Debug("could not encode message", "exchange", exchange, "routing_key", key, "err", gobEncodingError)
 		return gobEncodingError
 	}
 
 	message := amqp.Publishing{
 		ContentType: "application/gob",
-		Body: bytesBuffer.Bytes(),
+		Body:        bytesBuffer.Bytes(),
+	}
+	if err := applyPublishOptions(key, &message, opts); err != nil {
+		slog.Debug("could not prepare message", "exchange", exchange, "routing_key", key, "err", err)
+		return err
 	}
 
+	span := startPublishSpan(exchange, key, &message)
 	publishErr := ch.PublishWithContext(context.Background(), exchange, key, false, false, message)
+	endPublishSpan(span, publishErr)
 	if publishErr != nil {
-		fmt.Printf("error publishing message to queue: %v\n", publishErr)
+		slog.Debug("could not publish message", "exchange", exchange, "routing_key", key, "err", publishErr)
 		return publishErr
 	}
 
 	return nil
 }
-
-
-
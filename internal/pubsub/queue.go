@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// consumers of a stream must limit their unacked messages, this is used
+// when the subscription sets no prefetch of its own
+const streamPrefetch = 100
+
+// QueueType is how the broker stores a queue
+type QueueType string
+
+const (
+	QueueClassic QueueType = "classic"
+	// QueueQuorum is replicated across the cluster, it must be durable
+	QueueQuorum QueueType = "quorum"
+	// QueueStream keeps messages after they were consumed, it must be durable
+	QueueStream QueueType = "stream"
+)
+
+// Overflow is what a queue at its maximum length does with new messages
+type Overflow string
+
+const (
+	OverflowDropHead         Overflow = "drop-head"
+	OverflowRejectPublish    Overflow = "reject-publish"
+	OverflowRejectPublishDLX Overflow = "reject-publish-dlx"
+)
+
+// QueueOptions describes a queue declared by DeclareAndBind. The zero
+// value is a classic queue that is neither durable nor tied to the
+// connection
+type QueueOptions struct {
+	Durable    bool // survives a broker restart
+	Exclusive  bool // used by this connection only and deleted with it
+	AutoDelete bool // deleted once its last consumer is gone
+	Type       QueueType
+
+	// only one consumer at a time gets messages, the others take over
+	// when it goes away
+	SingleActiveConsumer bool
+	MaxLength            int // messages, 0 is unlimited
+	MaxLengthBytes       int // message bodies, 0 is unlimited
+	Overflow             Overflow
+	MessageTTL           time.Duration // messages older than this are dead lettered, 0 keeps them
+	Expires              time.Duration // the queue is deleted once unused this long, 0 keeps it
+	MaxAge               time.Duration // streams drop messages older than this, 0 keeps them
+	Lazy                 bool          // classic queues keep messages on disk rather than in memory
+}
+
+var (
+	// QueueDurable survives broker restarts and is shared by its consumers
+	QueueDurable = QueueOptions{Durable: true}
+	// QueueTransient belongs to one connection and goes away with it
+	QueueTransient = QueueOptions{Exclusive: true, AutoDelete: true}
+)
+
+// Validate refuses options the broker would reject on declaration
+func (q QueueOptions) Validate() error {
+	switch q.Type {
+	case "", QueueClassic:
+		if q.MaxAge > 0 {
+			return errors.New("only streams have a maximum age")
+		}
+		return q.validateLimits()
+	case QueueQuorum, QueueStream:
+		if !q.Durable || q.Exclusive || q.AutoDelete {
+			return fmt.Errorf("%s queues must be durable and may not be exclusive or auto deleted", q.Type)
+		}
+		if q.Lazy {
+			return errors.New("only classic queues can be lazy")
+		}
+	default:
+		return fmt.Errorf("unknown queue type %q", q.Type)
+	}
+	if q.Type == QueueQuorum {
+		if q.MaxAge > 0 {
+			return errors.New("only streams have a maximum age")
+		}
+		if q.Overflow == OverflowRejectPublishDLX {
+			return errors.New("quorum queues do not support reject-publish-dlx")
+		}
+		return q.validateLimits()
+	}
+	switch {
+	case q.MaxLength > 0 || q.Overflow != "":
+		return errors.New("streams are only limited by MaxLengthBytes and MaxAge")
+	case q.MessageTTL > 0 || q.Expires > 0:
+		return errors.New("streams use MaxAge instead of a TTL")
+	case q.SingleActiveConsumer:
+		return errors.New("streams have no single active consumer over AMQP")
+	case q.MaxLengthBytes < 0 || q.MaxAge < 0:
+		return errors.New("limits must not be negative")
+	case q.MaxAge > 0 && q.MaxAge < time.Second:
+		return errors.New("the maximum age of a stream is counted in seconds")
+	}
+	return nil
+}
+
+func (q QueueOptions) validateLimits() error {
+	switch {
+	case q.MaxLength < 0 || q.MaxLengthBytes < 0 || q.MessageTTL < 0 || q.Expires < 0:
+		return errors.New("limits must not be negative")
+	case q.Overflow != "" && q.Overflow != OverflowDropHead && q.Overflow != OverflowRejectPublish && q.Overflow != OverflowRejectPublishDLX:
+		return fmt.Errorf("unknown overflow %q", q.Overflow)
+	case q.Overflow != "" && q.MaxLength == 0 && q.MaxLengthBytes == 0:
+		return errors.New("an overflow needs a maximum length")
+	}
+	return nil
+}
+
+// arguments are the x- arguments of the declaration. Classic queues get no
+// type argument, so queues declared before there were options still match
+func (q QueueOptions) arguments() amqp.Table {
+	args := amqp.Table{}
+	if q.Type != QueueStream {
+		// messages discarded by a handler or dropped by a full queue end up
+		// in the dead letter exchange, streams never dead letter
+		args["x-dead-letter-exchange"] = routing.ExchangeDLX
+	}
+	if q.Type == QueueQuorum || q.Type == QueueStream {
+		args[amqp.QueueTypeArg] = string(q.Type)
+	}
+	if q.SingleActiveConsumer {
+		args[amqp.SingleActiveConsumerArg] = true
+	}
+	if q.MaxLength > 0 {
+		args[amqp.QueueMaxLenArg] = q.MaxLength
+	}
+	if q.MaxLengthBytes > 0 {
+		args[amqp.QueueMaxLenBytesArg] = q.MaxLengthBytes
+	}
+	if q.Overflow != "" {
+		args[amqp.QueueOverflowArg] = string(q.Overflow)
+	}
+	if q.MessageTTL > 0 {
+		args[amqp.QueueMessageTTLArg] = q.MessageTTL.Milliseconds()
+	}
+	if q.Expires > 0 {
+		args[amqp.QueueTTLArg] = q.Expires.Milliseconds()
+	}
+	if q.MaxAge > 0 {
+		args[amqp.StreamMaxAgeArg] = fmt.Sprintf("%ds", int64(q.MaxAge.Seconds()))
+	}
+	if q.Lazy {
+		args["x-queue-mode"] = "lazy"
+	}
+	return args
+}
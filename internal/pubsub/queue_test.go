@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestQueueOptionsValidate(t *testing.T) {
+	quorum := QueueOptions{Durable: true, Type: QueueQuorum}
+	stream := QueueOptions{Durable: true, Type: QueueStream}
+	tests := []struct {
+		name    string
+		options QueueOptions
+		wantErr string
+	}{
+		{"zero value", QueueOptions{}, ""},
+		{"durable", QueueDurable, ""},
+		{"transient", QueueTransient, ""},
+		{"classic limits", QueueOptions{MaxLength: 10, Overflow: OverflowRejectPublishDLX, MessageTTL: time.Minute, Expires: time.Hour, Lazy: true}, ""},
+		{"quorum", QueueOptions{Durable: true, Type: QueueQuorum, SingleActiveConsumer: true, MaxLengthBytes: 1 << 20, Overflow: OverflowDropHead}, ""},
+		{"stream", QueueOptions{Durable: true, Type: QueueStream, MaxLengthBytes: 1 << 30, MaxAge: 24 * time.Hour}, ""},
+		{"unknown type", QueueOptions{Type: "mirrored"}, `unknown queue type "mirrored"`},
+		{"classic max age", QueueOptions{MaxAge: time.Hour}, "only streams have a maximum age"},
+		{"negative length", QueueOptions{MaxLength: -1}, "must not be negative"},
+		{"negative ttl", QueueOptions{MessageTTL: -time.Second}, "must not be negative"},
+		{"unknown overflow", QueueOptions{MaxLength: 1, Overflow: "drop-tail"}, `unknown overflow "drop-tail"`},
+		{"overflow without length", QueueOptions{Overflow: OverflowDropHead}, "needs a maximum length"},
+		{"transient quorum", QueueOptions{Type: QueueQuorum}, "quorum queues must be durable"},
+		{"exclusive stream", QueueOptions{Durable: true, Exclusive: true, Type: QueueStream}, "stream queues must be durable"},
+		{"lazy quorum", QueueOptions{Durable: true, Type: QueueQuorum, Lazy: true}, "only classic queues can be lazy"},
+		{"quorum max age", QueueOptions{Durable: true, Type: QueueQuorum, MaxAge: time.Hour}, "only streams have a maximum age"},
+		{"quorum reject-publish-dlx", QueueOptions{Durable: true, Type: QueueQuorum, MaxLength: 1, Overflow: OverflowRejectPublishDLX}, "do not support reject-publish-dlx"},
+		{"quorum limits", func() QueueOptions { q := quorum; q.Expires = -time.Second; return q }(), "must not be negative"},
+		{"stream max length", func() QueueOptions { q := stream; q.MaxLength = 10; return q }(), "only limited by MaxLengthBytes and MaxAge"},
+		{"stream overflow", func() QueueOptions { q := stream; q.Overflow = OverflowDropHead; return q }(), "only limited by MaxLengthBytes and MaxAge"},
+		{"stream ttl", func() QueueOptions { q := stream; q.MessageTTL = time.Minute; return q }(), "use MaxAge instead of a TTL"},
+		{"stream single active consumer", func() QueueOptions { q := stream; q.SingleActiveConsumer = true; return q }(), "no single active consumer"},
+		{"stream negative bytes", func() QueueOptions { q := stream; q.MaxLengthBytes = -1; return q }(), "must not be negative"},
+		{"stream max age below a second", func() QueueOptions { q := stream; q.MaxAge = time.Millisecond; return q }(), "counted in seconds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueueOptionsArguments(t *testing.T) {
+	tests := []struct {
+		name    string
+		options QueueOptions
+		want    amqp.Table
+	}{
+		{
+			name:    "classic queues only dead letter",
+			options: QueueDurable,
+			want:    amqp.Table{"x-dead-letter-exchange": routing.ExchangeDLX},
+		},
+		{
+			name:    "classic type is implied",
+			options: QueueOptions{Type: QueueClassic},
+			want:    amqp.Table{"x-dead-letter-exchange": routing.ExchangeDLX},
+		},
+		{
+			name: "classic limits",
+			options: QueueOptions{
+				MaxLength:      10,
+				MaxLengthBytes: 1024,
+				Overflow:       OverflowRejectPublish,
+				MessageTTL:     1500 * time.Millisecond,
+				Expires:        time.Minute,
+				Lazy:           true,
+			},
+			want: amqp.Table{
+				"x-dead-letter-exchange": routing.ExchangeDLX,
+				amqp.QueueMaxLenArg:      10,
+				amqp.QueueMaxLenBytesArg: 1024,
+				amqp.QueueOverflowArg:    "reject-publish",
+				amqp.QueueMessageTTLArg:  int64(1500),
+				amqp.QueueTTLArg:         int64(60000),
+				"x-queue-mode":           "lazy",
+			},
+		},
+		{
+			name:    "quorum",
+			options: QueueOptions{Durable: true, Type: QueueQuorum, SingleActiveConsumer: true},
+			want: amqp.Table{
+				"x-dead-letter-exchange":     routing.ExchangeDLX,
+				amqp.QueueTypeArg:            "quorum",
+				amqp.SingleActiveConsumerArg: true,
+			},
+		},
+		{
+			name:    "streams never dead letter",
+			options: QueueOptions{Durable: true, Type: QueueStream, MaxLengthBytes: 1 << 20, MaxAge: 90 * time.Minute},
+			want: amqp.Table{
+				amqp.QueueTypeArg:        "stream",
+				amqp.QueueMaxLenBytesArg: 1 << 20,
+				amqp.StreamMaxAgeArg:     "5400s",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.arguments(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("arguments = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitMQ direct reply-to pseudo queue, replies to it need no declared queue
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+var ErrNoResponder = errors.New("no one is handling requests on this key")
+var ErrRequestTimeout = errors.New("request timed out")
+
+// RequestJSON publishes req and waits for the reply of a ServeJSON handler.
+// The request expires together with the timeout, so a late responder never
+// handles a request nobody is waiting for anymore
+func RequestJSON[Req, Resp any](conn *amqp.Connection, exchange, key string, req Req, timeout time.Duration, opts ...PublishOption) (Resp, error) {
+	var resp Resp
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return resp, fmt.Errorf("could not open channel: %v", err)
+	}
+	defer channel.Close()
+
+	replies, err := channel.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		return resp, fmt.Errorf("could not consume replies: %v", err)
+	}
+	returns := channel.NotifyReturn(make(chan amqp.Return, 1))
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("could not encode request: %v", err)
+	}
+	correlationID, err := newCorrelationID()
+	if err != nil {
+		return resp, err
+	}
+	msg := amqp.Publishing{
+		ContentType:   "application/json",
+		Body:          body,
+		ReplyTo:       directReplyTo,
+		CorrelationId: correlationID,
+		Expiration:    strconv.FormatInt(timeout.Milliseconds(), 10),
+	}
+	if err := applyPublishOptions(key, &msg, opts); err != nil {
+		return resp, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// mandatory, so we hear about it right away when no queue is bound to key
+	span := startPublishSpan(exchange, key, &msg)
+	err = channel.PublishWithContext(ctx, exchange, key, true, false, msg)
+	endPublishSpan(span, err)
+	recordPublish(exchange, "json", err)
+	if err != nil {
+		return resp, fmt.Errorf("could not publish request: %v", err)
+	}
+
+	for {
+		select {
+		case <-returns:
+			return resp, ErrNoResponder
+		case <-ctx.Done():
+			return resp, ErrRequestTimeout
+		case reply, ok := <-replies:
+			if !ok {
+				return resp, errors.New("reply channel closed")
+			}
+			if reply.CorrelationId != correlationID {
+				continue
+			}
+			if err := json.Unmarshal(reply.Body, &resp); err != nil {
+				return resp, fmt.Errorf("could not decode reply: %v", err)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// ServeJSON answers every request published with RequestJSON to key with
+// the value returned by handler
+func ServeJSON[Req, Resp any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queue QueueOptions,
+	handler func(Req) Resp,
+	opts ...SubscribeOption,
+) error {
+	options := subscribeOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	channel, _, err := DeclareAndBind(conn, exchange, queueName, key, queue)
+	if err != nil {
+		return fmt.Errorf("could not declare queue %s on exchange %s: %v", queueName, exchange, err)
+	}
+
+	deliveryChannel, err := channel.Consume(queueName, "", false, false, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return fmt.Errorf("could not consume from queue %s: %v", queueName, err)
+	}
+
+	closeOnStop(channel, options.stop)
+	go func() {
+		defer channel.Close()
+		for msg := range deliveryChannel {
+			_, span := startProcessSpan(queueName, msg)
+			finish := func(ackType Acktype, err error) {
+				span.Fail(err)
+				span.SetAttribute("messaging.rabbitmq.ack", ackType.String())
+				span.End()
+				settle(msg, ackType)
+			}
+
+			if msg.ReplyTo == "" {
+				slog.Warn("discarding request without reply address", "queue", queueName)
+				finish(NackDiscard, errors.New("no reply address"))
+				continue
+			}
+
+			if _, err := options.check(context.Background(), msg); err != nil {
+				slog.Warn("rejecting request", "queue", queueName, "err", err)
+				rejectedMessages.Inc(queueName)
+				finish(NackDiscard, err)
+				continue
+			}
+
+			req, err := decodeJSON[Req](msg.Body)
+			if err != nil {
+				slog.Warn("could not decode request", "queue", queueName, "err", err)
+				decodeFailures.Inc(queueName)
+				finish(NackDiscard, err)
+				continue
+			}
+
+			started := time.Now()
+			body, err := json.Marshal(handler(req))
+			if err != nil {
+				slog.Error("could not encode reply", "queue", queueName, "err", err)
+				recordHandled(queueName, NackDiscard, started)
+				finish(NackDiscard, err)
+				continue
+			}
+			reply := amqp.Publishing{
+				ContentType:   "application/json",
+				Body:          body,
+				CorrelationId: msg.CorrelationId,
+			}
+			err = channel.PublishWithContext(context.Background(), "", msg.ReplyTo, false, false, reply)
+			recordPublish("", "json", err)
+			if err != nil {
+				slog.Error("could not send reply", "queue", queueName, "err", err)
+				recordHandled(queueName, NackRequeue, started)
+				finish(NackRequeue, err)
+				continue
+			}
+			recordHandled(queueName, Ack, started)
+			finish(Ack, nil)
+		}
+	}()
+
+	return nil
+}
+
+func newCorrelationID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("could not create correlation id: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WithContext makes the message part of the trace of the span in ctx,
+// usually the span of the handler publishing it
+func WithContext(ctx context.Context) PublishOption {
+	return func(key string, msg *amqp.Publishing) error {
+		if span := tracing.FromContext(ctx); span != nil {
+			setHeader(msg, tracing.Header, span.Context().Traceparent())
+		}
+		return nil
+	}
+}
+
+func setHeader(msg *amqp.Publishing, header string, value any) {
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.Headers[header] = value
+}
+
+// headerContext reads the trace context of a message, a zero SpanContext
+// when it has none
+func headerContext(headers amqp.Table) tracing.SpanContext {
+	header, _ := headers[tracing.Header].(string)
+	sc, err := tracing.ParseTraceparent(header)
+	if err != nil {
+		return tracing.SpanContext{}
+	}
+	return sc
+}
+
+// startPublishSpan starts the span of publishing msg as a child of the
+// context WithContext put in its headers, and sends its own context instead
+func startPublishSpan(exchange, key string, msg *amqp.Publishing) *tracing.Span {
+	_, span := tracing.Start(context.Background(), key+" publish", headerContext(msg.Headers))
+	if span == nil {
+		return nil
+	}
+	span.SetAttribute("messaging.system", "rabbitmq")
+	span.SetAttribute("messaging.operation", "publish")
+	span.SetAttribute("messaging.destination.name", exchange)
+	span.SetAttribute("messaging.rabbitmq.destination.routing_key", key)
+	setHeader(msg, tracing.Header, span.Context().Traceparent())
+	return span
+}
+
+// startProcessSpan starts the span of handling msg as a child of the
+// publish span that sent it
+func startProcessSpan(queue string, msg amqp.Delivery) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(context.Background(), queue+" process", headerContext(msg.Headers))
+	span.SetAttribute("messaging.system", "rabbitmq")
+	span.SetAttribute("messaging.operation", "process")
+	span.SetAttribute("messaging.source.name", queue)
+	span.SetAttribute("messaging.rabbitmq.destination.routing_key", msg.RoutingKey)
+	return ctx, span
+}
+
+func endPublishSpan(span *tracing.Span, err error) {
+	span.Fail(err)
+	span.End()
+}
@@ -0,0 +1,49 @@
+package routing
+
+import "fmt"
+
+// GamePrefix starts the routing keys and queue names of every game but
+// the default one
+const GamePrefix = "game"
+
+const maxGameLength = 32
+
+// Game namespaces the routing keys and queue names of one game, so any
+// number of games share the exchanges of a broker without seeing each
+// other's messages. The default game keeps the keys without a prefix
+type Game string
+
+const DefaultGame Game = ""
+
+// ParseGame validates a game ID. "default" and "" name the default game
+func ParseGame(id string) (Game, error) {
+	if id == "" || id == "default" {
+		return DefaultGame, nil
+	}
+	if len(id) > maxGameLength {
+		return "", fmt.Errorf("game can be at most %d characters long", maxGameLength)
+	}
+	for _, r := range id {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isDigit := r >= '0' && r <= '9'
+		if !isLetter && !isDigit && r != '_' && r != '-' {
+			return "", fmt.Errorf("game can only contain letters, digits, \"_\" and \"-\", not %q", r)
+		}
+	}
+	return Game(id), nil
+}
+
+// Key puts a routing key, binding pattern or queue name into the game
+func (g Game) Key(key string) string {
+	if g == DefaultGame {
+		return key
+	}
+	return GamePrefix + "." + string(g) + "." + key
+}
+
+func (g Game) String() string {
+	if g == DefaultGame {
+		return "default"
+	}
+	return string(g)
+}
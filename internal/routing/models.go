@@ -4,10 +4,170 @@ import "time"
 
 type PlayingState struct {
 	IsPaused bool
+	// ResumeAt is when the server ends a timed pause by itself, zero while
+	// the game runs or until a pause is ended by hand
+	ResumeAt time.Time
+}
+
+// LobbyAction is what a LobbyRequest asks for
+type LobbyAction string
+
+const (
+	LobbyList   LobbyAction = "list"
+	LobbyCreate LobbyAction = "create"
+)
+
+type LobbyRequest struct {
+	Action LobbyAction
+	Game   string // LobbyCreate
+	Key    string // LobbyCreate, the servers only let players knowing it create games
+}
+
+type LobbyReply struct {
+	Accepted bool
+	Reason   string
+	Games    []GameSummary
+}
+
+// GameAnnouncement tells the other servers about a game created in the
+// lobby. MAC proves it comes from a server knowing the session secret
+type GameAnnouncement struct {
+	Game string
+	MAC  []byte
+}
+
+// GameSummary describes a game for players choosing one to join
+type GameSummary struct {
+	ID        string
+	Players   int
+	Paused    bool
+	CreatedAt time.Time
+}
+
+// RegistrationRequest asks the server to reserve a username for the session
+type RegistrationRequest struct {
+	Username string
+}
+
+type RegistrationReply struct {
+	Accepted bool
+	Reason   string // why the username was rejected
+	Token    string // session token to send with every message
+	// ExpiresAt ends the session, rotating the signing key renews it
+	ExpiresAt time.Time
+	State     PlayingState // whether the game is paused right now
+
+	KeyID      string
+	PrivateKey []byte // ed25519 seed the player signs messages with
+	ServerKey  []byte // ed25519 public key of the servers
+}
+
+// KeyAnnouncement publishes a player's public key. It is signed by the
+// server, so players can trust it no matter who delivered it
+type KeyAnnouncement struct {
+	Username  string
+	KeyID     string
+	PublicKey []byte
+	Replaces  string // key retired by this one, accepted for a grace period
+	Signature []byte
+}
+
+type KeyLookupRequest struct {
+	Username string
+	KeyID    string
+}
+
+type KeyLookupReply struct {
+	Found bool
+	Key   KeyAnnouncement
+}
+
+// KeyRotationRequest asks for a new signing key. Signature is made with
+// the current key over the other fields. A key can be rotated once
+type KeyRotationRequest struct {
+	Username    string
+	KeyID       string
+	RequestedAt time.Time
+	ReplyKey    []byte // X25519 key the new private key is sealed to
+	Signature   []byte
+}
+
+type KeyRotationReply struct {
+	Accepted   bool
+	Reason     string
+	KeyID      string
+	Token      string // renewed session
+	ExpiresAt  time.Time
+	SealingKey []byte // one time X25519 key of the server
+	SealedKey  []byte // ed25519 seed, readable with the private half of ReplyKey
+}
+
+// AdminAction is what an AdminCommand does to its player
+type AdminAction string
+
+const (
+	AdminKick         AdminAction = "kick"
+	AdminMute         AdminAction = "mute" // no moves until Until or unmuted
+	AdminUnmute       AdminAction = "unmute"
+	AdminGrantUnits   AdminAction = "grant"
+	AdminRemoveUnits  AdminAction = "remove"
+	AdminPausePlayer  AdminAction = "pause"
+	AdminResumePlayer AdminAction = "resume"
+)
+
+// AdminCommand is sent by the server to one player
+type AdminCommand struct {
+	Action AdminAction
+	Reason string    // shown to the player
+	Until  time.Time // end of a mute or pause, zero until lifted by hand
+
+	// AdminGrantUnits
+	Location string
+	Rank     string
+	Count    int
+
+	// AdminRemoveUnits
+	UnitIDs []int
+}
+
+// EventType says what happened in a GameLog
+type EventType string
+
+const (
+	// Free text log. Logs published before events were added decode to it
+	EventMessage EventType = ""
+
+	EventWarWon  EventType = "war_won"
+	EventWarLost EventType = "war_lost"
+	EventWarDraw EventType = "war_draw"
+	EventSpawn   EventType = "spawn"
+	EventMove    EventType = "move"
+	EventJoin    EventType = "join"
+	EventLeave   EventType = "leave"
+	EventPause   EventType = "pause"
+	EventResume  EventType = "resume"
+	EventAdmin   EventType = "admin" // an admin command targeted at the player
+)
+
+// LoggedUnit is a unit involved in a logged event
+type LoggedUnit struct {
+	Player   string
+	ID       int
+	Rank     string
+	Location string
 }
 
 type GameLog struct {
 	CurrentTime time.Time
-	Message     string
+	Message     string // human readable form, always set by publishers
 	Username    string
+
+	// Structured fields. gob matches fields by name, so logs from older
+	// clients still decode and simply leave these empty
+	Event    EventType
+	Location string
+	Opponent string // the other player of a war
+	Winner   string
+	Loser    string
+	Units    []LoggedUnit
 }
@@ -8,6 +8,44 @@ const (
 	PauseKey = "pause"
 
 	GameLogSlug = "game_logs"
+
+	PresenceKey = "presence"
+
+	RegisterKey = "register"
+
+	KeysPrefix = "keys"
+
+	KeyLookupKey = "key_lookup"
+
+	KeyRotateKey = "key_rotate"
+
+	// AdminPrefix.<username> targets admin commands at one player
+	AdminPrefix = "admin"
+
+	// LobbyKey is shared by every game, it lists and creates them
+	LobbyKey = "lobby"
+
+	// GamesPrefix.<game> announces a game created in the lobby, so every
+	// server runs it
+	GamesPrefix = "games"
+
+	// LeaderQueue is held by the server leading a game
+	LeaderQueue = "leader"
+
+	// ControlKey takes the commands followers forward to the leader
+	ControlKey = "control"
+
+	// SchedulesKey carries the scheduled pauses of the leader to the followers
+	SchedulesKey = "schedules"
+)
+
+// AMQP headers set on published messages
+const (
+	SessionHeader = "x-peril-session"
+
+	SignerHeader    = "x-peril-signer"
+	KeyIDHeader     = "x-peril-key-id"
+	SignatureHeader = "x-peril-signature"
 )
 
 const (
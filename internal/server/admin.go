@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// ErrNotPlaying is returned for commands targeted at a player this server
+// does not see online
+var ErrNotPlaying = errors.New("the player is not online")
+
+// SendAdmin sends cmd to username only and records it in the game log.
+// Players not online are refused, their queue would drop the command.
+// Followers forward it to the leader
+func (s *Server) SendAdmin(username string, cmd routing.AdminCommand) error {
+	if err := gamelogic.ValidateAdmin(cmd); err != nil {
+		return err
+	}
+	if !s.Leading() {
+		_, err := s.forward(controlRequest{Action: controlAdmin, Username: username, Admin: cmd})
+		return err
+	}
+	return s.sendAdmin(username, cmd)
+}
+
+func (s *Server) sendAdmin(username string, cmd routing.AdminCommand) error {
+	if err := gamelogic.ValidateAdmin(cmd); err != nil {
+		return err
+	}
+	if !s.Leading() {
+		return ErrNotLeader
+	}
+	if _, ok := s.roster.Get(username); !ok {
+		return ErrNotPlaying
+	}
+
+	if err := pubsub.PublishJSON(s.channel, routing.ExchangePerilDirect, s.game.Key(routing.AdminPrefix+"."+username), cmd, s.opts...); err != nil {
+		return fmt.Errorf("could not send admin command: %v", err)
+	}
+	slog.Info("sent admin command", "username", username, "action", cmd.Action, "reason", cmd.Reason)
+
+	// logged by the server, a kicked player leaves before it could
+	if err := pubsub.PublishGob(s.channel, routing.ExchangePerilTopic, s.game.Key(routing.GameLogSlug+"."+username), gamelogic.NewAdminLog(username, cmd), s.opts...); err != nil {
+		slog.Error("could not log admin command", "username", username, "err", err)
+	}
+	return nil
+}
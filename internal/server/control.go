@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+// controlTimeout is how long a follower waits for the leader to run a
+// forwarded command
+const controlTimeout = 5 * time.Second
+
+type controlAction string
+
+const (
+	controlSetPaused  controlAction = "set_paused"
+	controlPauseFor   controlAction = "pause_for"
+	controlSchedule   controlAction = "schedule"
+	controlUnschedule controlAction = "unschedule"
+	controlSchedules  controlAction = "schedules"
+	controlAdmin      controlAction = "admin"
+)
+
+// controlRequest is a command a follower forwards to the leader
+type controlRequest struct {
+	Action   controlAction
+	Paused   bool          // controlSetPaused
+	For      time.Duration // controlPauseFor
+	Schedule PauseSchedule // controlSchedule
+	ID       int           // controlUnschedule
+	Username string        // controlAdmin
+	Admin    routing.AdminCommand
+}
+
+type controlReply struct {
+	Err       string
+	Scheduled ScheduledPause
+	Schedules []ScheduledPause
+}
+
+// errors the caller of a forwarded command may check for
+var controlErrors = []error{ErrNotLeader, ErrNotPlaying, ErrNoSchedule}
+
+// handleControl runs a command forwarded by a follower
+func (s *Server) handleControl(req controlRequest) controlReply {
+	var reply controlReply
+	var err error
+	switch req.Action {
+	case controlSetPaused:
+		err = s.setPaused(req.Paused)
+	case controlPauseFor:
+		err = s.pauseFor(req.For)
+	case controlSchedule:
+		reply.Scheduled, err = s.leaderSchedule(req.Schedule)
+	case controlUnschedule:
+		err = s.leaderUnschedule(req.ID)
+	case controlSchedules:
+		reply.Schedules = s.Schedules()
+	case controlAdmin:
+		err = s.sendAdmin(req.Username, req.Admin)
+	default:
+		err = fmt.Errorf("unknown control action %q", req.Action)
+	}
+	if err != nil {
+		reply.Err = err.Error()
+	}
+	return reply
+}
+
+// forward runs req on the leader. It fails with ErrNotLeader while no
+// server leads the game
+func (s *Server) forward(req controlRequest) (controlReply, error) {
+	reply, err := pubsub.RequestJSON[controlRequest, controlReply](
+		s.conn,
+		routing.ExchangePerilDirect,
+		s.game.Key(routing.ControlKey),
+		req,
+		controlTimeout,
+		s.opts...,
+	)
+	if errors.Is(err, pubsub.ErrNoResponder) || errors.Is(err, pubsub.ErrRequestTimeout) {
+		return reply, ErrNotLeader
+	}
+	if err != nil {
+		return reply, fmt.Errorf("could not reach the leader: %v", err)
+	}
+	if reply.Err == "" {
+		return reply, nil
+	}
+	for _, known := range controlErrors {
+		if reply.Err == known.Error() {
+			return reply, known
+		}
+	}
+	return reply, errors.New(reply.Err)
+}
+
+// publishSchedules hands the scheduled pauses to the followers, so the
+// next leader keeps them
+func (s *Server) publishSchedules() {
+	err := pubsub.PublishJSON(s.channel, routing.ExchangePerilDirect, s.game.Key(routing.SchedulesKey), s.Schedules(), s.opts...)
+	if err != nil {
+		slog.Error("could not publish scheduled pauses", "err", err)
+	}
+}
+
+// syncSchedules takes the scheduled pauses of the leader, which may have
+// been added before this server started
+func (s *Server) syncSchedules() {
+	reply, err := s.forward(controlRequest{Action: controlSchedules})
+	if err != nil {
+		slog.Debug("could not ask the leader for scheduled pauses", "err", err)
+		return
+	}
+	if !s.Leading() {
+		s.replaceSchedules(reply.Schedules)
+	}
+}
+
+// Followers keep the scheduled pauses of the leader
+func handlerSchedules(s *Server) func([]ScheduledPause) pubsub.Acktype {
+
+	return func(pauses []ScheduledPause) pubsub.Acktype {
+		// the leader's own messages come back to it
+		if !s.Leading() {
+			s.replaceSchedules(pauses)
+		}
+		return pubsub.Ack
+	}
+}
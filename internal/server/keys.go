@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"log/slog"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// rotation requests older than this are refused so they can not be replayed
+const maxRotationAge = time.Minute
+
+// keyService answers key lookups and rotations for players
+type keyService struct {
+	game      routing.Game
+	issuer    *session.Issuer
+	authority *auth.Authority
+	keyring   *auth.Keyring
+	channel   *amqp.Channel
+	opts      []pubsub.PublishOption
+}
+
+func (k *keyService) announce(ann routing.KeyAnnouncement) error {
+	return pubsub.PublishJSON(k.channel, routing.ExchangePerilTopic, k.game.Key(routing.KeysPrefix+"."+ann.Username), ann, k.opts...)
+}
+
+func (k *keyService) lookup(req routing.KeyLookupRequest) routing.KeyLookupReply {
+	if session.ValidateUsername(req.Username) != nil && req.Username != session.ServerUsername {
+		return routing.KeyLookupReply{}
+	}
+	// retired keys stay unknown
+	if _, err := k.keyring.PublicKey(req.Username, req.KeyID); err != nil {
+		return routing.KeyLookupReply{}
+	}
+	return routing.KeyLookupReply{Found: true, Key: k.authority.Announce(req.Username, req.KeyID, "")}
+}
+
+func (k *keyService) rotate(req routing.KeyRotationRequest) routing.KeyRotationReply {
+	if age := time.Since(req.RequestedAt); age > maxRotationAge || age < -maxRotationAge {
+		return routing.KeyRotationReply{Reason: "request expired, check your clock"}
+	}
+	if err := k.keyring.VerifyRotation(req); err != nil {
+		slog.Warn("refusing key rotation", "username", req.Username, "err", err)
+		return routing.KeyRotationReply{Reason: "request is not signed with your current key"}
+	}
+	// a replayed request would otherwise be good for another key
+	if k.keyring.Retired(req.Username, req.KeyID) {
+		slog.Warn("refusing key rotation of a retired key", "username", req.Username, "key_id", req.KeyID)
+		return routing.KeyRotationReply{Reason: "the key was rotated already"}
+	}
+
+	keyID, seed, err := k.authority.IssueKey(req.Username)
+	if err != nil {
+		slog.Error("could not issue key", "username", req.Username, "err", err)
+		return routing.KeyRotationReply{Reason: "the server could not create a key, try again"}
+	}
+	token, claims, err := k.issuer.Issue(req.Username)
+	if err != nil {
+		slog.Error("could not renew session", "username", req.Username, "err", err)
+		return routing.KeyRotationReply{Reason: "the server could not renew your session, try again"}
+	}
+	sealingKey, sealed, err := auth.SealKey(req.ReplyKey, seed)
+	if err != nil {
+		slog.Warn("refusing key rotation", "username", req.Username, "err", err)
+		return routing.KeyRotationReply{Reason: "the request has no valid reply key"}
+	}
+	k.keyring.Retire(req.Username, req.KeyID, time.Now().Add(auth.RotationGrace))
+	if err := k.announce(k.authority.Announce(req.Username, keyID, req.KeyID)); err != nil {
+		slog.Error("could not announce new key", "username", req.Username, "err", err)
+	}
+	slog.Info("rotated signing key", "username", req.Username)
+	return routing.KeyRotationReply{
+		Accepted:   true,
+		KeyID:      keyID,
+		Token:      token,
+		ExpiresAt:  claims.ExpiresAt,
+		SealingKey: sealingKey,
+		SealedKey:  sealed,
+	}
+}
+
+func handlerKeyAnnouncement(keyring *auth.Keyring, serverKey ed25519.PublicKey) func(routing.KeyAnnouncement) pubsub.Acktype {
+
+	return func(ann routing.KeyAnnouncement) pubsub.Acktype {
+		if err := keyring.Learn(ann, serverKey); err != nil {
+			slog.Warn("ignoring key announcement", "username", ann.Username, "err", err)
+			return pubsub.NackDiscard
+		}
+		return pubsub.Ack
+	}
+}
+
+// serveKeys starts answering key requests and following the keys other
+// servers announce
+func serveKeys(conn *amqp.Connection, k *keyService, serverID string) error {
+	err := pubsub.ServeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		k.game.Key(routing.KeyLookupKey),
+		k.game.Key(routing.KeyLookupKey),
+		pubsub.QueueDurable,
+		k.lookup,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = pubsub.ServeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		k.game.Key(routing.KeyRotateKey),
+		k.game.Key(routing.KeyRotateKey),
+		pubsub.QueueDurable,
+		k.rotate,
+	)
+	if err != nil {
+		return err
+	}
+
+	return pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		k.game.Key(routing.KeysPrefix+"."+serverID),
+		k.game.Key(routing.KeysPrefix+".*"),
+		pubsub.QueueTransient,
+		handlerKeyAnnouncement(k.keyring, k.authority.ServerPublicKey()),
+	)
+}
+
+// newKeyring trusts every key derived from the shared secret unless it was retired
+func newKeyring(authority *auth.Authority) *auth.Keyring {
+	return auth.NewKeyring(func(username, keyID string) (ed25519.PublicKey, error) {
+		return authority.PublicKey(username, keyID), nil
+	})
+}
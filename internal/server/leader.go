@@ -0,0 +1,83 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/spectate"
+)
+
+// ErrNotLeader is returned for commands only the leader of a game may run
+// while no server leads it, e.g. during a failover
+var ErrNotLeader = errors.New("no server leads the game right now, try again shortly")
+
+// Leading reports whether this server leads its game. Only the leader
+// registers players, pauses the game, sends admin commands and announces
+// timed out players, followers forward such commands to it. Followers
+// write game logs and answer players like the leader does
+func (s *Server) Leading() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.leading
+}
+
+// setLeading is called by the election. A new leader carries on a timed
+// pause the last one started, or starts a repeating pause whose start no
+// leader was around for
+func (s *Server) setLeading(leading bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leading = leading
+	if !leading {
+		s.stopResumeTimer()
+		if s.serving != nil {
+			close(s.serving)
+			s.serving = nil
+		}
+		return
+	}
+	if s.stopped() {
+		return
+	}
+	// one registrar, so a name is never handed out twice
+	s.serving = make(chan struct{})
+	if err := s.serveRegistrations(s.serving); err != nil {
+		slog.Error("could not serve registrations", "err", err)
+	}
+	if err := s.serveControl(s.serving); err != nil {
+		slog.Error("could not serve forwarded commands", "err", err)
+	}
+	if s.state.ResumeAt.IsZero() {
+		s.pauseMissedWindow()
+		return
+	}
+	if time.Now().Before(s.state.ResumeAt) {
+		s.startResumeTimer(s.state.ResumeAt)
+		return
+	}
+	slog.Info("timed pause ended during the failover, sending resume message")
+	if err := s.publishState(routing.PlayingState{IsPaused: false}); err != nil {
+		slog.Error("could not publish resume", "err", err)
+	}
+}
+
+// Followers keep the state the leader sends, so they can take over
+func handlerPlayingState(s *Server) func(routing.PlayingState) pubsub.Acktype {
+
+	return func(state routing.PlayingState) pubsub.Acktype {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// the leader's own messages come back to it
+		if s.leading {
+			return pubsub.Ack
+		}
+		if state.IsPaused != s.state.IsPaused {
+			s.hub.Publish(spectate.Pause(state.IsPaused))
+		}
+		s.state = state
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/membroker"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func startServer(t *testing.T, b *membroker.Broker, cfg Config) *Server {
+	t.Helper()
+	s, err := Start(dial(t, b, cfg.ID), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tests may close the server themselves
+	t.Cleanup(func() {
+		if !s.stopped() {
+			s.Close()
+		}
+	})
+	return s
+}
+
+// leaderOf waits until exactly one of servers leads and returns it along
+// with a follower
+func leaderOf(t *testing.T, servers ...*Server) (leader, follower *Server) {
+	t.Helper()
+	waitFor(t, "a leader", func() bool {
+		leaders := 0
+		for _, s := range servers {
+			if s.Leading() {
+				leader = s
+				leaders++
+			} else {
+				follower = s
+			}
+		}
+		return leaders == 1
+	})
+	return leader, follower
+}
+
+func TestFollowerForwards(t *testing.T) {
+	b := newBroker(t)
+	leader, follower := leaderOf(t,
+		startServer(t, b, testConfig(t, "one")),
+		startServer(t, b, testConfig(t, "two")),
+	)
+
+	if err := follower.SetPaused(true); err != nil {
+		t.Fatalf("SetPaused on the follower: %v", err)
+	}
+	if !leader.PlayingState().IsPaused {
+		t.Error("the leader did not pause the game for the follower")
+	}
+	waitFor(t, "the follower to learn the game is paused", func() bool {
+		return follower.PlayingState().IsPaused
+	})
+
+	if err := follower.PauseFor(time.Minute); err != nil {
+		t.Fatalf("PauseFor on the follower: %v", err)
+	}
+	if leader.PlayingState().ResumeAt.IsZero() {
+		t.Error("the leader did not start the timed pause for the follower")
+	}
+
+	if err := follower.SetPaused(false); err != nil {
+		t.Fatalf("SetPaused on the follower: %v", err)
+	}
+	waitFor(t, "the follower to learn the game runs again", func() bool {
+		return !follower.PlayingState().IsPaused
+	})
+}
+
+func TestFollowerWithoutLeader(t *testing.T) {
+	b := newBroker(t)
+	// holding the leader queue elsewhere keeps the server a follower
+	holder, err := dial(t, b, "holder").Channel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := holder.QueueDeclare(routing.LeaderQueue, false, false, true, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	follower := startServer(t, b, testConfig(t, "one"))
+
+	time.Sleep(3 * testRetry)
+	if follower.Leading() {
+		t.Fatal("the server took the lead held by another connection")
+	}
+	if err := follower.SetPaused(true); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("SetPaused = %v, want %v", err, ErrNotLeader)
+	}
+	if err := follower.PauseFor(time.Minute); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("PauseFor = %v, want %v", err, ErrNotLeader)
+	}
+	if err := follower.setPaused(true); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("setPaused = %v, want %v without the lead", err, ErrNotLeader)
+	}
+	if follower.PlayingState().IsPaused {
+		t.Error("a follower without a leader paused the game")
+	}
+}
+
+func TestFailoverKeepsTimedPause(t *testing.T) {
+	b := newBroker(t)
+	leader, follower := leaderOf(t,
+		startServer(t, b, testConfig(t, "one")),
+		startServer(t, b, testConfig(t, "two")),
+	)
+
+	if err := leader.PauseFor(500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	resumeAt := leader.PlayingState().ResumeAt
+	waitFor(t, "the follower to learn about the pause", func() bool {
+		return follower.PlayingState().ResumeAt.Equal(resumeAt)
+	})
+
+	leader.Close()
+	waitFor(t, "the follower to take the lead", follower.Leading)
+	if !follower.PlayingState().IsPaused {
+		t.Fatal("the new leader ended the pause early")
+	}
+	// the new leader ends the pause the last one started
+	waitFor(t, "the new leader to resume the game", func() bool {
+		return !follower.PlayingState().IsPaused
+	})
+	if time.Now().Before(resumeAt) {
+		t.Errorf("the game resumed before %v", resumeAt)
+	}
+}
+
+func TestLeaderPausesWindowInProgress(t *testing.T) {
+	b := newBroker(t)
+	cfg := testConfig(t, "one")
+	now := time.Now()
+	// a daily window that started a minute ago and lasts half an hour
+	cfg.Maintenance = []PauseSchedule{{At: now.Add(-time.Minute), For: 30 * time.Minute, Every: 24 * time.Hour}}
+	s := startServer(t, b, cfg)
+
+	waitFor(t, "the server to take the lead", s.Leading)
+	waitFor(t, "the window in progress to pause the game", func() bool {
+		return s.PlayingState().IsPaused
+	})
+	want := now.Add(-time.Minute).Add(30 * time.Minute)
+	if resumeAt := s.PlayingState().ResumeAt; !resumeAt.Equal(want) {
+		t.Errorf("the game resumes at %v, want the end of the window at %v", resumeAt, want)
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logsink"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrGameExists = errors.New("the game already exists")
+var ErrLobbyFull = errors.New("the lobby runs as many games as players may create")
+
+// LobbyConfig limits which games players may create
+type LobbyConfig struct {
+	// MaxGames is how many games, the default one included, a server may
+	// run before players can create no more. Zero means no limit. Games
+	// started by the operator are not limited
+	MaxGames int
+	// CreateKey must be sent by players creating a game, empty keeps
+	// players from creating games at all
+	CreateKey string
+}
+
+// Lobby runs any number of games on one connection and answers players
+// listing and creating games.
+//
+// Servers sharing a broker share the lobby queue. A created game is
+// announced to the other servers, which run it as well, so it is listed by
+// every server whichever took the request. A server started later only
+// runs the games announced since, games every server should run are best
+// started on all of them
+type Lobby struct {
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	cfg     LobbyConfig
+	base    Config
+
+	mu    sync.RWMutex
+	games map[routing.Game]*Server
+}
+
+// NewLobby answers lobby requests on conn. Games are started with base,
+// with Game set and the game logs of named games kept apart
+func NewLobby(conn *amqp.Connection, cfg LobbyConfig, base Config) (*Lobby, error) {
+	if len(base.Secret) == 0 {
+		return nil, errors.New("a session secret is required")
+	}
+	if base.ID == "" {
+		base.ID = instanceID()
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("could not open channel: %v", err)
+	}
+	l := &Lobby{conn: conn, channel: channel, cfg: cfg, base: base, games: map[routing.Game]*Server{}}
+
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilTopic,
+		routing.GamesPrefix+"."+base.ID,
+		routing.GamesPrefix+".*",
+		pubsub.QueueTransient,
+		l.handleAnnouncement,
+	)
+	if err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("could not subscribe to game announcements: %v", err)
+	}
+
+	err = pubsub.ServeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		routing.LobbyKey,
+		routing.LobbyKey,
+		pubsub.QueueDurable,
+		l.handle,
+	)
+	if err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("could not serve the lobby: %v", err)
+	}
+	return l, nil
+}
+
+func (l *Lobby) handle(req routing.LobbyRequest) routing.LobbyReply {
+	switch req.Action {
+	case routing.LobbyList:
+		return routing.LobbyReply{Accepted: true, Games: l.Games()}
+	case routing.LobbyCreate:
+		if l.cfg.CreateKey == "" {
+			return routing.LobbyReply{Reason: "players may not create games on this server"}
+		}
+		if subtle.ConstantTimeCompare([]byte(req.Key), []byte(l.cfg.CreateKey)) != 1 {
+			return routing.LobbyReply{Reason: "wrong create key"}
+		}
+		game, err := routing.ParseGame(req.Game)
+		if err != nil {
+			return routing.LobbyReply{Reason: err.Error()}
+		}
+		if _, err := l.create(game, l.cfg.MaxGames); err != nil {
+			return routing.LobbyReply{Reason: err.Error()}
+		}
+		return routing.LobbyReply{Accepted: true, Games: l.Games()}
+	}
+	return routing.LobbyReply{Reason: fmt.Sprintf("unknown lobby action %q", req.Action)}
+}
+
+// handleAnnouncement runs a game another server created
+func (l *Lobby) handleAnnouncement(a routing.GameAnnouncement) pubsub.Acktype {
+	game, err := routing.ParseGame(a.Game)
+	if err != nil || !hmac.Equal(a.MAC, announcementMAC(l.base.Secret, game)) {
+		slog.Warn("discarding game announcement", "game", a.Game)
+		return pubsub.NackDiscard
+	}
+	// the creator checked the limit, every server runs the same games
+	if _, err := l.start(game, 0); err != nil && !errors.Is(err, ErrGameExists) {
+		slog.Error("could not start announced game", "game", game.String(), "err", err)
+	}
+	return pubsub.Ack
+}
+
+// Create starts a game and announces it to the other servers
+func (l *Lobby) Create(game routing.Game) (*Server, error) {
+	return l.create(game, 0)
+}
+
+func (l *Lobby) create(game routing.Game, limit int) (*Server, error) {
+	srv, err := l.start(game, limit)
+	if err != nil {
+		return nil, err
+	}
+	if game != routing.DefaultGame {
+		announcement := routing.GameAnnouncement{Game: string(game), MAC: announcementMAC(l.base.Secret, game)}
+		if err := pubsub.PublishJSON(l.channel, routing.ExchangePerilTopic, routing.GamesPrefix+"."+string(game), announcement); err != nil {
+			slog.Error("could not announce game", "game", game.String(), "err", err)
+		}
+	}
+	return srv, nil
+}
+
+// start runs game on this server. Once limit games run no more are
+// started, unless limit is 0
+func (l *Lobby) start(game routing.Game, limit int) (*Server, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.games[game]; ok {
+		return nil, ErrGameExists
+	}
+	if limit > 0 && len(l.games) >= limit {
+		return nil, ErrLobbyFull
+	}
+	cfg := l.base
+	cfg.Game = game
+	cfg.Sink = gameSink(cfg.Sink, game)
+	cfg.RetiredKeys = gamePath(cfg.RetiredKeys, game)
+	srv, err := Start(l.conn, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not start game %s: %v", game, err)
+	}
+	l.games[game] = srv
+	slog.Info("created game", "game", game.String())
+	return srv, nil
+}
+
+// Game returns a game running in the lobby
+func (l *Lobby) Game(game routing.Game) (*Server, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	srv, ok := l.games[game]
+	return srv, ok
+}
+
+// Games describes the games running in the lobby, oldest first
+func (l *Lobby) Games() []routing.GameSummary {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	games := make([]routing.GameSummary, 0, len(l.games))
+	for game, srv := range l.games {
+		games = append(games, routing.GameSummary{
+			ID:        game.String(),
+			Players:   len(srv.Players()),
+			Paused:    srv.PlayingState().IsPaused,
+			CreatedAt: srv.created,
+		})
+	}
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].CreatedAt.Before(games[j].CreatedAt)
+	})
+	return games
+}
+
+// Close stops every game
+func (l *Lobby) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	errs := []error{l.channel.Close()}
+	for game, srv := range l.games {
+		if err := srv.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("game %s: %v", game, err))
+		}
+		delete(l.games, game)
+	}
+	return errors.Join(errs...)
+}
+
+// gameSink keeps the game logs of a named game in games/<game> below the
+// configured directory, under the configured file names
+func gameSink(cfg logsink.Config, game routing.Game) logsink.Config {
+	if game == routing.DefaultGame {
+		return cfg
+	}
+	cfg.Dir = filepath.Join(cfg.Dir, "games", string(game))
+	cfg.Path = filepath.Base(cfg.Path)
+	if cfg.StorePath != "" {
+		cfg.StorePath = filepath.Base(cfg.StorePath)
+	}
+	return cfg
+}
+
+// gamePath moves a file of a named game to games/<game> next to path
+func gamePath(path string, game routing.Game) string {
+	if path == "" || game == routing.DefaultGame {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), "games", string(game), filepath.Base(path))
+}
+
+// gameSecret derives the secret of a named game, so its sessions and keys
+// are refused by the others. The default game uses the secret as is
+func gameSecret(secret []byte, game routing.Game) []byte {
+	if game == routing.DefaultGame {
+		return secret
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("peril game " + string(game)))
+	return mac.Sum(nil)
+}
+
+// announcementMAC proves a game announcement comes from a server. It is
+// derived apart from gameSecret, which must never be sent
+func announcementMAC(secret []byte, game routing.Game) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("peril lobby announces " + string(game)))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/membroker"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+func newLobby(t *testing.T, b *membroker.Broker, id string, cfg LobbyConfig) *Lobby {
+	t.Helper()
+	l, err := NewLobby(dial(t, b, id), cfg, testConfig(t, id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	if _, err := l.Create(routing.DefaultGame); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func gameIDs(games []routing.GameSummary) []string {
+	var ids []string
+	for _, game := range games {
+		ids = append(ids, game.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestLobbyCreate(t *testing.T) {
+	b := newBroker(t)
+	cfg := LobbyConfig{MaxGames: 2, CreateKey: "key"}
+	one := newLobby(t, b, "one", cfg)
+	two := newLobby(t, b, "two", cfg)
+	player := dial(t, b, "player")
+
+	games, err := client.CreateGame(player, "arena", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := gameIDs(games); !slices.Equal(ids, []string{"arena", "default"}) {
+		t.Errorf("games = %v after creating arena", ids)
+	}
+	// whichever server took the request, the other runs the game too
+	waitFor(t, "both servers to run arena", func() bool {
+		_, onOne := one.Game("arena")
+		_, onTwo := two.Game("arena")
+		return onOne && onTwo
+	})
+
+	tests := []struct {
+		name   string
+		game   routing.Game
+		key    string
+		reason string
+	}{
+		{"wrong key", "other", "nope", "wrong create key"},
+		{"existing game", "arena", "key", ErrGameExists.Error()},
+		{"lobby full", "other", "key", ErrLobbyFull.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.CreateGame(player, tt.game, tt.key)
+			if err == nil || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("CreateGame(%s) = %v, want it refused with %q", tt.game, err, tt.reason)
+			}
+		})
+	}
+
+	games, err = client.ListGames(player)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := gameIDs(games); !slices.Equal(ids, []string{"arena", "default"}) {
+		t.Errorf("games = %v, want only the default game and arena", ids)
+	}
+}
+
+func TestLobbyWithoutCreateKey(t *testing.T) {
+	b := newBroker(t)
+	l := newLobby(t, b, "one", LobbyConfig{})
+	player := dial(t, b, "player")
+
+	if _, err := client.CreateGame(player, "arena", ""); err == nil {
+		t.Error("a player created a game on a lobby without a create key")
+	}
+	if _, ok := l.Game("arena"); ok {
+		t.Error("the lobby runs the game it refused")
+	}
+	// the operator may still create games
+	if _, err := l.Create("arena"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Game("arena"); !ok {
+		t.Error("the lobby does not run the game the operator created")
+	}
+}
+
+func TestLobbyIgnoresForgedAnnouncements(t *testing.T) {
+	l := &Lobby{base: Config{Secret: testSecret}, games: map[routing.Game]*Server{}}
+	forged := routing.GameAnnouncement{Game: "arena", MAC: announcementMAC([]byte("another secret"), "arena")}
+	if ack := l.handleAnnouncement(forged); ack != pubsub.NackDiscard {
+		t.Errorf("forged announcement settled with %v, want it discarded", ack)
+	}
+	if _, ok := l.Game("arena"); ok {
+		t.Error("the lobby runs a game from a forged announcement")
+	}
+}
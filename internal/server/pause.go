@@ -0,0 +1,354 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/spectate"
+)
+
+// PauseSchedule is a pause the server starts by itself
+type PauseSchedule struct {
+	At    time.Time     // first start
+	For   time.Duration // how long the game stays paused, 0 until resumed by hand
+	Every time.Duration // repeats the pause this often, 0 pauses once
+}
+
+// ScheduledPause is a PauseSchedule waiting for its next start
+type ScheduledPause struct {
+	ID int
+	PauseSchedule
+}
+
+// ErrNoSchedule is returned when cancelling a pause that is not scheduled
+var ErrNoSchedule = errors.New("no such pause is scheduled")
+
+type schedule struct {
+	ScheduledPause
+	timer *time.Timer
+}
+
+// SetPaused pauses or resumes the game for every player until told
+// otherwise. It ends a timed pause early. Followers forward it to the leader
+func (s *Server) SetPaused(paused bool) error {
+	if !s.Leading() {
+		_, err := s.forward(controlRequest{Action: controlSetPaused, Paused: paused})
+		return err
+	}
+	return s.setPaused(paused)
+}
+
+func (s *Server) setPaused(paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.leading {
+		return ErrNotLeader
+	}
+	return s.publishState(routing.PlayingState{IsPaused: paused})
+}
+
+// PauseFor pauses the game and resumes it once d has passed. Followers
+// forward it to the leader
+func (s *Server) PauseFor(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("a pause must last longer than 0s")
+	}
+	if !s.Leading() {
+		_, err := s.forward(controlRequest{Action: controlPauseFor, For: d})
+		return err
+	}
+	return s.pauseFor(d)
+}
+
+func (s *Server) pauseFor(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("a pause must last longer than 0s")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.leading {
+		return ErrNotLeader
+	}
+	return s.publishState(routing.PlayingState{IsPaused: true, ResumeAt: time.Now().Add(d)})
+}
+
+// publishState sends state to the players and starts the timer of a timed
+// pause. s.mu must be held
+func (s *Server) publishState(state routing.PlayingState) error {
+	if err := pubsub.PublishJSON(s.channel, routing.ExchangePerilDirect, s.game.Key(routing.PauseKey), state, s.opts...); err != nil {
+		return err
+	}
+	s.state = state
+	s.hub.Publish(spectate.Pause(state.IsPaused))
+	// the pause itself was sent, a lost log entry is not worth failing it
+	if err := pubsub.PublishGob(s.channel, routing.ExchangePerilTopic, s.game.Key(routing.GameLogSlug+"."+session.ServerUsername), gamelogic.NewPauseLog(session.ServerUsername, state), s.opts...); err != nil {
+		slog.Error("could not log pause", "err", err)
+	}
+
+	s.stopResumeTimer()
+	if !state.ResumeAt.IsZero() {
+		s.startResumeTimer(state.ResumeAt)
+	}
+	return nil
+}
+
+// startResumeTimer ends the timed pause at resumeAt. s.mu must be held
+func (s *Server) startResumeTimer(resumeAt time.Time) {
+	s.resumeTimer = time.AfterFunc(time.Until(resumeAt), func() {
+		s.endTimedPause(resumeAt)
+	})
+}
+
+// stopResumeTimer s.mu must be held
+func (s *Server) stopResumeTimer() {
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+		s.resumeTimer = nil
+	}
+}
+
+func (s *Server) endTimedPause(resumeAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the pause may have been ended or replaced, or the lead lost, while the
+	// timer fired
+	if s.stopped() || !s.leading || !s.state.IsPaused || !s.state.ResumeAt.Equal(resumeAt) {
+		return
+	}
+	slog.Info("timed pause is over, sending resume message")
+	if err := s.publishState(routing.PlayingState{IsPaused: false}); err != nil {
+		slog.Error("could not publish resume", "err", err)
+	}
+}
+
+// PlayingState is the state the leader last sent to the players. Games
+// start running
+func (s *Server) PlayingState() routing.PlayingState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// Schedule pauses the game at p.At, and every p.Every after that when it
+// repeats. A repeating schedule starting in the past starts at its next
+// occurrence. Followers forward it to the leader, which hands its
+// schedules to every follower so they outlive a failover
+func (s *Server) Schedule(p PauseSchedule) (ScheduledPause, error) {
+	if !s.Leading() {
+		reply, err := s.forward(controlRequest{Action: controlSchedule, Schedule: p})
+		return reply.Scheduled, err
+	}
+	return s.leaderSchedule(p)
+}
+
+func (s *Server) leaderSchedule(p PauseSchedule) (ScheduledPause, error) {
+	if !s.Leading() {
+		return ScheduledPause{}, ErrNotLeader
+	}
+	scheduled, err := s.schedule(p)
+	if err != nil {
+		return ScheduledPause{}, err
+	}
+	s.publishSchedules()
+	return scheduled, nil
+}
+
+// schedule adds p on leaders and followers alike, only the server leading
+// when it starts pauses the game
+func (s *Server) schedule(p PauseSchedule) (ScheduledPause, error) {
+	switch {
+	case p.At.IsZero():
+		return ScheduledPause{}, errors.New("a scheduled pause needs a start time")
+	case p.For < 0 || p.Every < 0:
+		return ScheduledPause{}, errors.New("durations of a scheduled pause must not be negative")
+	case p.Every > 0 && p.For == 0:
+		return ScheduledPause{}, errors.New("a repeating pause needs a duration")
+	case p.Every > 0 && p.For >= p.Every:
+		return ScheduledPause{}, errors.New("a repeating pause must end before it starts again")
+	}
+	now := time.Now()
+	if p.At.Before(now) {
+		if p.Every == 0 {
+			return ScheduledPause{}, errors.New("the start of the pause has already passed")
+		}
+		p.At = nextOccurrence(p.At, p.Every, now)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped() {
+		return ScheduledPause{}, errors.New("the server is closed")
+	}
+	sched := &schedule{ScheduledPause: ScheduledPause{ID: s.nextSchedule, PauseSchedule: p}}
+	s.nextSchedule++
+	s.schedules[sched.ID] = sched
+	sched.timer = time.AfterFunc(time.Until(p.At), func() {
+		s.startScheduledPause(sched.ID)
+	})
+	return sched.ScheduledPause, nil
+}
+
+func (s *Server) startScheduledPause(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sched, ok := s.schedules[id]
+	if !ok || s.stopped() {
+		return
+	}
+	if s.leading {
+		s.pauseOnSchedule(sched)
+	}
+
+	if sched.Every == 0 {
+		delete(s.schedules, id)
+		return
+	}
+	sched.At = nextOccurrence(sched.At, sched.Every, time.Now())
+	sched.timer.Reset(time.Until(sched.At))
+}
+
+// pauseOnSchedule s.mu must be held
+func (s *Server) pauseOnSchedule(sched *schedule) {
+	id := sched.ID
+	state := routing.PlayingState{IsPaused: true}
+	if sched.For > 0 {
+		state.ResumeAt = time.Now().Add(sched.For)
+	}
+	slog.Info("scheduled pause started, sending pause message", "schedule", id, "duration", sched.For)
+	if err := s.publishState(state); err != nil {
+		slog.Error("could not publish scheduled pause", "schedule", id, "err", err)
+	}
+}
+
+// nextOccurrence is the first time after now that is a whole number of
+// every past at
+func nextOccurrence(at time.Time, every time.Duration, now time.Time) time.Time {
+	if at.After(now) {
+		return at
+	}
+	periods := now.Sub(at)/every + 1
+	return at.Add(periods * every)
+}
+
+// currentWindow reports whether now falls in the occurrence of the
+// repeating, timed pause p before p.At, and when that occurrence ends. p.At
+// must be the next occurrence, as it is for scheduled pauses
+func currentWindow(p PauseSchedule, now time.Time) (time.Time, bool) {
+	if p.Every == 0 || p.For == 0 {
+		return time.Time{}, false
+	}
+	start := p.At.Add(-p.Every)
+	end := start.Add(p.For)
+	return end, !now.Before(start) && now.Before(end)
+}
+
+// pauseMissedWindow pauses the running game for the rest of a repeating
+// pause that started while no server led it, e.g. before any server was
+// up. s.mu must be held
+func (s *Server) pauseMissedWindow() {
+	if s.state.IsPaused {
+		return
+	}
+	now := time.Now()
+	for _, sched := range s.schedules {
+		end, ok := currentWindow(sched.PauseSchedule, now)
+		if !ok {
+			continue
+		}
+		slog.Info("scheduled pause started before the lead was taken, sending pause message", "schedule", sched.ID, "until", end)
+		if err := s.publishState(routing.PlayingState{IsPaused: true, ResumeAt: end}); err != nil {
+			slog.Error("could not publish scheduled pause", "schedule", sched.ID, "err", err)
+		}
+		return
+	}
+}
+
+// Schedules lists the pauses waiting to start, the next one first
+func (s *Server) Schedules() []ScheduledPause {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pauses := make([]ScheduledPause, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		pauses = append(pauses, sched.ScheduledPause)
+	}
+	sort.Slice(pauses, func(i, j int) bool {
+		return pauses[i].At.Before(pauses[j].At)
+	})
+	return pauses
+}
+
+// Unschedule cancels a scheduled pause, ErrNoSchedule when there is none
+// with the id. Followers forward it to the leader
+func (s *Server) Unschedule(id int) error {
+	if !s.Leading() {
+		_, err := s.forward(controlRequest{Action: controlUnschedule, ID: id})
+		return err
+	}
+	return s.leaderUnschedule(id)
+}
+
+func (s *Server) leaderUnschedule(id int) error {
+	s.mu.Lock()
+	if !s.leading {
+		s.mu.Unlock()
+		return ErrNotLeader
+	}
+	sched, ok := s.schedules[id]
+	if ok {
+		sched.timer.Stop()
+		delete(s.schedules, id)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrNoSchedule
+	}
+	s.publishSchedules()
+	return nil
+}
+
+// replaceSchedules swaps the scheduled pauses for those of the leader
+func (s *Server) replaceSchedules(pauses []ScheduledPause) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped() {
+		return
+	}
+	for id, sched := range s.schedules {
+		sched.timer.Stop()
+		delete(s.schedules, id)
+	}
+	for _, pause := range pauses {
+		sched := &schedule{ScheduledPause: pause}
+		s.schedules[pause.ID] = sched
+		sched.timer = time.AfterFunc(time.Until(pause.At), func() {
+			s.startScheduledPause(sched.ID)
+		})
+		s.nextSchedule = max(s.nextSchedule, pause.ID+1)
+	}
+}
+
+func (s *Server) stopTimers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopResumeTimer()
+	for id, sched := range s.schedules {
+		sched.timer.Stop()
+		delete(s.schedules, id)
+	}
+}
+
+func (s *Server) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
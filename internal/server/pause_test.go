@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func clock(day, hour, min int) time.Time {
+	return time.Date(2024, 5, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestNextOccurrence(t *testing.T) {
+	tests := []struct {
+		name  string
+		at    time.Time
+		every time.Duration
+		now   time.Time
+		want  time.Time
+	}{
+		{"in the future", clock(10, 18, 0), time.Hour, clock(10, 12, 0), clock(10, 18, 0)},
+		{"just passed", clock(10, 3, 0), 24 * time.Hour, clock(10, 3, 10), clock(11, 3, 0)},
+		{"at now", clock(10, 12, 0), time.Hour, clock(10, 12, 0), clock(10, 13, 0)},
+		{"several periods ago", clock(10, 9, 0), time.Hour, clock(10, 12, 30), clock(10, 13, 0)},
+		{"exactly periods ago", clock(10, 9, 0), time.Hour, clock(10, 12, 0), clock(10, 13, 0)},
+		{"days ago", clock(1, 3, 0), 24 * time.Hour, clock(10, 12, 0), clock(11, 3, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextOccurrence(tt.at, tt.every, tt.now)
+			if !got.Equal(tt.want) {
+				t.Errorf("nextOccurrence(%v, %v, %v) = %v, want %v", tt.at, tt.every, tt.now, got, tt.want)
+			}
+			if !got.After(tt.now) {
+				t.Errorf("next occurrence %v is not after %v", got, tt.now)
+			}
+		})
+	}
+}
+
+func TestCurrentWindow(t *testing.T) {
+	maintenance := PauseSchedule{At: clock(11, 3, 0), For: 30 * time.Minute, Every: 24 * time.Hour}
+	tests := []struct {
+		name   string
+		p      PauseSchedule
+		now    time.Time
+		end    time.Time
+		inside bool
+	}{
+		{name: "started inside the window", p: maintenance, now: clock(10, 3, 10), end: clock(10, 3, 30), inside: true},
+		{name: "at the start", p: maintenance, now: clock(10, 3, 0), end: clock(10, 3, 30), inside: true},
+		{name: "at the end", p: maintenance, now: clock(10, 3, 30)},
+		{name: "after the window", p: maintenance, now: clock(10, 12, 0)},
+		{name: "before the window", p: maintenance, now: clock(10, 2, 59)},
+		{name: "once", p: PauseSchedule{At: clock(10, 18, 0), For: time.Hour}, now: clock(10, 12, 0)},
+		{name: "until resumed", p: PauseSchedule{At: clock(10, 13, 0), Every: time.Hour}, now: clock(10, 12, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, inside := currentWindow(tt.p, tt.now)
+			if inside != tt.inside {
+				t.Fatalf("currentWindow(%+v, %v) inside = %v, want %v", tt.p, tt.now, inside, tt.inside)
+			}
+			if inside && !end.Equal(tt.end) {
+				t.Errorf("window ends at %v, want %v", end, tt.end)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/spectate"
+)
+
+// instanceID tells apart the queues of servers started side by side by multiserver.sh
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "server"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func handlerPresence(roster *gamelogic.Roster, hub *spectate.Hub) func(context.Context, gamelogic.Presence) pubsub.Acktype {
+
+	return func(ctx context.Context, p gamelogic.Presence) pubsub.Acktype {
+		username := p.Player.Username
+		if err := auth.SignedAs(ctx, username); err != nil {
+			slog.Warn("discarding presence", "err", err)
+			return pubsub.NackDiscard
+		}
+		if p.Status == gamelogic.PresenceLeave {
+			if roster.Remove(username) {
+				slog.Info("player left", "username", username)
+				hub.Publish(spectate.Presence(username, p.Status))
+			}
+			return pubsub.Ack
+		}
+		if roster.Update(p) {
+			slog.Info("player joined", "username", username)
+			hub.Publish(spectate.Presence(username, gamelogic.PresenceJoin))
+		}
+		return pubsub.Ack
+	}
+}
+
+// Moves carry a full snapshot of the mover, which keeps the units we know
+// about current between heartbeats
+func handlerMove(roster *gamelogic.Roster, hub *spectate.Hub) func(context.Context, gamelogic.ArmyMove) pubsub.Acktype {
+
+	return func(ctx context.Context, mv gamelogic.ArmyMove) pubsub.Acktype {
+		if err := auth.SignedAs(ctx, mv.Player.Username); err != nil {
+			slog.Warn("discarding move", "err", err)
+			return pubsub.NackDiscard
+		}
+		roster.SeeMove(mv)
+		hub.Publish(spectate.Move(mv))
+		return pubsub.Ack
+	}
+}
+
+func handlerWar(hub *spectate.Hub) func(context.Context, gamelogic.RecognitionOfWar) pubsub.Acktype {
+
+	return func(ctx context.Context, rw gamelogic.RecognitionOfWar) pubsub.Acktype {
+		if err := auth.SignedAs(ctx, rw.Defender.Username); err != nil {
+			slog.Warn("discarding war", "err", err)
+			return pubsub.NackDiscard
+		}
+		hub.Publish(spectate.War(rw))
+		return pubsub.Ack
+	}
+}
+
+// expirePlayers drops players that stopped sending heartbeats until the
+// server is closed. The leader announces their departure on their behalf
+func (s *Server) expirePlayers() {
+	ticker := time.NewTicker(gamelogic.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			for _, username := range s.roster.Expire(now) {
+				slog.Info("player timed out", "username", username)
+				s.hub.Publish(spectate.Presence(username, gamelogic.PresenceLeave))
+				if !s.Leading() {
+					continue
+				}
+				leave := gamelogic.Presence{
+					Player: gamelogic.Player{Username: username, Units: map[int]gamelogic.Unit{}},
+					Status: gamelogic.PresenceLeave,
+					SentAt: now,
+				}
+				if err := pubsub.PublishJSON(s.channel, routing.ExchangePerilTopic, s.game.Key(routing.PresenceKey+"."+username), leave, s.opts...); err != nil {
+					slog.Error("could not announce timeout", "username", username, "err", err)
+				}
+				if err := pubsub.PublishGob(s.channel, routing.ExchangePerilTopic, s.game.Key(routing.GameLogSlug+"."+username), gamelogic.NewLeaveLog(username), s.opts...); err != nil {
+					slog.Error("could not log timeout", "username", username, "err", err)
+				}
+			}
+		}
+	}
+}
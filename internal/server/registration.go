@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// registrar hands out usernames. A name is taken while its player sends
+// heartbeats, and for one presence timeout after it was handed out so the
+// first heartbeat has time to arrive. Only the leader registers, the
+// reservations of a leader that failed are lost with it
+type registrar struct {
+	issuer   *session.Issuer
+	state    func() routing.PlayingState
+	keys     *keyService
+	roster   *gamelogic.Roster
+	mu       sync.Mutex
+	reserved map[string]time.Time
+}
+
+func newRegistrar(issuer *session.Issuer, state func() routing.PlayingState, keys *keyService, roster *gamelogic.Roster) *registrar {
+	return &registrar{
+		issuer:   issuer,
+		state:    state,
+		keys:     keys,
+		roster:   roster,
+		reserved: map[string]time.Time{},
+	}
+}
+
+func (r *registrar) handle(req routing.RegistrationRequest) routing.RegistrationReply {
+	if err := session.ValidateUsername(req.Username); err != nil {
+		return routing.RegistrationReply{Reason: err.Error()}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for username, until := range r.reserved {
+		if now.After(until) {
+			delete(r.reserved, username)
+		}
+	}
+
+	_, online := r.roster.Get(req.Username)
+	_, reserved := r.reserved[req.Username]
+	if online || reserved {
+		return routing.RegistrationReply{Reason: fmt.Sprintf("username %s is already taken", req.Username)}
+	}
+
+	token, claims, err := r.issuer.Issue(req.Username)
+	if err != nil {
+		slog.Error("could not issue session", "username", req.Username, "err", err)
+		return routing.RegistrationReply{Reason: "the server could not create a session, try again"}
+	}
+	keyID, seed, err := r.keys.authority.IssueKey(req.Username)
+	if err != nil {
+		slog.Error("could not issue key", "username", req.Username, "err", err)
+		return routing.RegistrationReply{Reason: "the server could not create a key, try again"}
+	}
+	if err := r.keys.announce(r.keys.authority.Announce(req.Username, keyID, "")); err != nil {
+		slog.Error("could not announce key", "username", req.Username, "err", err)
+	}
+
+	r.reserved[req.Username] = now.Add(gamelogic.PresenceTimeout)
+	slog.Info("registered player", "username", req.Username)
+	return routing.RegistrationReply{
+		Accepted:   true,
+		Token:      token,
+		ExpiresAt:  claims.ExpiresAt,
+		State:      r.state(),
+		KeyID:      keyID,
+		PrivateKey: seed,
+		ServerKey:  r.keys.authority.ServerPublicKey(),
+	}
+}
+
+// serverSession sends a token of the servers with every message. Servers
+// run longer than a token lasts, it is issued again halfway through
+type serverSession struct {
+	issuer *session.Issuer
+
+	mu      sync.Mutex
+	token   string
+	renewAt time.Time
+}
+
+func (s *serverSession) current() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.renewAt) {
+		return s.token, nil
+	}
+	token, _, err := s.issuer.Issue(session.ServerUsername)
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	s.renewAt = time.Now().Add(session.TokenLifetime / 2)
+	return token, nil
+}
+
+func (s *serverSession) Option() pubsub.PublishOption {
+	return func(key string, msg *amqp.Publishing) error {
+		token, err := s.current()
+		if err != nil {
+			return fmt.Errorf("could not renew server session: %v", err)
+		}
+		return pubsub.WithHeader(routing.SessionHeader, token)(key, msg)
+	}
+}
+
+// verifySession only lets through messages carrying a valid session token
+// of the player named at the end of the routing key. Servers may publish
+// for any player
+func verifySession(issuer *session.Issuer) func(amqp.Delivery) error {
+	return func(msg amqp.Delivery) error {
+		claims, err := sessionClaims(issuer, msg)
+		if err != nil {
+			return err
+		}
+		if claims.Username == session.ServerUsername {
+			return nil
+		}
+
+		owner := msg.RoutingKey[strings.LastIndex(msg.RoutingKey, ".")+1:]
+		if claims.Username != owner {
+			return fmt.Errorf("session of %s can not publish as %s", claims.Username, owner)
+		}
+		return nil
+	}
+}
+
+// verifyAnySession lets through messages carrying any valid session token.
+// It is for messages naming someone else in their routing key, like a war
+// the defender announces under the attacker's name
+func verifyAnySession(issuer *session.Issuer) func(amqp.Delivery) error {
+	return func(msg amqp.Delivery) error {
+		_, err := sessionClaims(issuer, msg)
+		return err
+	}
+}
+
+func sessionClaims(issuer *session.Issuer, msg amqp.Delivery) (session.Claims, error) {
+	token, _ := msg.Headers[routing.SessionHeader].(string)
+	if token == "" {
+		return session.Claims{}, errors.New("message has no session token")
+	}
+	return issuer.Verify(token)
+}
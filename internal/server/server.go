@@ -0,0 +1,402 @@
+// Package server runs the Peril game server: it registers players, hands
+// out their signing keys, keeps track of who is playing and writes the
+// game logs to disk. Servers sharing a broker share that work, one of them
+// is elected to lead each game and pause it
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/leader"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logsink"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/pubsub"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/session"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/spectate"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type Config struct {
+	Sink   logsink.Config
+	Secret []byte      // signs session tokens and player keys, must be the same on every server
+	Verify auth.Policy // what to do with messages with a missing or bad signature
+	ID     string      // tells apart the queues of servers sharing a broker, defaults to host and pid
+	// RetiredKeys is the file retired player keys are kept in, so they stay
+	// retired after a restart. Empty keeps them in memory only
+	RetiredKeys string
+	Game        routing.Game
+	// Maintenance are pauses scheduled as soon as the game starts
+	Maintenance []PauseSchedule
+	// LogQueueType is the type of the game log queue the servers share,
+	// classic when empty. The broker refuses to change an existing queue
+	LogQueueType pubsub.QueueType
+	// LeaderRetry is how often a follower tries to take over the lead,
+	// defaults to leader.DefaultRetry
+	LeaderRetry time.Duration
+}
+
+// Server is a running game server
+type Server struct {
+	game    routing.Game
+	created time.Time
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	opts    []pubsub.PublishOption
+	roster  *gamelogic.Roster
+	sink    *logsink.Sink
+	retired *auth.RetiredKeys
+	hub     *spectate.Hub
+	stop    chan struct{}
+	// election decides which of the servers sharing the broker leads
+	election *leader.Election
+	// serveRegistrations answers registrations until stop is closed
+	serveRegistrations func(stop <-chan struct{}) error
+	// serveControl runs the commands of followers until stop is closed
+	serveControl func(stop <-chan struct{}) error
+
+	mu           sync.RWMutex
+	leading      bool
+	serving      chan struct{}        // closed when the leader stops registering players and running commands
+	state        routing.PlayingState // the last state the leader published
+	resumeTimer  *time.Timer          // ends a timed pause
+	schedules    map[int]*schedule
+	nextSchedule int
+}
+
+// Health is what the server knows about its own condition
+type Health struct {
+	BrokerConnected bool
+	PendingLogs     int  // game logs waiting to be written to disk
+	Leader          bool // whether this server leads the game
+}
+
+// ErrNoLogStore is returned by FindLogs when the server keeps no
+// structured game logs
+var ErrNoLogStore = errors.New("the game log store is disabled")
+
+// Game logs are acked only once the batch holding them has been flushed to disk
+func handlerGameLogPassed(sink *logsink.Sink, hub *spectate.Hub) func(routing.GameLog, pubsub.AckFunc) {
+
+	return func(gl routing.GameLog, ack pubsub.AckFunc) {
+		sink.Write(gl, func(err error) {
+			if err != nil {
+				slog.Error("could not write game log", "err", err)
+				ack(pubsub.NackRequeue)
+				return
+			}
+			// only once written, so a redelivered log is not counted or shown twice
+			gamelogic.RecordGameLog(gl)
+			hub.Publish(spectate.Log(logstore.FromGameLog(gl)))
+			ack(pubsub.Ack)
+		})
+	}
+
+}
+
+// Start declares the server's queues on conn and starts serving players
+func Start(conn *amqp.Connection, cfg Config) (*Server, error) {
+	if len(cfg.Secret) == 0 {
+		return nil, errors.New("a session secret is required")
+	}
+	if cfg.ID == "" {
+		cfg.ID = instanceID()
+	}
+	// checked before deriving the game's secret, which would hide a short one
+	if _, err := session.NewIssuer(cfg.Secret); err != nil {
+		return nil, fmt.Errorf("invalid session secret: %v", err)
+	}
+	// a session or key of one game is worthless in the others
+	secret := gameSecret(cfg.Secret, cfg.Game)
+
+	issuer, err := session.NewIssuer(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session secret: %v", err)
+	}
+	serverSession := &serverSession{issuer: issuer}
+	if _, err := serverSession.current(); err != nil {
+		return nil, fmt.Errorf("could not create server session: %v", err)
+	}
+	authority, err := auth.NewAuthority(secret)
+	if err != nil {
+		return nil, fmt.Errorf("could not create server signing key: %v", err)
+	}
+	keyring := newKeyring(authority)
+	var retired *auth.RetiredKeys
+	if cfg.RetiredKeys != "" {
+		if retired, err = auth.OpenRetiredKeys(cfg.RetiredKeys, keyring); err != nil {
+			return nil, err
+		}
+	}
+	serverOptions := []pubsub.PublishOption{
+		serverSession.Option(),
+		authority.Server().Option(),
+	}
+	// players may only publish under their own name
+	verifyPlayer := pubsub.WithSigner(keyring.Identify(cfg.Verify, auth.SignerOwnsKey))
+
+	//Creating new channel
+	mainChannel, err := conn.Channel()
+	if err != nil {
+		closeRetired(retired)
+		return nil, fmt.Errorf("could not create channel: %v", err)
+	}
+
+	// Declare and bind queue to peril_topic
+	_, queue, err := pubsub.DeclareAndBind(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.GameLogSlug),
+		cfg.Game.Key(routing.GameLogSlug+".*"),
+		logQueue(cfg),
+	)
+	if err != nil {
+		mainChannel.Close()
+		closeRetired(retired)
+		return nil, fmt.Errorf("could not declare game log queue: %v", err)
+	}
+	slog.Info("queue declared and bound", "queue", queue.Name)
+
+	sink, err := logsink.New(cfg.Sink)
+	if err != nil {
+		mainChannel.Close()
+		closeRetired(retired)
+		return nil, fmt.Errorf("could not start game log writer: %v", err)
+	}
+	s := &Server{
+		game:    cfg.Game,
+		created: time.Now(),
+		conn:    conn,
+		channel: mainChannel,
+		opts:    serverOptions,
+		roster:  gamelogic.NewRoster(gamelogic.PresenceTimeout),
+		sink:    sink,
+		retired: retired,
+		hub:     spectate.NewHub(),
+		stop:    make(chan struct{}),
+
+		schedules:    map[int]*schedule{},
+		nextSchedule: 1,
+	}
+
+	if err := s.subscribe(conn, cfg, issuer, authority, keyring, verifyPlayer); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	// every server keeps the windows, so the leader of the day pauses
+	for _, window := range cfg.Maintenance {
+		if _, err := s.schedule(window); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("could not schedule maintenance: %v", err)
+		}
+	}
+
+	s.election = leader.Campaign(conn, cfg.Game.Key(routing.LeaderQueue), cfg.LeaderRetry, s.setLeading)
+	go s.expirePlayers()
+	go s.syncSchedules()
+	return s, nil
+}
+
+func (s *Server) subscribe(conn *amqp.Connection, cfg Config, issuer *session.Issuer, authority *auth.Authority, keyring *auth.Keyring, verifyPlayer pubsub.SubscribeOption) error {
+	// allow two batches in flight so the next one fills while the previous is flushed
+	err := pubsub.SubscribeGobDeferred(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.GameLogSlug),
+		cfg.Game.Key(routing.GameLogSlug+".*"),
+		logQueue(cfg),
+		2*cfg.Sink.BatchSize,
+		handlerGameLogPassed(s.sink, s.hub),
+		pubsub.WithVerifier(verifySession(issuer)),
+		verifyPlayer,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to game logs: %v", err)
+	}
+
+	// every server keeps its own view of who is playing
+	err = pubsub.SubscribeJSONContext(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.PresenceKey+"."+cfg.ID),
+		cfg.Game.Key(routing.PresenceKey+".*"),
+		pubsub.QueueTransient,
+		handlerPresence(s.roster, s.hub),
+		pubsub.WithVerifier(verifySession(issuer)),
+		verifyPlayer,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to presence: %v", err)
+	}
+
+	err = pubsub.SubscribeJSONContext(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.ArmyMovesPrefix+"."+cfg.ID),
+		cfg.Game.Key(routing.ArmyMovesPrefix+".*"),
+		pubsub.QueueTransient,
+		handlerMove(s.roster, s.hub),
+		pubsub.WithVerifier(verifySession(issuer)),
+		verifyPlayer,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to army moves: %v", err)
+	}
+
+	// a queue of our own, the players share the durable war queue
+	err = pubsub.SubscribeJSONContext(
+		conn,
+		routing.ExchangePerilTopic,
+		cfg.Game.Key(routing.WarRecognitionsPrefix+"."+cfg.ID),
+		cfg.Game.Key(routing.WarRecognitionsPrefix+".#"),
+		pubsub.QueueTransient,
+		handlerWar(s.hub),
+		// handlerWar checks the war is signed by its defender
+		pubsub.WithVerifier(verifyAnySession(issuer)),
+		pubsub.WithSigner(keyring.Identify(cfg.Verify, auth.AnySigner)),
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to war events: %v", err)
+	}
+
+	// followers keep up with the pauses of the leader
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		cfg.Game.Key(routing.PauseKey+"."+cfg.ID),
+		cfg.Game.Key(routing.PauseKey),
+		pubsub.QueueTransient,
+		handlerPlayingState(s),
+		pubsub.WithVerifier(verifySession(issuer)),
+		pubsub.WithVerifier(keyring.Verifier(cfg.Verify, auth.SignedBy(session.ServerUsername))),
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to pause: %v", err)
+	}
+
+	// and keep the pauses it scheduled, so they outlive a failover
+	err = pubsub.SubscribeJSON(
+		conn,
+		routing.ExchangePerilDirect,
+		cfg.Game.Key(routing.SchedulesKey+"."+cfg.ID),
+		cfg.Game.Key(routing.SchedulesKey),
+		pubsub.QueueTransient,
+		handlerSchedules(s),
+		pubsub.WithVerifier(verifySession(issuer)),
+		pubsub.WithVerifier(keyring.Verifier(cfg.Verify, auth.SignedBy(session.ServerUsername))),
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to scheduled pauses: %v", err)
+	}
+
+	keys := &keyService{
+		game:      cfg.Game,
+		issuer:    issuer,
+		authority: authority,
+		keyring:   keyring,
+		channel:   s.channel,
+		opts:      s.opts,
+	}
+	if err := serveKeys(conn, keys, cfg.ID); err != nil {
+		return fmt.Errorf("could not serve signing keys: %v", err)
+	}
+
+	// started by the leader, whose reservations then hold for every server
+	registrar := newRegistrar(issuer, s.PlayingState, keys, s.roster)
+	s.serveRegistrations = func(stop <-chan struct{}) error {
+		return pubsub.ServeJSON(
+			conn,
+			routing.ExchangePerilDirect,
+			cfg.Game.Key(routing.RegisterKey),
+			cfg.Game.Key(routing.RegisterKey),
+			pubsub.QueueDurable,
+			registrar.handle,
+			pubsub.WithStop(stop),
+		)
+	}
+	// only other servers may run commands on the leader
+	s.serveControl = func(stop <-chan struct{}) error {
+		return pubsub.ServeJSON(
+			conn,
+			routing.ExchangePerilDirect,
+			cfg.Game.Key(routing.ControlKey),
+			cfg.Game.Key(routing.ControlKey),
+			pubsub.QueueDurable,
+			s.handleControl,
+			pubsub.WithVerifier(verifySession(issuer)),
+			pubsub.WithVerifier(keyring.Verifier(cfg.Verify, auth.SignedBy(session.ServerUsername))),
+			pubsub.WithStop(stop),
+		)
+	}
+	return nil
+}
+
+func closeRetired(retired *auth.RetiredKeys) {
+	if retired == nil {
+		return
+	}
+	if err := retired.Close(); err != nil {
+		slog.Error("could not close retired keys", "err", err)
+	}
+}
+
+func logQueue(cfg Config) pubsub.QueueOptions {
+	queue := pubsub.QueueDurable
+	queue.Type = cfg.LogQueueType
+	return queue
+}
+
+// FindLogs queries the structured game logs written so far
+func (s *Server) FindLogs(q logstore.Query) ([]logstore.Record, error) {
+	path := s.sink.StorePath()
+	if path == "" {
+		return nil, ErrNoLogStore
+	}
+	return logstore.Find(path, q)
+}
+
+// Spectators is where the server publishes what happens in the game for
+// the web dashboard
+func (s *Server) Spectators() *spectate.Hub {
+	return s.hub
+}
+
+func (s *Server) Health() Health {
+	return Health{
+		BrokerConnected: !s.conn.IsClosed(),
+		PendingLogs:     s.sink.Pending(),
+		Leader:          s.Leading(),
+	}
+}
+
+// Game is the game this server runs
+func (s *Server) Game() routing.Game {
+	return s.game
+}
+
+// Players returns the players this server knows to be online
+func (s *Server) Players() []gamelogic.PlayerInfo {
+	return s.roster.Players()
+}
+
+// Close hands over the lead, stops expiring players and scheduled pauses
+// and flushes the pending game logs. The subscriptions end with the
+// connection
+func (s *Server) Close() error {
+	close(s.stop)
+	if s.election != nil {
+		s.election.Close()
+	}
+	s.stopTimers()
+	err := s.sink.Close()
+	closeRetired(s.retired)
+	s.channel.Close()
+	return err
+}
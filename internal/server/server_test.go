@@ -0,0 +1,75 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/auth"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logsink"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/membroker"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var testSecret = []byte("test secret shared by the servers")
+
+// testRetry is how often the test servers try to take over the lead
+const testRetry = 50 * time.Millisecond
+
+// newBroker sets up the exchanges Peril expects an operator to have
+// declared. It is closed once the test and its other cleanups are done
+func newBroker(t *testing.T) *membroker.Broker {
+	t.Helper()
+	b := membroker.New()
+	t.Cleanup(b.Close)
+	exchanges := map[string]string{
+		routing.ExchangePerilDirect: membroker.Direct,
+		routing.ExchangePerilTopic:  membroker.Topic,
+		routing.ExchangeDLX:         membroker.Fanout,
+	}
+	for name, kind := range exchanges {
+		if err := b.DeclareExchange(name, kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func dial(t *testing.T, b *membroker.Broker, name string) *amqp.Connection {
+	t.Helper()
+	conn, err := b.Dial(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// testConfig is the config of server id, which writes its game logs below
+// a directory of its own
+func testConfig(t *testing.T, id string) Config {
+	t.Helper()
+	sink := logsink.DefaultConfig()
+	sink.Dir = t.TempDir()
+	sink.FlushInterval = 10 * time.Millisecond
+	sink.Fsync = false
+	return Config{
+		Sink:        sink,
+		Secret:      testSecret,
+		Verify:      auth.PolicyReject,
+		ID:          id,
+		LeaderRetry: testRetry,
+	}
+}
+
+// waitFor fails the test unless done reports true within a few seconds
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
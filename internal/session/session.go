@@ -0,0 +1,144 @@
+// Package session issues and checks the tokens players get when they
+// register with the server.
+//
+// Tokens are signed with a secret shared by all servers instead of being
+// stored, so any server instance, including one restarted since, can check
+// a token another instance issued. Tokens expire after TokenLifetime
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxUsernameLength = 32
+
+// ServerUsername is reserved for servers, which publish on behalf of players
+const ServerUsername = "server"
+
+// TokenLifetime is how long a token is valid. Players renew theirs by
+// rotating their signing key
+const TokenLifetime = 12 * time.Hour
+
+var ErrInvalidToken = errors.New("invalid session token")
+var ErrExpiredToken = errors.New("session token expired")
+
+// Claims is what a token says about its holder
+type Claims struct {
+	Username  string
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type Issuer struct {
+	secret []byte
+}
+
+func NewIssuer(secret []byte) (*Issuer, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("session secret must be at least 16 bytes")
+	}
+	return &Issuer{secret: secret}, nil
+}
+
+// RandomSecret creates a secret for a server running on its own, e.g. in
+// a scenario. Tokens signed with it are only accepted by that server
+func RandomSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Issue creates a token for username valid for TokenLifetime
+func (i *Issuer) Issue(username string) (string, Claims, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", Claims{}, fmt.Errorf("could not create session id: %v", err)
+	}
+	now := time.Now()
+	claims := Claims{
+		Username:  username,
+		ID:        hex.EncodeToString(id),
+		IssuedAt:  time.Unix(now.Unix(), 0),
+		ExpiresAt: time.Unix(now.Add(TokenLifetime).Unix(), 0),
+	}
+	payload := strings.Join([]string{
+		claims.Username,
+		claims.ID,
+		strconv.FormatInt(claims.IssuedAt.Unix(), 10),
+		strconv.FormatInt(claims.ExpiresAt.Unix(), 10),
+	}, "|")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + i.sign(encoded), claims, nil
+}
+
+func (i *Issuer) Verify(token string) (Claims, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return Claims{}, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(i.sign(encoded))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 4 {
+		return Claims{}, ErrInvalidToken
+	}
+	issuedAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	claims := Claims{Username: parts[0], ID: parts[1], IssuedAt: time.Unix(issuedAt, 0), ExpiresAt: time.Unix(expiresAt, 0)}
+	if !time.Now().Before(claims.ExpiresAt) {
+		return Claims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (i *Issuer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateUsername rejects names that can not be used in routing keys and
+// queue names, where "." separates words and "*" and "#" are wildcards
+func ValidateUsername(username string) error {
+	if username == "" {
+		return errors.New("username can not be empty")
+	}
+	if len(username) > maxUsernameLength {
+		return fmt.Errorf("username can be at most %d characters long", maxUsernameLength)
+	}
+	for _, r := range username {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		isDigit := r >= '0' && r <= '9'
+		if !isLetter && !isDigit && r != '_' && r != '-' {
+			return fmt.Errorf("username can only contain letters, digits, \"_\" and \"-\", not %q", r)
+		}
+	}
+	if strings.EqualFold(username, ServerUsername) {
+		return fmt.Errorf("username %s is reserved", username)
+	}
+	return nil
+}
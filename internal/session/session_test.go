@@ -0,0 +1,132 @@
+package session
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newIssuer(t *testing.T, secret string) *Issuer {
+	t.Helper()
+	issuer, err := NewIssuer([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+// forge signs payload like Issue does, so tests can build tokens Issue
+// would never hand out
+func forge(issuer *Issuer, payload string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + issuer.sign(encoded)
+}
+
+func TestNewIssuer(t *testing.T) {
+	if _, err := NewIssuer([]byte("too short")); err == nil {
+		t.Error("NewIssuer accepted a 9 byte secret")
+	}
+	if _, err := NewIssuer([]byte("0123456789abcdef")); err != nil {
+		t.Errorf("NewIssuer rejected a 16 byte secret: %v", err)
+	}
+}
+
+func TestIssueVerify(t *testing.T) {
+	issuer := newIssuer(t, "a secret shared by all servers")
+	token, issued, err := issuer.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := issuer.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims != issued {
+		t.Errorf("Verify = %+v, want the issued %+v", claims, issued)
+	}
+	if claims.Username != "alice" || claims.ExpiresAt.Sub(claims.IssuedAt) != TokenLifetime {
+		t.Errorf("claims %+v are not alice's for %v", claims, TokenLifetime)
+	}
+
+	// another server with the same secret accepts it too
+	if _, err := newIssuer(t, "a secret shared by all servers").Verify(token); err != nil {
+		t.Errorf("issuer with the same secret rejected the token: %v", err)
+	}
+
+	other, _, err := issuer.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Error("two tokens of the same player are equal")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	issuer := newIssuer(t, "a secret shared by all servers")
+	token, _, err := issuer.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, signature, _ := strings.Cut(token, ".")
+	now := time.Now()
+	future := strconv.FormatInt(now.Add(time.Hour).Unix(), 10)
+	past := strconv.FormatInt(now.Add(-time.Second).Unix(), 10)
+	payload, _ := base64.RawURLEncoding.DecodeString(encoded)
+	renamed := base64.RawURLEncoding.EncodeToString([]byte("bob" + strings.TrimPrefix(string(payload), "alice")))
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"empty", "", ErrInvalidToken},
+		{"no signature", encoded, ErrInvalidToken},
+		{"wrong signature", encoded + "." + strings.Repeat("A", len(signature)), ErrInvalidToken},
+		{"other secret", forge(newIssuer(t, "another secret of other servers"), "alice|id|0|"+future), ErrInvalidToken},
+		{"renamed", renamed + "." + signature, ErrInvalidToken},
+		{"missing field", forge(issuer, "alice|id|0"), ErrInvalidToken},
+		{"bad issue time", forge(issuer, "alice|id|soon|"+future), ErrInvalidToken},
+		{"bad expiry", forge(issuer, "alice|id|0|never"), ErrInvalidToken},
+		{"not base64", "!!!." + issuer.sign("!!!"), ErrInvalidToken},
+		{"expired", forge(issuer, "alice|id|0|"+past), ErrExpiredToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := issuer.Verify(tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		ok       bool
+	}{
+		{"alice", true},
+		{"Alice_2-b", true},
+		{strings.Repeat("a", maxUsernameLength), true},
+		{strings.Repeat("a", maxUsernameLength+1), false},
+		{"", false},
+		{"alice.bob", false},
+		{"alice*", false},
+		{"al#ce", false},
+		{"alice bob", false},
+		{"élise", false},
+		{"server", false},
+		{"Server", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			err := ValidateUsername(tt.username)
+			if (err == nil) != tt.ok {
+				t.Errorf("ValidateUsername(%q) = %v, want ok %v", tt.username, err, tt.ok)
+			}
+		})
+	}
+}
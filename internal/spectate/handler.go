@@ -0,0 +1,156 @@
+package spectate
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+//go:embed index.html
+var indexPage []byte
+
+// the map is resent this often even when nothing happened, which picks up
+// units lost in wars once the players' heartbeats arrive
+const mapInterval = gamelogic.HeartbeatInterval
+
+type MapData struct {
+	Locations []string     `json:"locations"`
+	Players   []PlayerView `json:"players"`
+}
+
+type PlayerView struct {
+	Username string         `json:"username"`
+	Power    int            `json:"power"`
+	Units    map[string]int `json:"units"` // by location
+}
+
+// Game is what the dashboard shows of a game
+type Game interface {
+	Spectators() *Hub
+	Players() []gamelogic.PlayerInfo // who is in the game, for the map
+}
+
+// Games finds a running game, e.g. in the lobby
+type Games func(game routing.Game) (Game, bool)
+
+// Handler serves the dashboard page and its event stream for the games
+// found by games. / shows the default game, /games/<game>/ another game
+func Handler(games Games) http.Handler {
+	mux := http.NewServeMux()
+	for _, prefix := range []string{"", "/games/{game}"} {
+		mux.HandleFunc("GET "+prefix+"/{$}", func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := findGame(w, r, games); !ok {
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(indexPage)
+		})
+		mux.HandleFunc("GET "+prefix+"/events", func(w http.ResponseWriter, r *http.Request) {
+			if game, ok := findGame(w, r, games); ok {
+				stream(w, r, game.Spectators(), game.Players)
+			}
+		})
+	}
+	// the page loads its events relative to its own path
+	mux.HandleFunc("GET /games/{game}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+	})
+	return mux
+}
+
+// findGame looks up the game the path names, the default game when it
+// names none, and answers the request itself when there is no such game
+func findGame(w http.ResponseWriter, r *http.Request, games Games) (Game, bool) {
+	id, err := routing.ParseGame(r.PathValue("game"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	game, ok := games(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no such game %s", id), http.StatusNotFound)
+		return nil, false
+	}
+	return game, true
+}
+
+func stream(w http.ResponseWriter, r *http.Request, hub *Hub, players func() []gamelogic.PlayerInfo) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	events, paused, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sendMap := func() error {
+		return send(w, newEvent(KindMap, snapshot(players())))
+	}
+	if err := send(w, Pause(paused)); err != nil {
+		return
+	}
+	if err := sendMap(); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(mapInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			err = sendMap()
+		case e := <-events:
+			err = send(w, e)
+			if err == nil && (e.Kind == KindMove || e.Kind == KindPresence) {
+				err = sendMap()
+			}
+		}
+		if err != nil {
+			slog.Debug("spectator left", "err", err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func send(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not encode %s event: %v", e.Kind, err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, data)
+	return err
+}
+
+func snapshot(players []gamelogic.PlayerInfo) MapData {
+	m := MapData{Locations: []string{}, Players: []PlayerView{}}
+	for _, location := range gamelogic.Locations() {
+		m.Locations = append(m.Locations, string(location))
+	}
+	for _, info := range players {
+		view := PlayerView{
+			Username: info.Player.Username,
+			Power:    gamelogic.PowerLevel(info.Player),
+			Units:    map[string]int{},
+		}
+		for _, unit := range info.Player.Units {
+			view.Units[string(unit.Location)]++
+		}
+		m.Players = append(m.Players, view)
+	}
+	return m
+}
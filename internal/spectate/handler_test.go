@@ -0,0 +1,102 @@
+package spectate
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/routing"
+)
+
+type fakeGame struct {
+	hub     *Hub
+	players []gamelogic.PlayerInfo
+}
+
+func (g *fakeGame) Spectators() *Hub                { return g.hub }
+func (g *fakeGame) Players() []gamelogic.PlayerInfo { return g.players }
+
+func newHandler(games map[routing.Game]*fakeGame) http.Handler {
+	return Handler(func(id routing.Game) (Game, bool) {
+		game, ok := games[id]
+		if !ok {
+			return nil, false
+		}
+		return game, true
+	})
+}
+
+func TestHandlerRoutesByGame(t *testing.T) {
+	handler := newHandler(map[routing.Game]*fakeGame{
+		routing.DefaultGame: {hub: NewHub()},
+		"second":            {hub: NewHub()},
+	})
+	tests := []struct {
+		name     string
+		target   string
+		status   int
+		location string
+	}{
+		{name: "default game", target: "/", status: http.StatusOK},
+		{name: "default game by name", target: "/games/default/", status: http.StatusOK},
+		{name: "named game", target: "/games/second/", status: http.StatusOK},
+		{name: "named game without a slash", target: "/games/second", status: http.StatusMovedPermanently, location: "/games/second/"},
+		{name: "no such game", target: "/games/third/", status: http.StatusNotFound},
+		{name: "no such game events", target: "/games/third/events", status: http.StatusNotFound},
+		{name: "invalid game", target: "/games/a.b/", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("Location = %q, want %q", location, tt.location)
+			}
+			if tt.status == http.StatusOK && !strings.Contains(w.Body.String(), `new EventSource("events")`) {
+				t.Error("the page does not load its events relative to its path")
+			}
+		})
+	}
+}
+
+func TestEventsStreamTheGame(t *testing.T) {
+	second := &fakeGame{hub: NewHub(), players: []gamelogic.PlayerInfo{{Player: gamelogic.Player{Username: "alice"}}}}
+	server := httptest.NewServer(newHandler(map[routing.Game]*fakeGame{
+		routing.DefaultGame: {hub: NewHub()},
+		"second":            second,
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/games/second/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the stream opens with the pause state and the map of the game
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, `"locations"`) {
+			continue
+		}
+		if !strings.Contains(line, `"alice"`) {
+			t.Fatalf("map %s does not show the players of the game", line)
+		}
+		return
+	}
+	t.Fatalf("the stream ended without a map: %v", scanner.Err())
+}
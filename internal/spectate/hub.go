@@ -0,0 +1,122 @@
+// Package spectate lets people watch a game in the browser. The server
+// publishes what it sees to a Hub, which streams it to every open page as
+// Server-Sent Events
+package spectate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logstore"
+)
+
+// Kinds of events, also the SSE event names
+const (
+	KindMap      = "map"
+	KindMove     = "move"
+	KindWar      = "war"
+	KindLog      = "log"
+	KindPause    = "pause"
+	KindPresence = "presence"
+)
+
+// spectators further behind than this miss events instead of slowing
+// down the server
+const subscriberBuffer = 64
+
+type Event struct {
+	Kind string    `json:"-"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+type MoveData struct {
+	Player   string   `json:"player"`
+	Location string   `json:"location"`
+	Ranks    []string `json:"ranks"`
+}
+
+type WarData struct {
+	Attacker string `json:"attacker"`
+	Defender string `json:"defender"`
+	Location string `json:"location,omitempty"`
+}
+
+type PauseData struct {
+	Paused bool `json:"paused"`
+}
+
+type PresenceData struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+func Move(mv gamelogic.ArmyMove) Event {
+	ranks := make([]string, 0, len(mv.Units))
+	for _, unit := range mv.Units {
+		ranks = append(ranks, string(unit.Rank))
+	}
+	return newEvent(KindMove, MoveData{Player: mv.Player.Username, Location: string(mv.ToLocation), Ranks: ranks})
+}
+
+func War(rw gamelogic.RecognitionOfWar) Event {
+	location, _, _ := rw.Front()
+	return newEvent(KindWar, WarData{Attacker: rw.Attacker.Username, Defender: rw.Defender.Username, Location: string(location)})
+}
+
+func Log(r logstore.Record) Event {
+	return newEvent(KindLog, r)
+}
+
+func Pause(paused bool) Event {
+	return newEvent(KindPause, PauseData{Paused: paused})
+}
+
+func Presence(username string, status gamelogic.PresenceStatus) Event {
+	return newEvent(KindPresence, PresenceData{Username: username, Status: string(status)})
+}
+
+func newEvent(kind string, data any) Event {
+	return Event{Kind: kind, Time: time.Now(), Data: data}
+}
+
+// Hub hands every published event to all current subscribers
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	paused      bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[chan Event]struct{}{}}
+}
+
+// Publish never blocks, a subscriber with a full buffer misses e
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if pause, ok := e.Data.(PauseData); ok {
+		h.paused = pause.Paused
+	}
+	for events := range h.subscribers {
+		select {
+		case events <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the events published from now on, whether the game is
+// paused right now and a function ending the subscription
+func (h *Hub) Subscribe() (<-chan Event, bool, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := make(chan Event, subscriberBuffer)
+	h.subscribers[events] = struct{}{}
+	return events, h.paused, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers, events)
+	}
+}
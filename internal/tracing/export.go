@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// WriterExporter writes spans as JSON Lines
+type WriterExporter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{encoder: json.NewEncoder(w)}
+}
+
+func (e *WriterExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.encoder.Encode(span); err != nil {
+		slog.Warn("could not export span", "err", err)
+	}
+}
+
+// Setup exports the spans of service to dest: stdout, stderr or a file
+// spans are appended to. An empty dest leaves tracing off. The returned
+// function stops tracing and closes the file
+func Setup(dest, service string) (func(), error) {
+	var w io.Writer
+	closeFile := func() {}
+	switch dest {
+	case "":
+		return func() {}, nil
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open trace file: %v", err)
+		}
+		w = f
+		closeFile = func() { f.Close() }
+	}
+	SetExporter(NewWriterExporter(w), service)
+	return func() {
+		SetExporter(nil, "")
+		closeFile()
+	}, nil
+}
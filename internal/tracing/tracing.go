@@ -0,0 +1,206 @@
+// Package tracing follows a message from the publish that caused it to
+// every handler and publish it leads to. Trace context travels in W3C
+// traceparent headers and finished spans go to an exporter, no spans are
+// recorded until one is set
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header carries the trace context of a message
+const Header = "traceparent"
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// SpanContext identifies a span across processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats sc as a sampled W3C traceparent header
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+// ParseTraceparent reads a W3C traceparent header
+func ParseTraceparent(header string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, errors.New("malformed traceparent")
+	}
+	var sc SpanContext
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, fmt.Errorf("malformed trace id: %v", err)
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, fmt.Errorf("malformed span id: %v", err)
+	}
+	if !sc.Valid() {
+		return SpanContext{}, errors.New("trace and span id must not be zero")
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != 2*len(dst) {
+		return fmt.Errorf("expected %d hex digits", 2*len(dst))
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// SpanData is a finished span as exporters see it
+type SpanData struct {
+	Name       string            `json:"name"`
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_span_id,omitempty"`
+	Service    string            `json:"service,omitempty"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Exporter receives every span once it ends
+type Exporter interface {
+	Export(SpanData)
+}
+
+var (
+	mu       sync.RWMutex
+	exporter Exporter
+	service  string
+)
+
+// SetExporter starts recording spans of service, a nil exporter stops it
+func SetExporter(e Exporter, serviceName string) {
+	mu.Lock()
+	defer mu.Unlock()
+	exporter = e
+	service = serviceName
+}
+
+// Enabled reports whether spans are recorded
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return exporter != nil
+}
+
+// Span is an operation being traced. A nil *Span is a no-op, which is what
+// Start returns while tracing is disabled
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ctx   SpanContext
+	ended bool
+}
+
+type spanKey struct{}
+
+// Start begins a span that is a child of the span in ctx, or of parent
+// when ctx holds none. A span with neither starts a new trace
+func Start(ctx context.Context, name string, parent SpanContext) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+	if current := FromContext(ctx); current != nil {
+		parent = current.Context()
+	}
+
+	span := &Span{data: SpanData{Name: name, Start: time.Now(), Attributes: map[string]string{}}}
+	span.ctx.SpanID = SpanID(randomBytes(8))
+	if parent.Valid() {
+		span.ctx.TraceID = parent.TraceID
+		span.data.ParentID = parent.SpanID.String()
+	} else {
+		span.ctx.TraceID = TraceID(randomBytes(16))
+	}
+	span.data.TraceID = span.ctx.TraceID.String()
+	span.data.SpanID = span.ctx.SpanID.String()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span started in ctx, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// Fail marks the span as failed with err, nil errors are ignored
+func (s *Span) Fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and exports it. Later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	mu.RLock()
+	e := exporter
+	data.Service = service
+	mu.RUnlock()
+	if e != nil {
+		e.Export(data)
+	}
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	// crypto/rand does not fail on supported platforms
+	rand.Read(b)
+	return b
+}
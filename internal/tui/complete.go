@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// complete extends the word being typed as far as all candidates agree and
+// lists the candidates when there are several
+func (a *App) complete() {
+	line := string(a.input)
+	words := strings.Fields(line)
+	if len(words) == 0 || strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+	last := len(words) - 1
+	word := words[last]
+
+	matches := []string{}
+	for _, candidate := range a.candidates(words[:last]) {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		a.hint = "no completions"
+		return
+	case 1:
+		words[last] = matches[0] + " "
+		a.hint = ""
+	default:
+		words[last] = commonPrefix(matches)
+		a.hint = strings.Join(matches, "  ")
+	}
+	a.input = []rune(strings.Join(words, " "))
+}
+
+// candidates returns what may follow the words before the one being typed
+func (a *App) candidates(before []string) []string {
+	if len(before) == 0 {
+		return client.Commands
+	}
+
+	locations := []string{}
+	for _, location := range gamelogic.Locations() {
+		locations = append(locations, string(location))
+	}
+
+	switch before[0] {
+	case "spawn":
+		switch len(before) {
+		case 1:
+			return locations
+		case 2:
+			ranks := []string{}
+			for _, rank := range gamelogic.Ranks() {
+				ranks = append(ranks, string(rank))
+			}
+			return ranks
+		}
+	case "move":
+		if len(before) == 1 {
+			return locations
+		}
+		typed := map[string]bool{}
+		for _, word := range before[2:] {
+			typed[word] = true
+		}
+		ids := []string{}
+		for _, unit := range a.client.State().Snapshot().Units {
+			if id := strconv.Itoa(unit.ID); !typed[id] {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+)
+
+const (
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlH     = 8
+	ctrlU     = 21
+	escape    = 27
+	backspace = 127
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h"
+	leaveAltScreen = "\x1b[?1049l"
+	home           = "\x1b[H"
+	inverse        = "\x1b[7m"
+	dim            = "\x1b[2m"
+	reset          = "\x1b[0m"
+)
+
+const prompt = "> "
+
+// draw repaints the whole screen: a title, the map next to the player's
+// units, the event feed, a hint line and the command line
+func (a *App) draw() {
+	if a.rows < 8 || a.cols < 20 {
+		io.WriteString(a.screen, home+"\x1b[2Jterminal too small")
+		return
+	}
+
+	save := a.client.State().Snapshot()
+	title := " Peril - " + save.Username
+	if resumeAt := a.client.State().ResumeAt(); save.Paused && !resumeAt.IsZero() {
+		title += fmt.Sprintf("  [PAUSED %v]", max(time.Until(resumeAt).Round(time.Second), 0))
+	} else if save.Paused {
+		title += "  [PAUSED]"
+	}
+	if a.busy {
+		title += "  [running...]"
+	}
+
+	lines := []string{inverse + fit(title, a.cols) + reset}
+
+	panel := a.panel(save)
+	lines = append(lines, panel...)
+	lines = append(lines, inverse+fit(" Events", a.cols)+reset)
+
+	feedHeight := a.rows - len(lines) - 2
+	feed := a.feed
+	if len(feed) > feedHeight {
+		feed = feed[len(feed)-feedHeight:]
+	}
+	for i := 0; i < feedHeight; i++ {
+		line := ""
+		if i < len(feed) {
+			line = feed[i]
+		}
+		lines = append(lines, fit(line, a.cols))
+	}
+
+	lines = append(lines, dim+fit(a.hint, a.cols)+reset)
+	input := prompt + string(a.input)
+	// keep the end of long input visible
+	if runes := []rune(input); len(runes) >= a.cols {
+		input = string(runes[len(runes)-a.cols+1:])
+	}
+	lines = append(lines, fit(input, a.cols))
+
+	var frame strings.Builder
+	frame.WriteString(home)
+	frame.WriteString(strings.Join(lines, "\r\n"))
+	fmt.Fprintf(&frame, "\x1b[%d;%dH", a.rows, len([]rune(input))+1)
+	io.WriteString(a.screen, frame.String())
+}
+
+// panel puts the map and the player's units side by side
+func (a *App) panel(save gamelogic.SavedGame) []string {
+	locations := gamelogic.Locations()
+	height := len(locations) + 1
+	mapWidth := a.cols * 3 / 5
+	unitsWidth := a.cols - mapWidth - 1
+
+	mine := map[gamelogic.Location][]gamelogic.Unit{}
+	for _, unit := range save.Units {
+		mine[unit.Location] = append(mine[unit.Location], unit)
+	}
+	theirs := map[gamelogic.Location][]string{}
+	for _, info := range a.client.Players() {
+		count := map[gamelogic.Location]int{}
+		for _, unit := range info.Player.Units {
+			count[unit.Location]++
+		}
+		for _, location := range locations {
+			if count[location] > 0 {
+				theirs[location] = append(theirs[location], fmt.Sprintf("%s %d", info.Player.Username, count[location]))
+			}
+		}
+	}
+
+	mapLines := []string{"Map"}
+	for _, location := range locations {
+		line := fmt.Sprintf("%-11s", location)
+		if units := mine[location]; len(units) > 0 {
+			line += fmt.Sprintf("you %d (power %d)  ", len(units), power(units))
+		}
+		line += strings.Join(theirs[location], "  ")
+		mapLines = append(mapLines, line)
+	}
+
+	unitLines := []string{fmt.Sprintf("Your units (%d)", len(save.Units))}
+	for i, unit := range save.Units {
+		if i == height-2 && len(save.Units) > height-1 {
+			unitLines = append(unitLines, fmt.Sprintf("... %d more", len(save.Units)-i))
+			break
+		}
+		unitLines = append(unitLines, fmt.Sprintf("#%-3d %-9s %s", unit.ID, unit.Rank, unit.Location))
+	}
+
+	lines := make([]string, height)
+	for i := range lines {
+		left, right := "", ""
+		if i < len(mapLines) {
+			left = mapLines[i]
+		}
+		if i < len(unitLines) {
+			right = unitLines[i]
+		}
+		lines[i] = fit(left, mapWidth) + "|" + fit(right, unitsWidth)
+	}
+	return lines
+}
+
+func power(units []gamelogic.Unit) int {
+	player := gamelogic.Player{Units: map[int]gamelogic.Unit{}}
+	for _, unit := range units {
+		player.Units[unit.ID] = unit
+	}
+	return gamelogic.PowerLevel(player)
+}
+
+// fit cuts or pads s to exactly width characters
+func fit(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// Feed is the renderer of the terminal UI. It turns events into short lines
+// for the event feed, buffering them until Run shows them
+type Feed struct {
+	lines chan string
+}
+
+func NewFeed() *Feed {
+	return &Feed{lines: make(chan string, feedSize)}
+}
+
+func (f *Feed) Render(e gamelogic.Event) {
+	for _, line := range describe(e) {
+		select {
+		case f.lines <- line:
+		default:
+			// the screen is not keeping up, handlers must not wait for it
+		}
+	}
+}
+
+func describe(e gamelogic.Event) []string {
+	switch e := e.(type) {
+	case gamelogic.PauseChanged:
+		if e.Paused && !e.ResumeAt.IsZero() {
+			return []string{"The game was paused, it resumes " + gamelogic.Remaining(e.ResumeAt)}
+		}
+		if e.Paused {
+			return []string{"The game was paused"}
+		}
+		return []string{"The game was resumed"}
+
+	case gamelogic.MoveDetected:
+		move := fmt.Sprintf("%s moved %d unit(s) to %s", e.Move.Player.Username, len(e.Move.Units), e.Move.ToLocation)
+		switch e.Outcome {
+		case gamelogic.MoveOutcomeSamePlayer:
+			return nil
+		case gamelogic.MoveOutcomeMakeWar:
+			return []string{move + ", you are at war in " + string(e.Front) + "!"}
+		}
+		return []string{move}
+
+	case gamelogic.WarResolved:
+		return []string{describeWar(e)}
+
+	case gamelogic.PresenceChanged:
+		switch e.Status {
+		case gamelogic.PresenceLeave:
+			return []string{e.Username + " left the game"}
+		case gamelogic.PresenceJoin:
+			return []string{e.Username + " joined the game"}
+		}
+		return []string{e.Username + " is playing"}
+	}
+
+	// everything else reads the same as on the console
+	var text strings.Builder
+	gamelogic.ConsoleRenderer{W: &text}.Render(e)
+	lines := []string{}
+	for _, line := range strings.Split(text.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func describeWar(e gamelogic.WarResolved) string {
+	attacker, defender := e.War.Attacker.Username, e.War.Defender.Username
+	opponent := attacker
+	if e.Player == attacker {
+		opponent = defender
+	}
+	switch e.Outcome {
+	case gamelogic.WarOutcomeNoUnits:
+		return fmt.Sprintf("%s declared war on %s, but their armies never met", attacker, defender)
+	case gamelogic.WarOutcomeYouWon:
+		return fmt.Sprintf("You won the war against %s in %s (%d to %d)", opponent, e.Front, e.AttackerPower, e.DefenderPower)
+	case gamelogic.WarOutcomeOpponentWon:
+		return fmt.Sprintf("You lost the war against %s in %s (%d to %d), your units there were killed", opponent, e.Front, e.AttackerPower, e.DefenderPower)
+	case gamelogic.WarOutcomeDraw:
+		return fmt.Sprintf("The war against %s in %s ended in a draw, your units there were killed", opponent, e.Front)
+	}
+	return fmt.Sprintf("%s declared war on %s", attacker, defender)
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTerminal = errors.New("the terminal UI is only supported on unix systems")
+
+func makeRaw() (string, error) {
+	return "", errNoTerminal
+}
+
+func restoreTerminal(saved string) error {
+	return nil
+}
+
+func terminalSize() (rows, cols int, err error) {
+	return 0, 0, errNoTerminal
+}
+
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,56 @@
+//go:build unix
+
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// stty is available on every unix, which saves a dependency for two ioctls
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// makeRaw turns off line buffering and echo, and returns the previous
+// settings for restoreTerminal
+func makeRaw() (string, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return "", err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return "", err
+	}
+	return saved, nil
+}
+
+func restoreTerminal(saved string) error {
+	_, err := stty(saved)
+	return err
+}
+
+func terminalSize() (rows, cols int, err error) {
+	out, err := stty("size")
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscan(out, &rows, &cols); err != nil {
+		return 0, 0, fmt.Errorf("could not read terminal size %q: %v", out, err)
+	}
+	return rows, cols, nil
+}
+
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
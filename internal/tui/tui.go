@@ -0,0 +1,244 @@
+// Package tui is a full screen terminal client. It shows the map, the
+// player's units and a feed of everything happening in the game above a
+// command line with history and tab completion
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MichalGul/learn-pub-sub-starter/internal/client"
+	"github.com/MichalGul/learn-pub-sub-starter/internal/logging"
+)
+
+const (
+	feedSize        = 500
+	refreshInterval = 500 * time.Millisecond
+)
+
+// App is the state of the screen
+type App struct {
+	client     *client.Client
+	screen     io.Writer // the terminal, stdout is redirected into the feed
+	rows, cols int
+	feed       []string
+	input      []rune
+	history    []string
+	historyPos int    // index into history while browsing it, len(history) otherwise
+	hint       string // completions or the result of the last command
+	busy       bool   // a command is running
+	events     *Feed
+}
+
+// Run takes over the terminal until the player quits. The events of feed,
+// which must be the renderer of c, are shown in the event feed along with
+// anything printed to stdout or logged meanwhile
+func Run(c *client.Client, feed *Feed) error {
+	rows, cols, err := terminalSize()
+	if err != nil {
+		return err
+	}
+	saved, err := makeRaw()
+	if err != nil {
+		return err
+	}
+	defer restoreTerminal(saved)
+
+	output, err := captureOutput()
+	if err != nil {
+		return err
+	}
+	screen := output.screen
+	defer output.restore()
+
+	io.WriteString(screen, enterAltScreen)
+	defer io.WriteString(screen, leaveAltScreen)
+
+	a := &App{client: c, screen: screen, rows: rows, cols: cols, events: feed}
+	return a.loop(output.lines)
+}
+
+func (a *App) loop(lines <-chan string) error {
+	keys := make(chan []byte)
+	go readKeys(keys)
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	done := make(chan error, 1)
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		a.draw()
+		select {
+		case line := <-a.events.lines:
+			a.addToFeed(line)
+
+		case line := <-lines:
+			a.addToFeed(line)
+
+		case <-resized:
+			if rows, cols, err := terminalSize(); err == nil {
+				a.rows, a.cols = rows, cols
+			}
+
+		case <-ticker.C:
+
+		case <-a.client.Kicked():
+			return client.ErrKicked
+
+		case err := <-done:
+			a.busy = false
+			if errors.Is(err, client.ErrQuit) {
+				return nil
+			}
+			if err != nil {
+				a.hint = err.Error()
+			}
+
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if quit := a.handleKeys(key, done); quit {
+				return nil
+			}
+		}
+	}
+}
+
+// handleKeys edits the command line and reports whether the player wants to leave
+func (a *App) handleKeys(keys []byte, done chan<- error) bool {
+	for i := 0; i < len(keys); i++ {
+		switch keys[i] {
+		case ctrlC, ctrlD:
+			return true
+		case '\r', '\n':
+			a.submit(done)
+		case '\t':
+			a.complete()
+		case backspace, ctrlH:
+			if len(a.input) > 0 {
+				a.input = a.input[:len(a.input)-1]
+			}
+		case ctrlU:
+			a.input = nil
+		case escape:
+			// arrow keys arrive as ESC [ A..D
+			if i+2 < len(keys) && keys[i+1] == '[' {
+				switch keys[i+2] {
+				case 'A':
+					a.browseHistory(-1)
+				case 'B':
+					a.browseHistory(1)
+				}
+				i += 2
+			}
+		default:
+			if keys[i] >= ' ' {
+				// multi byte characters come in one read, decode the rest of it
+				a.input = append(a.input, []rune(string(keys[i:]))...)
+				i = len(keys)
+			}
+		}
+	}
+	return false
+}
+
+func (a *App) submit(done chan<- error) {
+	line := strings.TrimSpace(string(a.input))
+	a.input = nil
+	if line == "" {
+		return
+	}
+	if a.busy {
+		a.hint = "wait for the previous command to finish"
+		return
+	}
+	a.history = append(a.history, line)
+	a.historyPos = len(a.history)
+	a.addToFeed("> " + line)
+	a.hint = ""
+
+	a.busy = true
+	words := strings.Fields(line)
+	go func() { done <- a.client.Run(words) }()
+}
+
+func (a *App) browseHistory(step int) {
+	pos := a.historyPos + step
+	if pos < 0 || pos > len(a.history) {
+		return
+	}
+	a.historyPos = pos
+	if pos == len(a.history) {
+		a.input = nil
+		return
+	}
+	a.input = []rune(a.history[pos])
+}
+
+func (a *App) addToFeed(line string) {
+	a.feed = append(a.feed, line)
+	if len(a.feed) > feedSize {
+		a.feed = a.feed[len(a.feed)-feedSize:]
+	}
+}
+
+func readKeys(keys chan<- []byte) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		keys <- append([]byte{}, buf[:n]...)
+	}
+}
+
+// capturedOutput sends what is written to stdout and the log to lines, for
+// the output of commands that is not reported as events
+type capturedOutput struct {
+	screen  *os.File
+	lines   chan string
+	restore func()
+}
+
+func captureOutput() (capturedOutput, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return capturedOutput{}, err
+	}
+	screen := os.Stdout
+	os.Stdout = w
+	restoreLog := logging.Redirect(w)
+
+	lines := make(chan string, feedSize)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			// handlers reprint the prompt of the line client, it is not part of the event
+			line := strings.TrimSpace(scanner.Text())
+			for strings.HasPrefix(line, ">") {
+				line = strings.TrimSpace(strings.TrimPrefix(line, ">"))
+			}
+			if line != "" && !strings.HasPrefix(line, "----") {
+				lines <- line
+			}
+		}
+	}()
+
+	return capturedOutput{
+		screen: screen,
+		lines:  lines,
+		restore: func() {
+			os.Stdout = screen
+			restoreLog()
+			w.Close()
+		},
+	}, nil
+}
@@ -11,6 +11,13 @@ num_instances=$1
 # Array to store process IDs
 declare -a pids
 
+# The servers share queues, so they must share the secret signing sessions and keys
+if [ -z "$PERIL_SESSION_SECRET" ]; then
+  PERIL_SESSION_SECRET=$(head -c 32 /dev/urandom | base64)
+  echo "Using a generated session secret, set PERIL_SESSION_SECRET to reuse one across runs"
+fi
+export PERIL_SESSION_SECRET
+
 # Function to kill all processes when Ctrl+C is pressed
 cleanup() {
   echo "Terminating all instances of ./cmd/server..."
@@ -23,7 +30,8 @@ cleanup() {
 # Setup trap for SIGINT
 trap 'cleanup' SIGINT
 
-# Start the specified number of instances of the program in the background
+# Start the specified number of instances of the program in the background.
+# They share the game log work and elect one leader per game, which pauses it
 for (( i=0; i<num_instances; i++ )); do
   go run ./cmd/server &
   pids+=($!)